@@ -0,0 +1,27 @@
+// Package events is the contract of the task events task_service appends to Redis and
+// notification_service consumes. The envelope and payload messages are in events.proto,
+// generated into events/generated.
+package events
+
+// TaskEventsStream is the Redis stream task events are appended to
+const TaskEventsStream = "task_events"
+
+// Task event types, their payload is the TaskChanged message of events.proto
+const (
+	EventTaskCreated = "task_created"
+	EventTaskUpdated = "task_updated"
+	EventTaskDeleted = "task_deleted"
+)
+
+// IsTaskEventType reports whether eventType is one of the task event types above
+func IsTaskEventType(eventType string) bool {
+	switch eventType {
+	case EventTaskCreated, EventTaskUpdated, EventTaskDeleted:
+		return true
+	}
+	return false
+}
+
+// TaskChangedVersion is the version of the TaskChanged payload task_service writes, consumers
+// dead-letter versions they don't know
+const TaskChangedVersion = 1
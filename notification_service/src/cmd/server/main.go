@@ -5,10 +5,21 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
+	// quiet hours are in the users' timezones, containers often lack the zoneinfo files
+	_ "time/tzdata"
 
+	"notificationservice/src/internal/adaptors/email"
+	"notificationservice/src/internal/adaptors/ndjson"
+	"notificationservice/src/internal/adaptors/persistance"
 	"notificationservice/src/internal/adaptors/redis"
+	client "notificationservice/src/internal/adaptors/user_grpc_client"
 	"notificationservice/src/internal/config"
+	"notificationservice/src/internal/core/notification"
 	"notificationservice/src/internal/interfaces/http/handler"
+	"notificationservice/src/internal/interfaces/http/middleware"
 	"notificationservice/src/internal/interfaces/http/routes"
 	"notificationservice/src/internal/interfaces/subscriber"
 	"notificationservice/src/internal/usecase"
@@ -29,19 +40,199 @@ func main() {
 	defer redisClient.Close()
 	log.Println("Connected to Redis")
 
-	// Use Redis directly instead of repository
-	notificationUseCase := usecase.NewNotificationUseCase(redisClient)
+	// Expired notifications are archived when an archive is configured, dropped otherwise
+	notificationArchive := archive(cfg)
+	if notificationArchive != nil {
+		defer notificationArchive.Close()
+		redisClient.SetRetention(retention(cfg), archiveGrace)
+	} else {
+		redisClient.SetRetention(retention(cfg), 0)
+	}
+	archiveUseCase := usecase.NewArchiveUseCase(redisClient, notificationArchive)
+	go archiveUseCase.Run(context.Background(), time.Minute)
+
+	// gRPC client to user_service, every HTTP request is authenticated with it
+	grpcClient, err := client.NewSessionValidatorClient(fmt.Sprintf("localhost:%s", cfg.GRPC_PORT))
+	if err != nil {
+		log.Fatalf("Failed to connect to user service: %v", err)
+	}
+
+	// Notifications are stored in Redis and also sent over the configured channels
+	userCacheTTL := 5 * time.Minute
+	if ttl, err := time.ParseDuration(cfg.USER_CACHE_TTL); err == nil && ttl > 0 {
+		userCacheTTL = ttl
+	} else if cfg.USER_CACHE_TTL != "" {
+		log.Printf("Invalid USER_CACHE_TTL %q, using %s", cfg.USER_CACHE_TTL, userCacheTTL)
+	}
+	userDirectory := client.NewUserDirectory(grpcClient, userCacheTTL)
+	coalesceWindow := 30 * time.Second
+	if window, err := time.ParseDuration(cfg.NOTIFICATION_COALESCE_WINDOW); err == nil && window >= 0 {
+		coalesceWindow = window
+	} else if cfg.NOTIFICATION_COALESCE_WINDOW != "" {
+		log.Printf("Invalid NOTIFICATION_COALESCE_WINDOW %q, using %s", cfg.NOTIFICATION_COALESCE_WINDOW, coalesceWindow)
+	}
+	enabledChannels := channels(cfg)
+	notificationUseCase := usecase.NewNotificationUseCase(redisClient, userDirectory, coalesceWindow, enabledChannels...)
+	// merged updates are sent once their window closes
+	go notificationUseCase.SendBursts(context.Background(), time.Second)
 	notificationHandler := handler.NewNotificationHandler(notificationUseCase)
-	eventSubscriber := subscriber.NewEventSubscriber(redisClient, notificationUseCase)
+	webhookUseCase := usecase.NewWebhookUseCase(redisClient)
+	webhookHandler := handler.NewWebhookHandler(webhookUseCase)
+	eventSubscriber := subscriber.NewEventSubscriber(redisClient, notificationUseCase, webhookUseCase, archiveUseCase)
+
+	// Task events queue webhook deliveries, every replica helps sending them
+	go usecase.NewWebhookDispatcher(redisClient, userDirectory, webhookOptions(cfg)).Run(context.Background(), time.Second)
+
+	// Users with a digest get their task events summed up by a channel that sends digests
+	for _, channel := range enabledChannels {
+		if digestChannel, ok := channel.(notification.DigestChannel); ok {
+			go usecase.NewDigestScheduler(redisClient, userDirectory, digestChannel).Run(context.Background(), 30*time.Second)
+		}
+	}
+
+	// Task and user events come from streams, replicas share them through one consumer group
+	go eventSubscriber.ConsumeTaskEvents(context.Background(), streamOptions(cfg))
+	go eventSubscriber.ConsumeUserEvents(context.Background(), streamOptions(cfg))
 
-	// Start event subscriber in a goroutine
-	channel := "task_events" // ^Channel Name of Subscribed Channel
-	go eventSubscriber.StartListening(context.Background(), channel)
+	// Streams get new notifications from the hub, which hears them from every replica
+	inboxHub := usecase.NewInboxHub(redisClient)
+	go inboxHub.Run(context.Background())
+	heartbeat := 25 * time.Second
+	if interval, err := time.ParseDuration(cfg.STREAM_HEARTBEAT_INTERVAL); err == nil && interval > 0 {
+		heartbeat = interval
+	} else if cfg.STREAM_HEARTBEAT_INTERVAL != "" {
+		log.Printf("Invalid STREAM_HEARTBEAT_INTERVAL %q, using %s", cfg.STREAM_HEARTBEAT_INTERVAL, heartbeat)
+	}
+	streamHandler := handler.NewStreamHandler(notificationUseCase, inboxHub, heartbeat)
 
 	// Initialize HTTP routes
-	router := routes.InitRoutes(notificationHandler)
+	router := routes.InitRoutes(notificationHandler, streamHandler, webhookHandler, handler.NewArchiveHandler(archiveUseCase), middleware.SessionAuthMiddleware(grpcClient))
 
 	// Start HTTP server
 	log.Printf("Notification service HTTP server starting on port %s", cfg.APP_PORT)
 	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", cfg.APP_PORT), router))
 }
+
+// archiveGrace keeps expired notifications in Redis while the archiver is down, so none are lost
+const archiveGrace = 24 * time.Hour
+
+// retention reads how long notifications are kept, in general and per event type
+func retention(cfg *config.Config) notification.Retention {
+	policy := notification.Retention{Default: redis.NotificationTTL, ByType: map[string]time.Duration{}}
+	if ttl, err := time.ParseDuration(cfg.NOTIFICATION_RETENTION); err == nil && ttl > 0 {
+		policy.Default = ttl
+	} else if cfg.NOTIFICATION_RETENTION != "" {
+		log.Printf("Invalid NOTIFICATION_RETENTION %q, using %s", cfg.NOTIFICATION_RETENTION, policy.Default)
+	}
+	for _, entry := range strings.Split(cfg.NOTIFICATION_RETENTION_BY_TYPE, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		eventType, value, _ := strings.Cut(entry, "=")
+		ttl, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || ttl <= 0 {
+			log.Printf("Invalid NOTIFICATION_RETENTION_BY_TYPE entry %q, ignoring it", entry)
+			continue
+		}
+		policy.ByType[strings.TrimSpace(eventType)] = ttl
+	}
+	return policy
+}
+
+// archive opens the archive chosen in the config, nil when there is none
+func archive(cfg *config.Config) notification.Archive {
+	switch cfg.ARCHIVE_BACKEND {
+	case "":
+		return nil
+	case "postgres":
+		pgArchive, err := persistance.NewNotificationArchive(cfg.ARCHIVE_DATABASE_URL)
+		if err != nil {
+			log.Fatalf("Failed to open notification archive: %v", err)
+		}
+		log.Println("Archiving expired notifications to PostgreSQL")
+		return pgArchive
+	case "ndjson":
+		if cfg.ARCHIVE_DIR == "" {
+			log.Fatalf("ARCHIVE_DIR is required for the ndjson archive")
+		}
+		fileArchive, err := ndjson.NewNDJSONArchive(cfg.ARCHIVE_DIR)
+		if err != nil {
+			log.Fatalf("Failed to open notification archive: %v", err)
+		}
+		log.Printf("Archiving expired notifications to %s", cfg.ARCHIVE_DIR)
+		return fileArchive
+	default:
+		log.Fatalf("Unknown ARCHIVE_BACKEND %q, use postgres or ndjson", cfg.ARCHIVE_BACKEND)
+		return nil
+	}
+}
+
+// channels lists the delivery channels enabled in the config
+func channels(cfg *config.Config) []notification.Channel {
+	var enabled []notification.Channel
+	if cfg.SMTP_HOST != "" {
+		port := cfg.SMTP_PORT
+		if port == "" {
+			port = "25"
+		}
+		smtpChannel, err := email.NewSMTPChannel(email.SMTPConfig{
+			Host:     cfg.SMTP_HOST,
+			Port:     port,
+			Username: cfg.SMTP_USERNAME,
+			Password: cfg.SMTP_PASSWORD,
+			From:     cfg.EMAIL_FROM,
+		})
+		if err != nil {
+			log.Fatalf("Invalid email configuration: %v", err)
+		}
+		log.Printf("Emailing notifications through %s:%s", cfg.SMTP_HOST, port)
+		enabled = append(enabled, smtpChannel)
+	}
+	return enabled
+}
+
+func webhookOptions(cfg *config.Config) usecase.WebhookOptions {
+	opts := usecase.WebhookOptions{
+		MaxAttempts:  cfg.WEBHOOK_MAX_ATTEMPTS,
+		DisableAfter: cfg.WEBHOOK_DISABLE_AFTER,
+		Timeout:      10 * time.Second,
+		AllowPrivate: cfg.WEBHOOK_ALLOW_PRIVATE,
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 8
+	}
+	if opts.DisableAfter <= 0 {
+		opts.DisableAfter = 20
+	}
+	if timeout, err := time.ParseDuration(cfg.WEBHOOK_TIMEOUT); err == nil && timeout > 0 {
+		opts.Timeout = timeout
+	} else if cfg.WEBHOOK_TIMEOUT != "" {
+		log.Printf("Invalid WEBHOOK_TIMEOUT %q, using %s", cfg.WEBHOOK_TIMEOUT, opts.Timeout)
+	}
+	return opts
+}
+
+func streamOptions(cfg *config.Config) subscriber.StreamOptions {
+	opts := subscriber.StreamOptions{
+		Group:         cfg.TASK_EVENTS_GROUP,
+		Consumer:      cfg.TASK_EVENTS_CONSUMER,
+		ReclaimIdle:   time.Minute,
+		MaxDeliveries: cfg.TASK_EVENTS_MAX_DELIVERIES,
+	}
+	if opts.Group == "" {
+		opts.Group = "notification_service"
+	}
+	if opts.Consumer == "" {
+		hostname, _ := os.Hostname()
+		opts.Consumer = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	if idle, err := time.ParseDuration(cfg.TASK_EVENTS_RECLAIM_IDLE); err == nil && idle > 0 {
+		opts.ReclaimIdle = idle
+	} else if cfg.TASK_EVENTS_RECLAIM_IDLE != "" {
+		log.Printf("Invalid TASK_EVENTS_RECLAIM_IDLE %q, using %s", cfg.TASK_EVENTS_RECLAIM_IDLE, opts.ReclaimIdle)
+	}
+	if opts.MaxDeliveries <= 0 {
+		opts.MaxDeliveries = 5
+	}
+	return opts
+}
@@ -0,0 +1,182 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"notificationservice/src/internal/core/notification"
+	"notificationservice/src/internal/core/user"
+	"strings"
+	"time"
+)
+
+// sendTimeout bounds one delivery when the caller's context has no deadline
+const sendTimeout = 30 * time.Second
+
+// ErrNoAddress is returned for recipients without an email address
+var ErrNoAddress = errors.New("recipient has no email address")
+
+type SMTPConfig struct {
+	Host string
+	Port string
+	// Username is empty for servers that take mail without authentication, like local stubs
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPChannel emails notifications through an SMTP server, upgrading to TLS when the server
+// offers STARTTLS
+type SMTPChannel struct {
+	config SMTPConfig
+	from   mail.Address
+}
+
+func NewSMTPChannel(config SMTPConfig) (*SMTPChannel, error) {
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %v", config.From, err)
+	}
+	return &SMTPChannel{config: config, from: *from}, nil
+}
+
+func (c *SMTPChannel) Name() string {
+	return "email"
+}
+
+func (c *SMTPChannel) Send(ctx context.Context, recipient user.UserInfo, notif notification.Notification) error {
+	if recipient.Email == "" {
+		return ErrNoAddress
+	}
+	rendered, err := render(recipient, notif)
+	if err != nil {
+		return fmt.Errorf("failed to render %s email: %v", notif.Action, err)
+	}
+	to := mail.Address{Name: recipientName(recipient), Address: recipient.Email}
+	message, err := c.compose(to, notif.ID, rendered)
+	if err != nil {
+		return fmt.Errorf("failed to compose email: %v", err)
+	}
+	return c.deliver(ctx, to.Address, message)
+}
+
+// SendDigest emails the digest as one message listing its tasks
+func (c *SMTPChannel) SendDigest(ctx context.Context, recipient user.UserInfo, digest notification.Digest) error {
+	if recipient.Email == "" {
+		return ErrNoAddress
+	}
+	rendered, err := renderDigest(recipient, digest)
+	if err != nil {
+		return fmt.Errorf("failed to render digest email: %v", err)
+	}
+	to := mail.Address{Name: recipientName(recipient), Address: recipient.Email}
+	message, err := c.compose(to, fmt.Sprintf("digest-%d-%d", digest.UserID, digest.Until.Unix()), rendered)
+	if err != nil {
+		return fmt.Errorf("failed to compose email: %v", err)
+	}
+	return c.deliver(ctx, to.Address, message)
+}
+
+// compose builds a multipart/alternative message with the plain text and HTML bodies
+func (c *SMTPChannel) compose(to mail.Address, messageID string, rendered email) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", rendered.Text},
+		{"text/html; charset=utf-8", rendered.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	// the subject comes from task names, a line break in it must not start a new header
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(rendered.Subject)
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", c.from.String())
+	fmt.Fprintf(&message, "To: %s\r\n", to.String())
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Message-ID: <%s@%s>\r\n", messageID, c.config.Host)
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+func (c *SMTPChannel) deliver(ctx context.Context, to string, message []byte) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sendTimeout)
+		defer cancel()
+	}
+	deadline, _ := ctx.Deadline()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(c.config.Host, c.config.Port))
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %v", err)
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, c.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %v", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: c.config.Host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %v", err)
+		}
+	}
+	if c.config.Username != "" {
+		// PlainAuth refuses to send the password over a connection that is not encrypted
+		auth := smtp.PlainAuth("", c.config.Username, c.config.Password, c.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %v", err)
+		}
+	}
+
+	if err := client.Mail(c.from.Address); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %v", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("SMTP RCPT TO failed: %v", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %v", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("failed to write email: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected email: %v", err)
+	}
+	return client.Quit()
+}
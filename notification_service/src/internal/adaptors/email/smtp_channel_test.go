@@ -0,0 +1,311 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"notificationservice/src/internal/core/notification"
+	"notificationservice/src/internal/core/user"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpStub is a minimal SMTP server that accepts every message without authentication or TLS,
+// as net/smtp talks to it
+type smtpStub struct {
+	listener net.Listener
+	received chan receivedEmail
+}
+
+// receivedEmail is one message the stub accepted, with its envelope
+type receivedEmail struct {
+	from string
+	to   []string
+	data []byte
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStub{listener: listener, received: make(chan receivedEmail, 16)}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 stub ESMTP")
+
+	var current receivedEmail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 stub")
+		case "MAIL":
+			current = receivedEmail{from: address(arg)}
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			current.to = append(current.to, address(arg))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			current.data = data
+			s.received <- current
+			tp.PrintfLine("250 OK")
+		case "RSET", "NOOP":
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// address takes the address out of "FROM:<a@b>" or "TO:<a@b>"
+func address(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	addr, _, _ = strings.Cut(addr, " ")
+	return strings.Trim(addr, "<>")
+}
+
+func (s *smtpStub) channel(t *testing.T) *SMTPChannel {
+	t.Helper()
+	host, port, err := net.SplitHostPort(s.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	channel, err := NewSMTPChannel(SMTPConfig{Host: host, Port: port, From: "Task Manager <tasks@example.com>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return channel
+}
+
+func (s *smtpStub) next(t *testing.T) receivedEmail {
+	t.Helper()
+	select {
+	case email := <-s.received:
+		return email
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stub received no email")
+		return receivedEmail{}
+	}
+}
+
+// parsedEmail is a received message with its subject decoded and its parts by content type
+type parsedEmail struct {
+	header  mail.Header
+	subject string
+	parts   map[string]string
+}
+
+func parseEmail(t *testing.T, data []byte) parsedEmail {
+	t.Helper()
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("unreadable message: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("undecodable subject %q: %v", msg.Header.Get("Subject"), err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type is %q, want multipart/alternative", msg.Header.Get("Content-Type"))
+	}
+	parsed := parsedEmail{header: msg.Header, subject: subject, parts: make(map[string]string)}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		// quoted-printable parts are decoded by the reader
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("unreadable part: %v", err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("unreadable part: %v", err)
+		}
+		parsed.parts[part.Header.Get("Content-Type")] = string(body)
+	}
+	return parsed
+}
+
+var testRecipient = user.UserInfo{Id: 7, Username: "ada", DisplayName: "Ada Lovelace", Email: "ada@example.com"}
+
+func TestSendComposesMultipartEmail(t *testing.T) {
+	stub := newSMTPStub(t)
+	notif := notification.Notification{
+		ID:        "event-1-7",
+		TaskID:    42,
+		Action:    "task_updated",
+		TaskName:  "Write <docs>",
+		UserID:    7,
+		Message:   "Bob updated Write <docs>",
+		Changes:   []notification.Change{{Field: "status", From: "pending", To: "done"}},
+		Timestamp: time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC),
+	}
+	if err := stub.channel(t).Send(context.Background(), testRecipient, notif); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	received := stub.next(t)
+	if received.from != "tasks@example.com" || len(received.to) != 1 || received.to[0] != "ada@example.com" {
+		t.Fatalf("envelope from %q to %v", received.from, received.to)
+	}
+	email := parseEmail(t, received.data)
+	if email.subject != "Task updated: Write <docs>" {
+		t.Errorf("subject is %q", email.subject)
+	}
+	if to, err := email.header.AddressList("To"); err != nil || to[0].Name != "Ada Lovelace" || to[0].Address != "ada@example.com" {
+		t.Errorf("To is %q", email.header.Get("To"))
+	}
+	if !strings.HasPrefix(email.header.Get("Message-Id"), "<event-1-7@") {
+		t.Errorf("Message-ID is %q", email.header.Get("Message-Id"))
+	}
+	if len(email.parts) != 2 {
+		t.Fatalf("got parts %v, want text and HTML", email.parts)
+	}
+
+	text := email.parts["text/plain; charset=utf-8"]
+	for _, want := range []string{"Hi Ada Lovelace,", "Bob updated Write <docs>.", "  - status: pending -> done", "Mon, 19 Oct 2026 09:30:00 UTC"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text part lacks %q:\n%s", want, text)
+		}
+	}
+	html := email.parts["text/html; charset=utf-8"]
+	for _, want := range []string{"<p>Hi Ada Lovelace,</p>", "Bob updated Write &lt;docs&gt;.", "<td>status</td><td>pending</td><td>done</td>"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML part lacks %q:\n%s", want, html)
+		}
+	}
+}
+
+func TestSendKeepsSubjectOnOneHeader(t *testing.T) {
+	stub := newSMTPStub(t)
+	notif := notification.Notification{
+		ID:        "event-2-7",
+		Action:    "task_created",
+		TaskName:  "Pay invoice\r\nBcc: attacker@example.com\r\n\r\nInjected body",
+		UserID:    7,
+		Message:   "You were assigned a task",
+		Timestamp: time.Now(),
+	}
+	if err := stub.channel(t).Send(context.Background(), testRecipient, notif); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	email := parseEmail(t, stub.next(t).data)
+	if bcc := email.header.Get("Bcc"); bcc != "" {
+		t.Errorf("the task name added a Bcc header %q", bcc)
+	}
+	if strings.ContainsAny(email.subject, "\r\n") {
+		t.Errorf("subject %q spans lines", email.subject)
+	}
+	if !strings.HasPrefix(email.subject, "New task: Pay invoice") || !strings.Contains(email.subject, "Bcc: attacker@example.com") {
+		t.Errorf("subject is %q", email.subject)
+	}
+	if len(email.parts) != 2 || strings.Contains(email.parts["text/plain; charset=utf-8"], "Injected body") {
+		t.Errorf("the task name changed the body: %v", email.parts)
+	}
+}
+
+func TestSendRendersEveryEventType(t *testing.T) {
+	const securityAdvice = "If this wasn't you, change your password and sign out of all devices."
+	tests := []struct {
+		action   string
+		taskName string
+		subject  string
+		text     []string
+		html     []string
+	}{
+		{"task_created", "Plan sprint", "New task: Plan sprint", []string{"Alice assigned you Plan sprint."}, []string{"<p>Alice assigned you Plan sprint.</p>"}},
+		{"task_updated", "Plan sprint", "Task updated: Plan sprint", []string{"Alice assigned you Plan sprint."}, []string{"<p>Alice assigned you Plan sprint.</p>"}},
+		{"task_deleted", "Plan sprint", "Task deleted: Plan sprint", []string{"Alice assigned you Plan sprint."}, []string{"<p>Alice assigned you Plan sprint.</p>"}},
+		{"account_locked", "", "Your account was locked", []string{securityAdvice}, []string{"<strong>If this wasn't you"}},
+		{"password_changed", "", "Your password was changed", []string{securityAdvice}, []string{"<strong>If this wasn't you"}},
+		{"refresh_token_reuse", "", "Your sessions were signed out", []string{securityAdvice}, []string{"<strong>If this wasn't you"}},
+		{"task_archived", "Plan sprint", "Task: Plan sprint", []string{"Alice assigned you Plan sprint\n"}, []string{"<p>Alice assigned you Plan sprint</p>"}},
+		{"login_from_new_device", "", "Account notification", []string{"Alice assigned you Plan sprint\n"}, []string{"<p>Alice assigned you Plan sprint</p>"}},
+	}
+
+	stub := newSMTPStub(t)
+	channel := stub.channel(t)
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			notif := notification.Notification{
+				ID:        "event-" + tt.action,
+				Action:    tt.action,
+				TaskName:  tt.taskName,
+				UserID:    7,
+				Message:   "Alice assigned you Plan sprint",
+				Timestamp: time.Now(),
+			}
+			if err := channel.Send(context.Background(), testRecipient, notif); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+
+			email := parseEmail(t, stub.next(t).data)
+			if email.subject != tt.subject {
+				t.Errorf("subject is %q, want %q", email.subject, tt.subject)
+			}
+			text := email.parts["text/plain; charset=utf-8"]
+			html := email.parts["text/html; charset=utf-8"]
+			if !strings.HasPrefix(text, "Hi Ada Lovelace,") || !strings.Contains(html, "<p>Hi Ada Lovelace,</p>") {
+				t.Errorf("the email doesn't greet the recipient:\n%s\n%s", text, html)
+			}
+			for _, want := range tt.text {
+				if !strings.Contains(text, want) {
+					t.Errorf("text part lacks %q:\n%s", want, text)
+				}
+			}
+			for _, want := range tt.html {
+				if !strings.Contains(html, want) {
+					t.Errorf("HTML part lacks %q:\n%s", want, html)
+				}
+			}
+		})
+	}
+}
+
+func TestSendNeedsAnAddress(t *testing.T) {
+	stub := newSMTPStub(t)
+	err := stub.channel(t).Send(context.Background(), user.UserInfo{Id: 8, Username: "noemail"}, notification.Notification{Action: "task_created"})
+	if !errors.Is(err, ErrNoAddress) {
+		t.Fatalf("got %v, want ErrNoAddress", err)
+	}
+}
@@ -0,0 +1,253 @@
+package email
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"notificationservice/src/internal/core/notification"
+	"notificationservice/src/internal/core/user"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// textTemplates holds "<event type>.subject" and "<event type>.text" for every event type,
+// htmlTemplates "<event type>.html". Event types without their own template use "default".
+var textTemplates = texttemplate.Must(texttemplate.New("email").Parse(`
+{{- define "task_created.subject"}}New task: {{.TaskName}}{{end}}
+{{- define "task_updated.subject"}}Task updated: {{.TaskName}}{{end}}
+{{- define "task_deleted.subject"}}Task deleted: {{.TaskName}}{{end}}
+{{- define "account_locked.subject"}}Your account was locked{{end}}
+{{- define "password_changed.subject"}}Your password was changed{{end}}
+{{- define "refresh_token_reuse.subject"}}Your sessions were signed out{{end}}
+{{- define "default.subject"}}{{if .TaskName}}Task: {{.TaskName}}{{else}}Account notification{{end}}{{end}}
+
+{{- define "task_created.text"}}{{template "task.text" .}}{{end}}
+{{- define "task_updated.text"}}{{template "task.text" .}}{{end}}
+{{- define "task_deleted.text"}}{{template "task.text" .}}{{end}}
+{{- define "account_locked.text"}}{{template "security.text" .}}{{end}}
+{{- define "password_changed.text"}}{{template "security.text" .}}{{end}}
+{{- define "refresh_token_reuse.text"}}{{template "security.text" .}}{{end}}
+
+{{- define "task.text"}}Hi {{.RecipientName}},
+
+{{.Message}}.
+{{- if .Changes}}
+
+What changed:
+{{- range .Changes}}
+  - {{.Field}}: {{.From}} -> {{.To}}
+{{- end}}
+{{- end}}
+
+{{.Time}}
+{{end}}
+
+{{- define "security.text"}}Hi {{.RecipientName}},
+
+{{.Message}}.
+
+If this wasn't you, change your password and sign out of all devices.
+
+{{.Time}}
+{{end}}
+
+{{- define "default.text"}}Hi {{.RecipientName}},
+
+{{.Message}}
+
+{{.Time}}
+{{end}}`))
+
+var htmlTemplates = htmltemplate.Must(htmltemplate.New("email").Parse(`
+{{- define "task_created.html"}}{{template "task.html" .}}{{end}}
+{{- define "task_updated.html"}}{{template "task.html" .}}{{end}}
+{{- define "task_deleted.html"}}{{template "task.html" .}}{{end}}
+{{- define "account_locked.html"}}{{template "security.html" .}}{{end}}
+{{- define "password_changed.html"}}{{template "security.html" .}}{{end}}
+{{- define "refresh_token_reuse.html"}}{{template "security.html" .}}{{end}}
+
+{{- define "task.html"}}<!DOCTYPE html>
+<html><body>
+<p>Hi {{.RecipientName}},</p>
+<p>{{.Message}}.</p>
+{{- if .Changes}}
+<table cellpadding="4">
+<tr><th align="left">Field</th><th align="left">Before</th><th align="left">After</th></tr>
+{{- range .Changes}}
+<tr><td>{{.Field}}</td><td>{{.From}}</td><td>{{.To}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+<p style="color:#666">{{.Time}}</p>
+</body></html>
+{{end}}
+
+{{- define "security.html"}}<!DOCTYPE html>
+<html><body>
+<p>Hi {{.RecipientName}},</p>
+<p>{{.Message}}.</p>
+<p><strong>If this wasn't you, change your password and sign out of all devices.</strong></p>
+<p style="color:#666">{{.Time}}</p>
+</body></html>
+{{end}}
+
+{{- define "default.html"}}<!DOCTYPE html>
+<html><body>
+<p>Hi {{.RecipientName}},</p>
+<p>{{.Message}}</p>
+<p style="color:#666">{{.Time}}</p>
+</body></html>
+{{end}}`))
+
+// digestTextTemplates and digestHTMLTemplates render a digest, one section per task
+var digestTextTemplates = texttemplate.Must(texttemplate.New("digest").Parse(`
+{{- define "subject"}}Your {{.Frequency}} digest: {{.Summary}}{{end}}
+
+{{- define "text"}}Hi {{.RecipientName}},
+
+{{.Summary}} since {{.Since}}.
+{{range .Tasks}}
+{{.TaskName}}{{if .Labels}} ({{.Labels}}){{end}}
+{{- range .Messages}}
+  - {{.}}
+{{- end}}
+{{end}}
+{{.Until}}
+{{end}}`))
+
+var digestHTMLTemplates = htmltemplate.Must(htmltemplate.New("digest").Parse(`
+{{- define "html"}}<!DOCTYPE html>
+<html><body>
+<p>Hi {{.RecipientName}},</p>
+<p><strong>{{.Summary}}</strong> since {{.Since}}.</p>
+{{- range .Tasks}}
+<h3>{{.TaskName}}{{if .Labels}} <small style="color:#b00">{{.Labels}}</small>{{end}}</h3>
+<ul>
+{{- range .Messages}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+<p style="color:#666">{{.Until}}</p>
+</body></html>
+{{end}}`))
+
+type emailData struct {
+	RecipientName string
+	Action        string
+	TaskID        int
+	TaskName      string
+	Message       string
+	Changes       []notification.Change
+	Time          string
+}
+
+// email is a rendered notification
+type email struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// render fills the templates of the notification's event type
+func render(recipient user.UserInfo, notif notification.Notification) (email, error) {
+	data := emailData{
+		RecipientName: recipientName(recipient),
+		Action:        notif.Action,
+		TaskID:        notif.TaskID,
+		TaskName:      notif.TaskName,
+		Message:       notif.Message,
+		Changes:       notif.Changes,
+		Time:          notif.Timestamp.UTC().Format(time.RFC1123),
+	}
+
+	// an event type may only define a subject and share the default bodies
+	subjectName, textName, htmlName := "default.subject", "default.text", "default.html"
+	if textTemplates.Lookup(notif.Action+".subject") != nil {
+		subjectName = notif.Action + ".subject"
+	}
+	if textTemplates.Lookup(notif.Action+".text") != nil {
+		textName = notif.Action + ".text"
+	}
+	if htmlTemplates.Lookup(notif.Action+".html") != nil {
+		htmlName = notif.Action + ".html"
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&subject, subjectName, data); err != nil {
+		return email{}, err
+	}
+	if err := textTemplates.ExecuteTemplate(&text, textName, data); err != nil {
+		return email{}, err
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, htmlName, data); err != nil {
+		return email{}, err
+	}
+	return email{Subject: subject.String(), Text: text.String(), HTML: html.String()}, nil
+}
+
+type digestData struct {
+	RecipientName string
+	Frequency     string
+	Summary       string
+	Since         string
+	Until         string
+	Tasks         []digestTaskData
+}
+
+type digestTaskData struct {
+	TaskName string
+	// Labels flags the task, e.g. "assigned to you, overdue"
+	Labels   string
+	Messages []string
+}
+
+// renderDigest fills the digest templates, its times are already in the digest's timezone
+func renderDigest(recipient user.UserInfo, digest notification.Digest) (email, error) {
+	data := digestData{
+		RecipientName: recipientName(recipient),
+		Frequency:     digest.Frequency,
+		Summary:       digest.Summary(),
+		Since:         digest.Since.Format("Mon Jan 2 15:04"),
+		Until:         digest.Until.Format(time.RFC1123),
+	}
+	for _, t := range digest.Tasks {
+		var labels []string
+		if t.Assigned && !t.Deleted {
+			labels = append(labels, "assigned to you")
+		}
+		if t.DueTomorrow {
+			labels = append(labels, "due tomorrow")
+		}
+		if t.Overdue {
+			labels = append(labels, "overdue")
+		}
+		task := digestTaskData{TaskName: t.TaskName, Labels: strings.Join(labels, ", ")}
+		for _, event := range t.Events {
+			task.Messages = append(task.Messages, event.Message)
+		}
+		data.Tasks = append(data.Tasks, task)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := digestTextTemplates.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return email{}, err
+	}
+	if err := digestTextTemplates.ExecuteTemplate(&text, "text", data); err != nil {
+		return email{}, err
+	}
+	if err := digestHTMLTemplates.ExecuteTemplate(&html, "html", data); err != nil {
+		return email{}, err
+	}
+	return email{Subject: subject.String(), Text: text.String(), HTML: html.String()}, nil
+}
+
+func recipientName(recipient user.UserInfo) string {
+	if recipient.DisplayName != "" {
+		return recipient.DisplayName
+	}
+	if recipient.Username != "" {
+		return recipient.Username
+	}
+	return "there"
+}
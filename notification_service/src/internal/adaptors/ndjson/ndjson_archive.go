@@ -0,0 +1,283 @@
+package ndjson
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"notificationservice/src/internal/core/notification"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const (
+	filePrefix = "notifications-"
+	fileSuffix = ".ndjson.gz"
+	dayLayout  = "2006-01-02"
+	// lockName is the file writers lock in the archive directory
+	lockName = ".lock"
+)
+
+// NDJSONArchive keeps expired notifications in gzip compressed NDJSON files, one file per UTC
+// day they were sent on. Every Save appends one gzip member in a single write, which readers
+// see as one stream. Save and DeleteUser hold an exclusive flock on the directory, so replicas
+// sharing it on a volume with working flock take turns writing and an append can't land in a
+// file DeleteUser is replacing. The files suit a single replica or a few, PostgreSQL suits
+// anything bigger.
+type NDJSONArchive struct {
+	dir string
+	// mu takes turns between the goroutines of this replica, the flock between replicas
+	mu sync.Mutex
+}
+
+func NewNDJSONArchive(dir string) (*NDJSONArchive, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %v", err)
+	}
+	return &NDJSONArchive{dir: dir}, nil
+}
+
+func (a *NDJSONArchive) path(day string) string {
+	return filepath.Join(a.dir, filePrefix+day+fileSuffix)
+}
+
+// Save appends the notifications to the files of their days. A notification saved twice is in
+// its file twice, Search shows it once.
+func (a *NDJSONArchive) Save(ctx context.Context, notifications []notification.Notification) error {
+	byDay := make(map[string][]notification.Notification)
+	for _, notif := range notifications {
+		day := notif.Timestamp.UTC().Format(dayLayout)
+		byDay[day] = append(byDay[day], notif)
+	}
+
+	unlock, err := a.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	for day, notifs := range byDay {
+		member, err := compress(notifs)
+		if err != nil {
+			return err
+		}
+		if err := appendFile(a.path(day), member); err != nil {
+			return fmt.Errorf("failed to append to archive of %s: %v", day, err)
+		}
+	}
+	return nil
+}
+
+// Search reads the files of the days in the range, newest first, until it has enough matches
+func (a *NDJSONArchive) Search(ctx context.Context, query notification.ArchiveQuery) ([]notification.Notification, error) {
+	days, err := a.days()
+	if err != nil {
+		return nil, err
+	}
+	first, last := query.From.UTC().Format(dayLayout), query.To.UTC().Format(dayLayout)
+
+	var found []notification.Notification
+	for i := len(days) - 1; i >= 0 && len(found) < query.Limit; i-- {
+		if days[i] < first || days[i] > last {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		notifs, err := readFile(a.path(days[i]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive of %s: %v", days[i], err)
+		}
+
+		var matches []notification.Notification
+		seen := make(map[string]bool)
+		for _, notif := range notifs {
+			if seen[notif.ID] || (query.UserID != 0 && notif.UserID != query.UserID) ||
+				notif.Timestamp.Before(query.From) || !notif.Timestamp.Before(query.To) {
+				continue
+			}
+			seen[notif.ID] = true
+			matches = append(matches, notif)
+		}
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].Timestamp.After(matches[j].Timestamp) })
+		found = append(found, matches...)
+	}
+	if len(found) > query.Limit {
+		found = found[:query.Limit]
+	}
+	return found, nil
+}
+
+// DeleteUser rewrites every file holding notifications of the user without them
+func (a *NDJSONArchive) DeleteUser(ctx context.Context, userID int) error {
+	unlock, err := a.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	days, err := a.days()
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		notifs, err := readFile(a.path(day))
+		if err != nil {
+			return fmt.Errorf("failed to read archive of %s: %v", day, err)
+		}
+		kept := notifs[:0]
+		for _, notif := range notifs {
+			if notif.UserID != userID {
+				kept = append(kept, notif)
+			}
+		}
+		if len(kept) == len(notifs) {
+			continue
+		}
+
+		if len(kept) == 0 {
+			if err := os.Remove(a.path(day)); err != nil {
+				return err
+			}
+			continue
+		}
+		member, err := compress(kept)
+		if err != nil {
+			return err
+		}
+		if err := a.replace(day, member); err != nil {
+			return fmt.Errorf("failed to rewrite archive of %s: %v", day, err)
+		}
+	}
+	return nil
+}
+
+// replace writes the file of the day aside under a name of its own and renames it over the old
+// one, a crash leaves the old file or the new one
+func (a *NDJSONArchive) replace(day string, data []byte) error {
+	tmp, err := os.CreateTemp(a.dir, filePrefix+day+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o640); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), a.path(day))
+}
+
+// lock takes the write lock of the archive, the returned func releases it
+func (a *NDJSONArchive) lock() (func(), error) {
+	a.mu.Lock()
+	file, err := os.OpenFile(filepath.Join(a.dir, lockName), os.O_RDWR|os.O_CREATE, 0o640)
+	if err != nil {
+		a.mu.Unlock()
+		return nil, fmt.Errorf("failed to open archive lock: %v", err)
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		a.mu.Unlock()
+		return nil, fmt.Errorf("failed to lock archive: %v", err)
+	}
+	return func() {
+		// closing the file releases the flock
+		file.Close()
+		a.mu.Unlock()
+	}, nil
+}
+
+func (a *NDJSONArchive) Close() error {
+	return nil
+}
+
+// days lists the days that have a file, oldest first
+func (a *NDJSONArchive) days() ([]string, error) {
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		return nil, err
+	}
+	var days []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		days = append(days, strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix))
+	}
+	sort.Strings(days)
+	return days, nil
+}
+
+// compress encodes the notifications as one gzip member of NDJSON lines
+func compress(notifications []notification.Notification) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(zw)
+	for _, notif := range notifications {
+		if err := encoder.Encode(notif); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func appendFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// readFile decodes every notification of a file, in the order they were appended
+func readFile(path string) ([]notification.Notification, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var notifications []notification.Notification
+	reader := bufio.NewReader(zr)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var notif notification.Notification
+			if jsonErr := json.Unmarshal(line, &notif); jsonErr == nil {
+				notifications = append(notifications, notif)
+			}
+		}
+		if err == io.EOF {
+			return notifications, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package persistance
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"notificationservice/src/internal/core/notification"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+// the service owns this one table and has no migrations, it is created on start
+const createArchiveTable = `
+CREATE TABLE IF NOT EXISTS archived_notifications (
+	id      TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	action  TEXT NOT NULL,
+	task_id INTEGER NOT NULL DEFAULT 0,
+	sent_at TIMESTAMPTZ NOT NULL,
+	data    JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS archived_notifications_user_sent_at ON archived_notifications (user_id, sent_at DESC);
+CREATE INDEX IF NOT EXISTS archived_notifications_sent_at ON archived_notifications (sent_at DESC);`
+
+// NotificationArchive keeps expired notifications in PostgreSQL, one row each with the
+// notification as JSON and the columns it is searched by
+type NotificationArchive struct {
+	db *sql.DB
+}
+
+func NewNotificationArchive(databaseURL string) (*NotificationArchive, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to archive database: %v", err)
+	}
+	if _, err := db.Exec(createArchiveTable); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create archive table: %v", err)
+	}
+	return &NotificationArchive{db: db}, nil
+}
+
+func (a *NotificationArchive) Save(ctx context.Context, notifications []notification.Notification) error {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO archived_notifications (id, user_id, action, task_id, sent_at, data)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO NOTHING`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, notif := range notifications {
+		data, err := json.Marshal(notif)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, notif.ID, notif.UserID, notif.Action, notif.TaskID, notif.Timestamp, data); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (a *NotificationArchive) Search(ctx context.Context, query notification.ArchiveQuery) ([]notification.Notification, error) {
+	conditions := []string{"sent_at >= $1", "sent_at < $2"}
+	args := []interface{}{query.From, query.To}
+	if query.UserID != 0 {
+		args = append(args, query.UserID)
+		conditions = append(conditions, fmt.Sprintf("user_id = $%d", len(args)))
+	}
+	args = append(args, query.Limit)
+	rows, err := a.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT data FROM archived_notifications WHERE %s ORDER BY sent_at DESC, id LIMIT $%d",
+		strings.Join(conditions, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []notification.Notification
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var notif notification.Notification
+		if err := json.Unmarshal(data, &notif); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notif)
+	}
+	return notifications, rows.Err()
+}
+
+func (a *NotificationArchive) DeleteUser(ctx context.Context, userID int) error {
+	_, err := a.db.ExecContext(ctx, "DELETE FROM archived_notifications WHERE user_id = $1", userID)
+	return err
+}
+
+func (a *NotificationArchive) Close() error {
+	return a.db.Close()
+}
@@ -0,0 +1,143 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"notificationservice/src/internal/core/notification"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Task events that were processed leave a processed_event:<event id> key behind. An open burst of
+// updates is JSON under burst:<task id>:<actor id>:<recipient> and expires with its window.
+// Notifications of a burst wait for the window to close, and those held back by quiet hours for
+// them to end, as JSON under outgoing:<notification id>, scheduled in the notifications:outgoing
+// sorted set.
+
+// ProcessedEventTTL is how long a processed event is remembered, much longer than a failed
+// event waits before it is retried
+const ProcessedEventTTL = 24 * time.Hour
+
+// outgoingTTL drops waiting notifications nobody sent this long after they were due, e.g. after
+// the sending was turned off
+const outgoingTTL = time.Hour
+
+const outgoingNotifications = "notifications:outgoing"
+
+func processedEventKey(eventID string) string {
+	return "processed_event:" + eventID
+}
+
+func burstKey(taskID int, actorID int, recipient int) string {
+	return fmt.Sprintf("burst:%d:%d:%d", taskID, actorID, recipient)
+}
+
+func outgoingKey(notificationID string) string {
+	return "outgoing:" + notificationID
+}
+
+// EventProcessed tells whether the task event was processed before
+func (r *RedisClient) EventProcessed(ctx context.Context, eventID string) (bool, error) {
+	exists, err := r.client.Exists(ctx, processedEventKey(eventID)).Result()
+	return exists > 0, err
+}
+
+func (r *RedisClient) MarkEventProcessed(ctx context.Context, eventID string) error {
+	return r.client.Set(ctx, processedEventKey(eventID), time.Now().Unix(), ProcessedEventTTL).Err()
+}
+
+// GetBurst returns redis.Nil when no burst is open
+func (r *RedisClient) GetBurst(ctx context.Context, taskID int, actorID int, recipient int) (notification.Burst, error) {
+	data, err := r.client.Get(ctx, burstKey(taskID, actorID, recipient)).Bytes()
+	if err != nil {
+		return notification.Burst{}, err
+	}
+	var burst notification.Burst
+	err = json.Unmarshal(data, &burst)
+	return burst, err
+}
+
+// OpenBurst starts a burst that closes after window
+func (r *RedisClient) OpenBurst(ctx context.Context, actorID int, burst notification.Burst, window time.Duration) error {
+	data, err := json.Marshal(burst)
+	if err != nil {
+		return err
+	}
+	notif := burst.Notification
+	return r.client.Set(ctx, burstKey(notif.TaskID, actorID, notif.UserID), data, window).Err()
+}
+
+// UpdateBurst saves a burst with an update merged in, it still closes when it was opened to.
+// It reports false when the burst closed meanwhile.
+func (r *RedisClient) UpdateBurst(ctx context.Context, actorID int, burst notification.Burst) (bool, error) {
+	data, err := json.Marshal(burst)
+	if err != nil {
+		return false, err
+	}
+	notif := burst.Notification
+	err = r.client.SetArgs(ctx, burstKey(notif.TaskID, actorID, notif.UserID), data, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// QueueOutgoing keeps the notification until at, when it is sent over the channels
+func (r *RedisClient) QueueOutgoing(ctx context.Context, notif notification.Notification, at time.Time) error {
+	data, err := json.Marshal(notif)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, outgoingKey(notif.ID), data, time.Until(at)+outgoingTTL)
+		pipe.ZAdd(ctx, outgoingNotifications, redis.Z{Score: dueScore(at), Member: notif.ID})
+		return nil
+	})
+	return err
+}
+
+// UpdateOutgoing replaces a waiting notification and reports false when it is no longer waiting
+func (r *RedisClient) UpdateOutgoing(ctx context.Context, notif notification.Notification) (bool, error) {
+	data, err := json.Marshal(notif)
+	if err != nil {
+		return false, err
+	}
+	err = r.client.SetArgs(ctx, outgoingKey(notif.ID), data, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ClaimDueOutgoing returns the ids of waiting notifications due now and leases them like
+// ClaimDueDeliveries does
+func (r *RedisClient) ClaimDueOutgoing(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]string, error) {
+	return claimDue.Run(ctx, r.client, []string{outgoingNotifications},
+		strconv.FormatInt(now.UnixMilli(), 10),
+		strconv.FormatInt(now.Add(lease).UnixMilli(), 10),
+		limit,
+	).StringSlice()
+}
+
+// TakeOutgoing removes a waiting notification and returns it, redis.Nil when it is gone
+func (r *RedisClient) TakeOutgoing(ctx context.Context, id string) (notification.Notification, error) {
+	var get *redis.StringCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.GetDel(ctx, outgoingKey(id))
+		pipe.ZRem(ctx, outgoingNotifications, id)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return notification.Notification{}, err
+	}
+	data, err := get.Bytes()
+	if err != nil {
+		return notification.Notification{}, err
+	}
+	var notif notification.Notification
+	err = json.Unmarshal(data, &notif)
+	return notif, err
+}
@@ -0,0 +1,121 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"notificationservice/src/internal/core/notification"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Events waiting for a user's digest are JSON in the hash digest:<user id>:items, keyed by
+// notification id. Users with a digest schedule wait in the digests:due sorted set scored by
+// when their next digest goes out, and every digest sent leaves a digest:<user id>:sent:<time>
+// marker so it is not sent twice.
+
+// digestItemsTTL drops the waiting events of users who stopped getting digests without the
+// schedule being cleaned up, it is longer than a weekly period
+const digestItemsTTL = 15 * 24 * time.Hour
+
+// digestSentTTL keeps the sent markers until no replica can still be working on their digest
+const digestSentTTL = 8 * 24 * time.Hour
+
+const dueDigests = "digests:due"
+
+func digestItemsKey(userID int) string {
+	return fmt.Sprintf("digest:%d:items", userID)
+}
+
+func digestSentKey(userID int, at time.Time) string {
+	return fmt.Sprintf("digest:%d:sent:%d", userID, at.Unix())
+}
+
+// AddDigestItem queues an event for the user's next digest, a redelivered event replaces itself
+func (r *RedisClient) AddDigestItem(ctx context.Context, userID int, item notification.DigestItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, digestItemsKey(userID), item.NotificationID, data)
+		pipe.Expire(ctx, digestItemsKey(userID), digestItemsTTL)
+		return nil
+	})
+	return err
+}
+
+// GetDigestItems returns the events waiting for the user's next digest, in no particular order
+func (r *RedisClient) GetDigestItems(ctx context.Context, userID int) ([]notification.DigestItem, error) {
+	values, err := r.client.HGetAll(ctx, digestItemsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]notification.DigestItem, 0, len(values))
+	for _, data := range values {
+		var item notification.DigestItem
+		if err := json.Unmarshal([]byte(data), &item); err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// RemoveDigestItems takes events out of the user's next digest, e.g. once they were read
+func (r *RedisClient) RemoveDigestItems(ctx context.Context, userID int, notificationIDs ...string) error {
+	if len(notificationIDs) == 0 {
+		return nil
+	}
+	return r.client.HDel(ctx, digestItemsKey(userID), notificationIDs...).Err()
+}
+
+// ScheduleDigest sets when the user's next digest goes out
+func (r *RedisClient) ScheduleDigest(ctx context.Context, userID int, at time.Time) error {
+	return r.client.ZAdd(ctx, dueDigests, redis.Z{Score: dueScore(at), Member: userID}).Err()
+}
+
+// UnscheduleDigest stops the user's digests and drops the events waiting for the next one
+func (r *RedisClient) UnscheduleDigest(ctx context.Context, userID int) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, dueDigests, userID)
+		pipe.Del(ctx, digestItemsKey(userID))
+		return nil
+	})
+	return err
+}
+
+// ClaimDueDigests returns the users whose digest is due now and leases them like
+// ClaimDueDeliveries does
+func (r *RedisClient) ClaimDueDigests(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]int, error) {
+	members, err := claimDue.Run(ctx, r.client, []string{dueDigests},
+		strconv.FormatInt(now.UnixMilli(), 10),
+		strconv.FormatInt(now.Add(lease).UnixMilli(), 10),
+		limit,
+	).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	userIDs := make([]int, 0, len(members))
+	for _, member := range members {
+		userID, err := strconv.Atoi(member)
+		if err != nil {
+			continue
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, nil
+}
+
+// MarkDigestSent records that the user's digest of the given time is being sent. It reports
+// false when it already was, then the digest must not be sent again.
+func (r *RedisClient) MarkDigestSent(ctx context.Context, userID int, at time.Time) (bool, error) {
+	return r.client.SetNX(ctx, digestSentKey(userID, at), time.Now().Unix(), digestSentTTL).Result()
+}
+
+// UnmarkDigestSent forgets a digest that could not be sent, so it can be tried again
+func (r *RedisClient) UnmarkDigestSent(ctx context.Context, userID int, at time.Time) error {
+	return r.client.Del(ctx, digestSentKey(userID, at)).Err()
+}
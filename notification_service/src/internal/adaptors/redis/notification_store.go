@@ -0,0 +1,433 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"notificationservice/src/internal/core/notification"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Notifications are stored as JSON under notification:<id> and indexed in sorted sets scored by
+// their timestamp: one per recipient, one with only the recipient's unread entries and one across
+// all users. Every read is a range query on an index. The indexes are trimmed to the notification
+// lifetime on each write and dangling ids are dropped when a read finds them.
+
+// NotificationTTL is how long a notification is kept when no retention is set
+const NotificationTTL = 24 * time.Hour
+
+const allNotificationsIndex = "notifications:all"
+
+// expiringNotifications holds the ids of notifications to archive, scored by when their
+// retention runs out. It is only kept while archiving is on.
+const expiringNotifications = "notifications:expiring"
+
+// InboxUpdatesChannel carries every newly stored notification as JSON, so each replica can push
+// it to the recipient's open streams
+const InboxUpdatesChannel = "inbox_updates"
+
+// ErrInvalidCursor is returned for a cursor that was not handed out by a list call
+var ErrInvalidCursor = errors.New("Invalid Cursor")
+
+func notificationKey(id string) string {
+	return "notification:" + id
+}
+
+func userIndexKey(userID int) string {
+	return fmt.Sprintf("notifications:user:%d", userID)
+}
+
+func unreadIndexKey(userID int) string {
+	return fmt.Sprintf("notifications:user:%d:unread", userID)
+}
+
+// scores are unix microseconds, exact in a float64
+func timestampScore(timestamp time.Time) float64 {
+	return float64(timestamp.UnixMicro())
+}
+
+// keepFor is how long the notifications of an event type stay in Redis
+func (r *RedisClient) keepFor(action string) time.Duration {
+	return r.retention.For(action) + r.archiveGrace
+}
+
+// expiredBound is the score below which no index entry can point to a stored notification
+func (r *RedisClient) expiredBound() string {
+	return "(" + strconv.FormatInt(time.Now().Add(-r.retention.Max()-r.archiveGrace).UnixMicro(), 10)
+}
+
+// StoreNotification saves a new, unread notification and indexes it for its recipient. A notification
+// that is already stored is left alone, so its read state survives a redelivered event.
+func (r *RedisClient) StoreNotification(ctx context.Context, notif notification.Notification) error {
+	exists, err := r.client.Exists(ctx, notificationKey(notif.ID)).Result()
+	if err != nil || exists > 0 {
+		return err
+	}
+	return r.writeNotification(ctx, notif)
+}
+
+// ReplaceNotification overwrites a notification, e.g. with updates merged into it. It moves to
+// the top of the inbox as unread and is pushed to open streams again.
+func (r *RedisClient) ReplaceNotification(ctx context.Context, notif notification.Notification) error {
+	return r.writeNotification(ctx, notif)
+}
+
+func (r *RedisClient) writeNotification(ctx context.Context, notif notification.Notification) error {
+	data, err := json.Marshal(notif)
+	if err != nil {
+		return err
+	}
+
+	member := redis.Z{Score: timestampScore(notif.Timestamp), Member: notif.ID}
+	userIndex, unreadIndex := userIndexKey(notif.UserID), unreadIndexKey(notif.UserID)
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, notificationKey(notif.ID), data, r.keepFor(notif.Action))
+		for _, index := range []string{userIndex, unreadIndex, allNotificationsIndex} {
+			pipe.ZAdd(ctx, index, member)
+			pipe.ZRemRangeByScore(ctx, index, "-inf", r.expiredBound())
+		}
+		// the user indexes go away together with the last notification they point to
+		pipe.Expire(ctx, userIndex, r.retention.Max()+r.archiveGrace)
+		pipe.Expire(ctx, unreadIndex, r.retention.Max()+r.archiveGrace)
+		if r.archiveGrace > 0 {
+			expires := notif.Timestamp.Add(r.retention.For(notif.Action))
+			pipe.ZAdd(ctx, expiringNotifications, redis.Z{Score: dueScore(expires), Member: notif.ID})
+		}
+		pipe.Publish(ctx, InboxUpdatesChannel, data)
+		return nil
+	})
+	return err
+}
+
+func (r *RedisClient) GetNotification(ctx context.Context, id string) (notification.Notification, error) {
+	var notif notification.Notification
+	data, err := r.client.Get(ctx, notificationKey(id)).Bytes()
+	if err != nil {
+		return notif, err
+	}
+	err = json.Unmarshal(data, &notif)
+	return notif, err
+}
+
+// ListUserNotifications pages through the inbox of the user
+func (r *RedisClient) ListUserNotifications(ctx context.Context, userID int, cursor string, limit int) (notification.Page, error) {
+	return r.listIndex(ctx, userIndexKey(userID), cursor, limit)
+}
+
+// ListUnreadNotifications pages through the unread part of the user's inbox
+func (r *RedisClient) ListUnreadNotifications(ctx context.Context, userID int, cursor string, limit int) (notification.Page, error) {
+	return r.listIndex(ctx, unreadIndexKey(userID), cursor, limit)
+}
+
+// ListAllNotifications pages through the notifications of every user
+func (r *RedisClient) ListAllNotifications(ctx context.Context, cursor string, limit int) (notification.Page, error) {
+	return r.listIndex(ctx, allNotificationsIndex, cursor, limit)
+}
+
+// StreamPosition identifies where the notification sits in its recipient's inbox, positions of
+// one inbox sort in the order notifications were stored
+func StreamPosition(notif notification.Notification) string {
+	return fmt.Sprintf("%d:%s", notif.Timestamp.UnixMicro(), notif.ID)
+}
+
+// ListUserNotificationsAfter returns up to limit notifications of the user stored after the
+// position, oldest first
+func (r *RedisClient) ListUserNotificationsAfter(ctx context.Context, userID int, position string, limit int) ([]notification.Notification, error) {
+	scorePart, afterID, ok := strings.Cut(position, ":")
+	score, err := strconv.ParseInt(scorePart, 10, 64)
+	if !ok || err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	// entries sharing the score sort by id, those up to afterID were already seen
+	entries, err := r.client.ZRangeArgsWithScores(ctx, redis.ZRangeArgs{
+		Key:     userIndexKey(userID),
+		Start:   score,
+		Stop:    "+inf",
+		ByScore: true,
+		Count:   int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		id := entry.Member.(string)
+		if int64(entry.Score) == score && id <= afterID {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return r.getNotifications(ctx, ids)
+}
+
+// CountUnread returns the number of unread notifications of the user
+func (r *RedisClient) CountUnread(ctx context.Context, userID int) (int64, error) {
+	var card *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, unreadIndexKey(userID), "-inf", r.expiredBound())
+		card = pipe.ZCard(ctx, unreadIndexKey(userID))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return card.Val(), nil
+}
+
+// UnreadNotificationIDs returns the ids of every unread notification of the user
+func (r *RedisClient) UnreadNotificationIDs(ctx context.Context, userID int) ([]string, error) {
+	return r.client.ZRange(ctx, unreadIndexKey(userID), 0, -1).Result()
+}
+
+// MarkNotificationsRead marks the given notifications of the user as read and takes them out of
+// the unread index. Ids of other users are skipped, expired ones are only taken out of the index.
+func (r *RedisClient) MarkNotificationsRead(ctx context.Context, userID int, ids []string, readAt time.Time) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	marked := 0
+	members := make([]interface{}, 0, len(ids))
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			notif, err := r.GetNotification(ctx, id)
+			if errors.Is(err, redis.Nil) {
+				members = append(members, id)
+				continue
+			} else if err != nil {
+				return err
+			}
+			if notif.UserID != userID {
+				continue
+			}
+			members = append(members, id)
+			if notif.Read {
+				continue
+			}
+
+			notif.Read = true
+			notif.ReadAt = &readAt
+			data, err := json.Marshal(notif)
+			if err != nil {
+				return err
+			}
+			pipe.SetArgs(ctx, notificationKey(id), data, redis.SetArgs{KeepTTL: true})
+			marked++
+		}
+		if len(members) > 0 {
+			pipe.ZRem(ctx, unreadIndexKey(userID), members...)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return marked, nil
+}
+
+// DeleteUserNotifications removes the inbox of the user and returns how many notifications it held
+func (r *RedisClient) DeleteUserNotifications(ctx context.Context, userID int) (int, error) {
+	ids, err := r.client.ZRange(ctx, userIndexKey(userID), 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(ids) > 0 {
+			keys := make([]string, len(ids))
+			members := make([]interface{}, len(ids))
+			for i, id := range ids {
+				keys[i] = notificationKey(id)
+				members[i] = id
+			}
+			pipe.Del(ctx, keys...)
+			pipe.ZRem(ctx, allNotificationsIndex, members...)
+		}
+		pipe.Del(ctx, userIndexKey(userID), unreadIndexKey(userID))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// getNotifications fetches the notifications in the given order, skipping expired and unreadable ones
+func (r *RedisClient) getNotifications(ctx context.Context, ids []string) ([]notification.Notification, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = notificationKey(id)
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var notifications []notification.Notification
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var notif notification.Notification
+		if err := json.Unmarshal([]byte(data), &notif); err != nil {
+			continue
+		}
+		notifications = append(notifications, notif)
+	}
+	return notifications, nil
+}
+
+// listIndex returns up to limit notifications of the index, newest first, starting at the cursor.
+// A cursor is the score of the last entry handed out and how many entries with that score were
+// handed out so far, so entries sharing a timestamp are neither repeated nor skipped.
+func (r *RedisClient) listIndex(ctx context.Context, index string, cursor string, limit int) (notification.Page, error) {
+	var page notification.Page
+	maxScore, skip, err := parseCursor(cursor)
+	if err != nil {
+		return page, err
+	}
+
+	stop := "+inf"
+	if cursor != "" {
+		stop = strconv.FormatInt(maxScore, 10)
+	}
+	entries, err := r.client.ZRangeArgsWithScores(ctx, redis.ZRangeArgs{
+		Key:     index,
+		Start:   "-inf",
+		Stop:    stop,
+		ByScore: true,
+		Rev:     true,
+		Offset:  skip,
+		Count:   int64(limit),
+	}).Result()
+	if err != nil || len(entries) == 0 {
+		return page, err
+	}
+
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		keys[i] = notificationKey(entry.Member.(string))
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return page, err
+	}
+
+	var dangling []interface{}
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			dangling = append(dangling, entries[i].Member)
+			continue
+		}
+		var notif notification.Notification
+		if err := json.Unmarshal([]byte(data), &notif); err != nil {
+			log.Printf("Skipping unreadable notification %v: %v", entries[i].Member, err)
+			continue
+		}
+		page.Notifications = append(page.Notifications, notif)
+	}
+	if len(dangling) > 0 {
+		if err := r.client.ZRem(ctx, index, dangling...).Err(); err != nil {
+			log.Printf("Failed to drop expired notifications from %s: %v", index, err)
+		}
+	}
+
+	if len(entries) == limit {
+		last := int64(entries[len(entries)-1].Score)
+		seen := int64(0)
+		for _, entry := range entries {
+			if int64(entry.Score) == last {
+				seen++
+			}
+		}
+		if cursor != "" && last == maxScore {
+			seen += skip
+		}
+		page.NextCursor = fmt.Sprintf("%d.%d", last, seen)
+	}
+	return page, nil
+}
+
+func parseCursor(cursor string) (int64, int64, error) {
+	if cursor == "" {
+		return 0, 0, nil
+	}
+	scorePart, skipPart, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return 0, 0, ErrInvalidCursor
+	}
+	score, err := strconv.ParseInt(scorePart, 10, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	skip, err := strconv.ParseInt(skipPart, 10, 64)
+	if err != nil || skip < 0 {
+		return 0, 0, ErrInvalidCursor
+	}
+	return score, skip, nil
+}
+
+// ClaimExpiredNotifications returns the notifications whose retention ran out and leases them
+// like ClaimDueDeliveries does. Ids of notifications that are gone are dropped.
+func (r *RedisClient) ClaimExpiredNotifications(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]notification.Notification, error) {
+	ids, err := claimDue.Run(ctx, r.client, []string{expiringNotifications},
+		strconv.FormatInt(now.UnixMilli(), 10),
+		strconv.FormatInt(now.Add(lease).UnixMilli(), 10),
+		limit,
+	).StringSlice()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	notifications, err := r.getNotifications(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool, len(notifications))
+	for _, notif := range notifications {
+		found[notif.ID] = true
+	}
+	var gone []interface{}
+	for _, id := range ids {
+		if !found[id] {
+			gone = append(gone, id)
+		}
+	}
+	if len(gone) > 0 {
+		if err := r.client.ZRem(ctx, expiringNotifications, gone...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	return notifications, nil
+}
+
+// RemoveNotifications deletes archived notifications from Redis and from every index
+func (r *RedisClient) RemoveNotifications(ctx context.Context, notifications []notification.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, notif := range notifications {
+			pipe.Del(ctx, notificationKey(notif.ID))
+			pipe.ZRem(ctx, userIndexKey(notif.UserID), notif.ID)
+			pipe.ZRem(ctx, unreadIndexKey(notif.UserID), notif.ID)
+			pipe.ZRem(ctx, allNotificationsIndex, notif.ID)
+			pipe.ZRem(ctx, expiringNotifications, notif.ID)
+		}
+		return nil
+	})
+	return err
+}
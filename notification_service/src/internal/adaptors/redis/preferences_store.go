@@ -0,0 +1,58 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"notificationservice/src/internal/core/notification"
+)
+
+// Preferences are stored as JSON under preferences:<user id> and kept until the account is deleted
+
+func preferencesKey(userID int) string {
+	return fmt.Sprintf("preferences:%d", userID)
+}
+
+func (r *RedisClient) SavePreferences(ctx context.Context, prefs notification.Preferences) error {
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, preferencesKey(prefs.UserID), data, 0).Err()
+}
+
+// GetPreferences returns the preferences of every user in one round trip, users who never set
+// theirs get the defaults
+func (r *RedisClient) GetPreferences(ctx context.Context, userIDs []int) (map[int]notification.Preferences, error) {
+	prefs := make(map[int]notification.Preferences, len(userIDs))
+	if len(userIDs) == 0 {
+		return prefs, nil
+	}
+
+	keys := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		keys[i] = preferencesKey(userID)
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, userID := range userIDs {
+		prefs[userID] = notification.DefaultPreferences(userID)
+		data, ok := values[i].(string)
+		if !ok {
+			continue
+		}
+		var stored notification.Preferences
+		if err := json.Unmarshal([]byte(data), &stored); err != nil {
+			return nil, fmt.Errorf("corrupt preferences of user %d: %v", userID, err)
+		}
+		prefs[userID] = stored
+	}
+	return prefs, nil
+}
+
+func (r *RedisClient) DeletePreferences(ctx context.Context, userID int) error {
+	return r.client.Del(ctx, preferencesKey(userID)).Err()
+}
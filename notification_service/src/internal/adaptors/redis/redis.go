@@ -4,13 +4,18 @@ import (
 	"context"
 	"fmt"
 	"notificationservice/src/internal/config"
+	"notificationservice/src/internal/core/notification"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 type RedisClient struct {
-	client *redis.Client
+	client    *redis.Client
+	retention notification.Retention
+	// archiveGrace keeps notifications past their retention until the archiver took them, zero
+	// when nothing is archived
+	archiveGrace time.Duration
 }
 
 func NewRedisClient() (*RedisClient, error) {
@@ -32,7 +37,17 @@ func NewRedisClient() (*RedisClient, error) {
 		return nil, fmt.Errorf("failed to connect to Redis: %v", err)
 	}
 
-	return &RedisClient{client: rdb}, nil
+	return &RedisClient{
+		client:    rdb,
+		retention: notification.Retention{Default: NotificationTTL},
+	}, nil
+}
+
+// SetRetention sets how long notifications are kept per event type. With archiveGrace they stay
+// that much longer in Redis and wait for ClaimExpiredNotifications to hand them to the archive.
+func (r *RedisClient) SetRetention(retention notification.Retention, archiveGrace time.Duration) {
+	r.retention = retention
+	r.archiveGrace = archiveGrace
 }
 
 func (r *RedisClient) GetClient() *redis.Client {
@@ -43,36 +58,6 @@ func (r *RedisClient) Close() error {
 	return r.client.Close()
 }
 
-// Simple notification functions
-func (r *RedisClient) StoreNotification(ctx context.Context, key string, data []byte) error {
-	return r.client.Set(ctx, key, data, 24*time.Hour).Err()
-}
-
-func (r *RedisClient) GetNotification(ctx context.Context, key string) ([]byte, error) {
-	return r.client.Get(ctx, key).Bytes()
-}
-
-func (r *RedisClient) GetAllNotificationKeys(ctx context.Context) ([]string, error) {
-	var allKeys []string
-	cursor := uint64(0)
-
-	for {
-		keys, newCursor, err := r.client.Scan(ctx, cursor, "notification:*", 100).Result()
-		if err != nil {
-			return nil, err
-		}
-
-		allKeys = append(allKeys, keys...)
-		cursor = newCursor
-
-		if cursor == 0 {
-			break
-		}
-	}
-
-	return allKeys, nil
-}
-
-func (r *RedisClient) Subscribe(ctx context.Context, channel string) *redis.PubSub {
-	return r.client.Subscribe(ctx, channel)
+func (r *RedisClient) Subscribe(ctx context.Context, channels ...string) *redis.PubSub {
+	return r.client.Subscribe(ctx, channels...)
 }
@@ -0,0 +1,111 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// StreamMessage is a stream entry taken over from another consumer, with how often the group delivered it
+type StreamMessage struct {
+	redis.XMessage
+	Deliveries int64
+}
+
+// EnsureConsumerGroup creates the group reading the stream from its start, creating the stream when
+// nothing was appended yet. An existing group is left as it is.
+func (r *RedisClient) EnsureConsumerGroup(ctx context.Context, stream string, group string) error {
+	err := r.client.XGroupCreateMkStream(ctx, stream, group, "0").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// ReadStreamGroup returns up to count entries never delivered to the group, waiting up to block for
+// them. It returns redis.Nil when nothing arrived in time.
+func (r *RedisClient) ReadStreamGroup(ctx context.Context, stream string, group string, consumer string, count int64, block time.Duration) ([]redis.XMessage, error) {
+	streams, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{stream, ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []redis.XMessage
+	for _, s := range streams {
+		messages = append(messages, s.Messages...)
+	}
+	return messages, nil
+}
+
+func (r *RedisClient) AckStream(ctx context.Context, stream string, group string, ids ...string) error {
+	return r.client.XAck(ctx, stream, group, ids...).Err()
+}
+
+// ClaimIdleMessages takes over up to count entries that were delivered to a consumer of the group
+// but not acknowledged for at least minIdle, usually because that consumer crashed
+func (r *RedisClient) ClaimIdleMessages(ctx context.Context, stream string, group string, consumer string, minIdle time.Duration, count int64) ([]StreamMessage, error) {
+	pending, err := r.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  group,
+		Idle:   minIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  count,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return nil, err
+	}
+
+	ids := make([]string, len(pending))
+	deliveries := make(map[string]int64, len(pending))
+	for i, entry := range pending {
+		ids[i] = entry.ID
+		// claiming counts as one more delivery
+		deliveries[entry.ID] = entry.RetryCount + 1
+	}
+
+	claimed, err := r.client.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   stream,
+		Group:    group,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]StreamMessage, len(claimed))
+	for i, message := range claimed {
+		messages[i] = StreamMessage{XMessage: message, Deliveries: deliveries[message.ID]}
+	}
+	return messages, nil
+}
+
+// DeadLetter moves an entry the group gave up on to the dead-letter stream, with the reason, and
+// acknowledges it so it is not delivered again
+func (r *RedisClient) DeadLetter(ctx context.Context, stream string, group string, deadLetterStream string, message redis.XMessage, reason string) error {
+	values := make(map[string]interface{}, len(message.Values)+4)
+	for field, value := range message.Values {
+		values[field] = value
+	}
+	values["source_stream"] = stream
+	values["source_id"] = message.ID
+	values["reason"] = reason
+	values["failed_at"] = time.Now().Format(time.RFC3339)
+
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: deadLetterStream, Values: values})
+		pipe.XAck(ctx, stream, group, message.ID)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,233 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"notificationservice/src/internal/core/webhook"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Webhooks are stored as JSON under webhook:<id> and listed through the sets webhooks:all and
+// webhooks:user:<owner>. Deliveries are JSON under webhook_delivery:<id>, the newest of each
+// webhook are indexed in webhook_deliveries:<webhook id>, and the pending ones wait in the
+// webhook_deliveries:due sorted set scored by when they are next attempted.
+
+// DeliveryTTL is how long the log of a delivery is kept
+const DeliveryTTL = 7 * 24 * time.Hour
+
+// deliveriesPerWebhook caps the delivery log of a webhook
+const deliveriesPerWebhook = 500
+
+const (
+	allWebhooksKey = "webhooks:all"
+	dueDeliveries  = "webhook_deliveries:due"
+)
+
+func webhookKey(id string) string {
+	return "webhook:" + id
+}
+
+func userWebhooksKey(userID int) string {
+	return fmt.Sprintf("webhooks:user:%d", userID)
+}
+
+func webhookFailuresKey(id string) string {
+	return "webhook:" + id + ":failures"
+}
+
+func deliveryKey(id string) string {
+	return "webhook_delivery:" + id
+}
+
+func webhookDeliveriesKey(webhookID string) string {
+	return "webhook_deliveries:" + webhookID
+}
+
+// SaveWebhook creates or replaces a webhook
+func (r *RedisClient) SaveWebhook(ctx context.Context, hook webhook.Webhook) error {
+	data, err := json.Marshal(hook)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, webhookKey(hook.ID), data, 0)
+		pipe.SAdd(ctx, allWebhooksKey, hook.ID)
+		pipe.SAdd(ctx, userWebhooksKey(hook.OwnerID), hook.ID)
+		return nil
+	})
+	return err
+}
+
+// GetWebhook returns redis.Nil when the webhook does not exist
+func (r *RedisClient) GetWebhook(ctx context.Context, id string) (webhook.Webhook, error) {
+	data, err := r.client.Get(ctx, webhookKey(id)).Bytes()
+	if err != nil {
+		return webhook.Webhook{}, err
+	}
+	var hook webhook.Webhook
+	err = json.Unmarshal(data, &hook)
+	return hook, err
+}
+
+// ListWebhooks returns every webhook, they are few enough to be filtered in memory
+func (r *RedisClient) ListWebhooks(ctx context.Context) ([]webhook.Webhook, error) {
+	return r.listWebhooks(ctx, allWebhooksKey)
+}
+
+func (r *RedisClient) ListUserWebhooks(ctx context.Context, userID int) ([]webhook.Webhook, error) {
+	return r.listWebhooks(ctx, userWebhooksKey(userID))
+}
+
+func (r *RedisClient) listWebhooks(ctx context.Context, index string) ([]webhook.Webhook, error) {
+	ids, err := r.client.SMembers(ctx, index).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = webhookKey(id)
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	hooks := make([]webhook.Webhook, 0, len(values))
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var hook webhook.Webhook
+		if err := json.Unmarshal([]byte(data), &hook); err != nil {
+			continue
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// DeleteWebhook removes the webhook and its delivery index, the deliveries expire on their own
+func (r *RedisClient) DeleteWebhook(ctx context.Context, hook webhook.Webhook) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, webhookKey(hook.ID), webhookFailuresKey(hook.ID), webhookDeliveriesKey(hook.ID))
+		pipe.SRem(ctx, allWebhooksKey, hook.ID)
+		pipe.SRem(ctx, userWebhooksKey(hook.OwnerID), hook.ID)
+		return nil
+	})
+	return err
+}
+
+// RecordWebhookFailure counts a failed attempt and returns the failures since the last success
+func (r *RedisClient) RecordWebhookFailure(ctx context.Context, id string) (int64, error) {
+	return r.client.Incr(ctx, webhookFailuresKey(id)).Result()
+}
+
+func (r *RedisClient) ResetWebhookFailures(ctx context.Context, id string) error {
+	return r.client.Del(ctx, webhookFailuresKey(id)).Err()
+}
+
+// CreateDelivery stores a new delivery and schedules it for its NextAttemptAt. It reports false
+// and changes nothing when a delivery with the id exists, so a redelivered event is sent once.
+func (r *RedisClient) CreateDelivery(ctx context.Context, delivery webhook.Delivery) (bool, error) {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return false, err
+	}
+	created, err := r.client.SetNX(ctx, deliveryKey(delivery.ID), data, DeliveryTTL).Result()
+	if err != nil || !created {
+		return false, err
+	}
+
+	index := webhookDeliveriesKey(delivery.WebhookID)
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, index, redis.Z{Score: timestampScore(delivery.CreatedAt), Member: delivery.ID})
+		pipe.ZRemRangeByRank(ctx, index, 0, -deliveriesPerWebhook-1)
+		if delivery.NextAttemptAt != nil {
+			pipe.ZAdd(ctx, dueDeliveries, redis.Z{Score: dueScore(*delivery.NextAttemptAt), Member: delivery.ID})
+		}
+		return nil
+	})
+	return true, err
+}
+
+// SaveDelivery updates a delivery and schedules its next attempt, or takes it off the schedule
+// when it is no longer pending
+func (r *RedisClient) SaveDelivery(ctx context.Context, delivery webhook.Delivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetArgs(ctx, deliveryKey(delivery.ID), data, redis.SetArgs{KeepTTL: true})
+		if delivery.Status == webhook.DeliveryPending && delivery.NextAttemptAt != nil {
+			pipe.ZAdd(ctx, dueDeliveries, redis.Z{Score: dueScore(*delivery.NextAttemptAt), Member: delivery.ID})
+		} else {
+			pipe.ZRem(ctx, dueDeliveries, delivery.ID)
+		}
+		return nil
+	})
+	return err
+}
+
+// UnscheduleDelivery takes a delivery off the schedule without touching it
+func (r *RedisClient) UnscheduleDelivery(ctx context.Context, id string) error {
+	return r.client.ZRem(ctx, dueDeliveries, id).Err()
+}
+
+// GetDelivery returns redis.Nil when the delivery does not exist or expired
+func (r *RedisClient) GetDelivery(ctx context.Context, id string) (webhook.Delivery, error) {
+	data, err := r.client.Get(ctx, deliveryKey(id)).Bytes()
+	if err != nil {
+		return webhook.Delivery{}, err
+	}
+	var delivery webhook.Delivery
+	err = json.Unmarshal(data, &delivery)
+	return delivery, err
+}
+
+// ListDeliveries returns the newest deliveries of the webhook, newest first
+func (r *RedisClient) ListDeliveries(ctx context.Context, webhookID string, limit int) ([]webhook.Delivery, error) {
+	ids, err := r.client.ZRevRange(ctx, webhookDeliveriesKey(webhookID), 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]webhook.Delivery, 0, len(ids))
+	for _, id := range ids {
+		delivery, err := r.GetDelivery(ctx, id)
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// claimDue moves up to ARGV[3] deliveries due by ARGV[1] to ARGV[2] and returns their ids
+var claimDue = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, id in ipairs(ids) do
+	redis.call('ZADD', KEYS[1], ARGV[2], id)
+end
+return ids`)
+
+// ClaimDueDeliveries returns the ids of deliveries due now and leases them for lease: other
+// replicas skip them meanwhile, and they come due again if this one dies before saving them
+func (r *RedisClient) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]string, error) {
+	return claimDue.Run(ctx, r.client, []string{dueDeliveries},
+		strconv.FormatInt(now.UnixMilli(), 10),
+		strconv.FormatInt(now.Add(lease).UnixMilli(), 10),
+		limit,
+	).StringSlice()
+}
+
+func dueScore(at time.Time) float64 {
+	return float64(at.UnixMilli())
+}
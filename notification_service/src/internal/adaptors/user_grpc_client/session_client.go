@@ -0,0 +1,16 @@
+package client
+
+import (
+	pb "notificationservice/src/internal/interfaces/grpc/generated/generated"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func NewSessionValidatorClient(addr string) (pb.SessionValidatorClient, error) {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	return pb.NewSessionValidatorClient(conn), nil
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"log"
+	"notificationservice/src/internal/core/user"
+	pb "notificationservice/src/internal/interfaces/grpc/generated/generated"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// lookupTimeout bounds one BatchGetUsers call, a slow user_service must not stall event processing
+	lookupTimeout = 2 * time.Second
+	// expired entries are pruned once the cache grows past this size
+	userCachePruneSize = 10000
+	// maxBatchGetUsers is the most ids user_service accepts in one BatchGetUsers call
+	maxBatchGetUsers = 500
+)
+
+type cachedUser struct {
+	info      user.UserInfo
+	expiresAt time.Time
+}
+
+// UserDirectory resolves user ids to their addresses through user_service, caching entries for
+// ttl so an event costs at most one BatchGetUsers call however many users it reaches
+type UserDirectory struct {
+	grpcClient pb.SessionValidatorClient
+	ttl        time.Duration
+
+	mu    sync.Mutex
+	users map[int]cachedUser
+}
+
+func NewUserDirectory(grpcClient pb.SessionValidatorClient, ttl time.Duration) *UserDirectory {
+	return &UserDirectory{
+		grpcClient: grpcClient,
+		ttl:        ttl,
+		users:      map[int]cachedUser{},
+	}
+}
+
+// Lookup returns the users among ids that could be resolved. When user_service is unreachable
+// only the cached entries are returned, the others are not reached this time.
+func (d *UserDirectory) Lookup(ctx context.Context, ids []int) map[int]user.UserInfo {
+	found := make(map[int]user.UserInfo, len(ids))
+	seen := make(map[int]bool, len(ids))
+	var missing []string
+	now := time.Now()
+
+	d.mu.Lock()
+	for _, id := range ids {
+		if seen[id] || id == 0 {
+			continue
+		}
+		seen[id] = true
+		if cached, ok := d.users[id]; ok && now.Before(cached.expiresAt) {
+			found[id] = cached.info
+			continue
+		}
+		missing = append(missing, strconv.Itoa(id))
+	}
+	d.mu.Unlock()
+
+	if len(missing) == 0 {
+		return found
+	}
+
+	// the batches share the timeout, a failed one leaves its ids unresolved and the rest go on
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+	var entries []*pb.UserInfo
+	for start := 0; start < len(missing); start += maxBatchGetUsers {
+		batch := missing[start:min(start+maxBatchGetUsers, len(missing))]
+		resp, err := d.grpcClient.BatchGetUsers(ctx, &pb.BatchGetUsersRequest{UserIds: batch})
+		if err != nil {
+			log.Printf("Error looking up users: %v", err)
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		entries = append(entries, resp.GetUsers()...)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.users) > userCachePruneSize {
+		for id, cached := range d.users {
+			if now.After(cached.expiresAt) {
+				delete(d.users, id)
+			}
+		}
+	}
+	for _, entry := range entries {
+		id, err := strconv.Atoi(entry.GetUserId())
+		if err != nil {
+			continue
+		}
+		info := user.UserInfo{
+			Id:          id,
+			Username:    entry.GetUsername(),
+			DisplayName: entry.GetDisplayName(),
+			Email:       entry.GetEmail(),
+			Active:      entry.GetActive(),
+			Roles:       entry.GetRoles(),
+		}
+		d.users[id] = cachedUser{info: info, expiresAt: now.Add(d.ttl)}
+		found[id] = info
+	}
+	return found
+}
@@ -13,6 +13,49 @@ type Config struct {
 	REDIS_PASSWORD string `mapstructure:"REDIS_PASSWORD"`
 	APP_PORT       string `mapstructure:"APP_PORT"`
 	APP_ENV        string `mapstructure:"APP_ENV"`
+	// user_service gRPC port, used to validate sessions
+	GRPC_PORT string `mapstructure:"GRPC_PORT"`
+	// consumer group reading the task and user event streams, shared by all replicas
+	TASK_EVENTS_GROUP string `mapstructure:"TASK_EVENTS_GROUP"`
+	// name of this replica in the group, defaults to host name and pid
+	TASK_EVENTS_CONSUMER string `mapstructure:"TASK_EVENTS_CONSUMER"`
+	// how long an event may stay unacknowledged before it is retried, e.g. "1m"
+	TASK_EVENTS_RECLAIM_IDLE string `mapstructure:"TASK_EVENTS_RECLAIM_IDLE"`
+	// deliveries before an event goes to the dead-letter stream
+	TASK_EVENTS_MAX_DELIVERIES int64 `mapstructure:"TASK_EVENTS_MAX_DELIVERIES"`
+	// how often an idle notification stream sends a heartbeat, e.g. "25s"
+	STREAM_HEARTBEAT_INTERVAL string `mapstructure:"STREAM_HEARTBEAT_INTERVAL"`
+	// SMTP server notifications are emailed through, email is off when SMTP_HOST is empty.
+	// A local stub such as MailHog needs no username.
+	SMTP_HOST     string `mapstructure:"SMTP_HOST"`
+	SMTP_PORT     string `mapstructure:"SMTP_PORT"`
+	SMTP_USERNAME string `mapstructure:"SMTP_USERNAME"`
+	SMTP_PASSWORD string `mapstructure:"SMTP_PASSWORD"`
+	// sender of notification emails, e.g. "Tasks <noreply@example.com>"
+	EMAIL_FROM string `mapstructure:"EMAIL_FROM"`
+	// how long recipient addresses looked up from user_service are cached, e.g. "5m"
+	USER_CACHE_TTL string `mapstructure:"USER_CACHE_TTL"`
+	// updates of a task by the same user within this window are merged into one notification,
+	// e.g. "30s", "0" turns merging off
+	NOTIFICATION_COALESCE_WINDOW string `mapstructure:"NOTIFICATION_COALESCE_WINDOW"`
+	// how long notifications stay in the inbox, e.g. "24h", and overrides per event type, e.g.
+	// "account_locked=720h,task_deleted=72h"
+	NOTIFICATION_RETENTION         string `mapstructure:"NOTIFICATION_RETENTION"`
+	NOTIFICATION_RETENTION_BY_TYPE string `mapstructure:"NOTIFICATION_RETENTION_BY_TYPE"`
+	// where notifications go once their retention ran out: "postgres" (ARCHIVE_DATABASE_URL),
+	// "ndjson" (gzip files in ARCHIVE_DIR, replicas sharing it need a volume with flock), or empty
+	// to drop them
+	ARCHIVE_BACKEND      string `mapstructure:"ARCHIVE_BACKEND"`
+	ARCHIVE_DATABASE_URL string `mapstructure:"ARCHIVE_DATABASE_URL"`
+	ARCHIVE_DIR          string `mapstructure:"ARCHIVE_DIR"`
+	// attempts of a webhook delivery before it is given up, and failed attempts in a row that
+	// disable a webhook
+	WEBHOOK_MAX_ATTEMPTS  int `mapstructure:"WEBHOOK_MAX_ATTEMPTS"`
+	WEBHOOK_DISABLE_AFTER int `mapstructure:"WEBHOOK_DISABLE_AFTER"`
+	// how long a webhook receiver may take to answer, e.g. "10s"
+	WEBHOOK_TIMEOUT string `mapstructure:"WEBHOOK_TIMEOUT"`
+	// let webhooks call loopback and private network addresses
+	WEBHOOK_ALLOW_PRIVATE bool `mapstructure:"WEBHOOK_ALLOW_PRIVATE"`
 }
 
 func LoadConfig() (*Config, error) {
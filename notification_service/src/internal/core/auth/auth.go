@@ -0,0 +1,18 @@
+package auth
+
+const RoleAdmin = "admin"
+
+// Claims describes the authenticated caller, the middleware puts it in the request context under "auth_claims"
+type Claims struct {
+	UserID int      `json:"user_id"`
+	Roles  []string `json:"roles,omitempty"`
+}
+
+func (c Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,19 @@
+package notification
+
+import (
+	"context"
+	"notificationservice/src/internal/core/user"
+)
+
+// Channel delivers notifications outside the in-app inbox, e.g. by email
+type Channel interface {
+	// Name identifies the channel in logs
+	Name() string
+	Send(ctx context.Context, recipient user.UserInfo, notif Notification) error
+}
+
+// DigestChannel is a Channel that can also send digests
+type DigestChannel interface {
+	Channel
+	SendDigest(ctx context.Context, recipient user.UserInfo, digest Digest) error
+}
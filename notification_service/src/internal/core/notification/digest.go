@@ -0,0 +1,225 @@
+package notification
+
+import (
+	"fmt"
+	"notificationservice/src/internal/core/task"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Digest frequencies
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// DigestSchedule replaces the emails of single task events with one summary per day or week
+type DigestSchedule struct {
+	Frequency string `json:"frequency"`
+	// Time is the "HH:MM" the digest goes out at
+	Time string `json:"time"`
+	// Weekday of weekly digests, e.g. "monday"
+	Weekday  string `json:"weekday,omitempty"`
+	Timezone string `json:"timezone"`
+}
+
+// Validate checks the schedule can be computed
+func (s DigestSchedule) Validate() error {
+	_, _, _, err := s.parse()
+	return err
+}
+
+// Location is the timezone of the schedule, UTC when it is invalid
+func (s DigestSchedule) Location() *time.Location {
+	_, loc, _, err := s.parse()
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Next returns the first digest time after at
+func (s DigestSchedule) Next(at time.Time) (time.Time, error) {
+	return s.find(at, 1)
+}
+
+// Previous returns the last digest time at or before at
+func (s DigestSchedule) Previous(at time.Time) (time.Time, error) {
+	return s.find(at, -1)
+}
+
+// find walks day by day from the day of at, a week and a day always hold a matching slot
+func (s DigestSchedule) find(at time.Time, step int) (time.Time, error) {
+	minute, loc, weekday, err := s.parse()
+	if err != nil {
+		return time.Time{}, err
+	}
+	local := at.In(loc)
+	for days := 0; days <= 8; days++ {
+		day := local.AddDate(0, 0, step*days)
+		slot := time.Date(day.Year(), day.Month(), day.Day(), minute/60, minute%60, 0, 0, loc)
+		if s.Frequency == DigestWeekly && slot.Weekday() != weekday {
+			continue
+		}
+		if (step > 0 && slot.After(at)) || (step < 0 && !slot.After(at)) {
+			return slot, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("no digest time near %s", at)
+}
+
+func (s DigestSchedule) parse() (int, *time.Location, time.Weekday, error) {
+	if s.Frequency != DigestDaily && s.Frequency != DigestWeekly {
+		return 0, nil, 0, fmt.Errorf("frequency must be %q or %q", DigestDaily, DigestWeekly)
+	}
+	minute, err := minuteOfDay(s.Time)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+	weekday := time.Sunday
+	if s.Frequency == DigestWeekly {
+		found := false
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if strings.EqualFold(d.String(), s.Weekday) {
+				weekday, found = d, true
+			}
+		}
+		if !found {
+			return 0, nil, 0, fmt.Errorf("weekday %q is not a day of the week", s.Weekday)
+		}
+	}
+	return minute, loc, weekday, nil
+}
+
+// DigestItem is a task event waiting for its recipient's next digest, with the task as the event left it
+type DigestItem struct {
+	NotificationID string `json:"notification_id"`
+	TaskID         int    `json:"task_id"`
+	TaskName       string `json:"task_name"`
+	Action         string `json:"action"`
+	Message        string `json:"message"`
+	// Assigned is set when the event assigned the task to the recipient
+	Assigned  bool      `json:"assigned"`
+	Status    string    `json:"status,omitempty"`
+	Deadline  time.Time `json:"deadline,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Digest sums up the events of one period for one user, grouped by task
+type Digest struct {
+	UserID    int
+	Frequency string
+	Since     time.Time
+	Until     time.Time
+	// Tasks are ordered by their latest event, newest first
+	Tasks       []DigestTask
+	Assigned    int
+	DueTomorrow int
+	Overdue     int
+	Deleted     int
+}
+
+// DigestTask is one task of a digest with its events, newest last
+type DigestTask struct {
+	TaskID      int
+	TaskName    string
+	Status      string
+	Deadline    time.Time
+	Assigned    bool
+	DueTomorrow bool
+	Overdue     bool
+	Deleted     bool
+	Events      []DigestItem
+}
+
+// BuildDigest groups the items by task. Whether a task is due or overdue is judged at now in loc
+// from the latest state an event reported, changes that sent no event are not seen.
+func BuildDigest(userID int, schedule DigestSchedule, since time.Time, until time.Time, items []DigestItem, now time.Time) Digest {
+	loc := schedule.Location()
+	sort.Slice(items, func(i, j int) bool { return items[i].Timestamp.Before(items[j].Timestamp) })
+
+	byTask := make(map[int]*DigestTask)
+	var order []int
+	for _, item := range items {
+		t, ok := byTask[item.TaskID]
+		if !ok {
+			t = &DigestTask{TaskID: item.TaskID}
+			byTask[item.TaskID] = t
+			order = append(order, item.TaskID)
+		}
+		t.Events = append(t.Events, item)
+		t.TaskName = item.TaskName
+		t.Assigned = t.Assigned || item.Assigned
+		t.Deleted = item.Action == task.EventTaskDeleted
+		if item.Status != "" {
+			t.Status = item.Status
+		}
+		if !item.Deadline.IsZero() {
+			t.Deadline = item.Deadline
+		}
+	}
+
+	localNow := now.In(loc)
+	tomorrow := time.Date(localNow.Year(), localNow.Month(), localNow.Day()+1, 0, 0, 0, 0, loc)
+	dayAfter := tomorrow.AddDate(0, 0, 1)
+
+	digest := Digest{UserID: userID, Frequency: schedule.Frequency, Since: since, Until: until}
+	for _, taskID := range order {
+		t := byTask[taskID]
+		if !t.Deleted && t.Status != task.StatusCompleted && !t.Deadline.IsZero() {
+			t.Overdue = t.Deadline.Before(now)
+			t.DueTomorrow = !t.Deadline.Before(tomorrow) && t.Deadline.Before(dayAfter)
+		}
+		if t.Assigned && !t.Deleted {
+			digest.Assigned++
+		}
+		if t.DueTomorrow {
+			digest.DueTomorrow++
+		}
+		if t.Overdue {
+			digest.Overdue++
+		}
+		if t.Deleted {
+			digest.Deleted++
+		}
+		digest.Tasks = append(digest.Tasks, *t)
+	}
+	sort.SliceStable(digest.Tasks, func(i, j int) bool {
+		a, b := digest.Tasks[i].Events, digest.Tasks[j].Events
+		return a[len(a)-1].Timestamp.After(b[len(b)-1].Timestamp)
+	})
+	return digest
+}
+
+// Summary is the digest in one line, e.g. "3 tasks assigned, 2 due tomorrow, 1 overdue"
+func (d Digest) Summary() string {
+	var parts []string
+	if d.Assigned > 0 {
+		parts = append(parts, countTasks(d.Assigned, "assigned"))
+	}
+	if d.DueTomorrow > 0 {
+		parts = append(parts, fmt.Sprintf("%d due tomorrow", d.DueTomorrow))
+	}
+	if d.Overdue > 0 {
+		parts = append(parts, fmt.Sprintf("%d overdue", d.Overdue))
+	}
+	if d.Deleted > 0 {
+		parts = append(parts, fmt.Sprintf("%d deleted", d.Deleted))
+	}
+	if len(parts) == 0 {
+		return countTasks(len(d.Tasks), "updated")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func countTasks(n int, what string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 task %s", what)
+	}
+	return fmt.Sprintf("%d tasks %s", n, what)
+}
@@ -1,14 +1,43 @@
 package notification
 
-import "time"
+import (
+	"notificationservice/src/internal/core/task"
+	"time"
+)
 
+// Notification is one inbox entry, every interested user gets their own copy of an event
 type Notification struct {
-	ID         string    `json:"id"`
-	TaskID     int       `json:"task_id"`
-	Action     string    `json:"action"`
-	TaskName   string    `json:"task_name"`
-	UserID     int       `json:"user_id"`     // User who receives the notification (assigned_to)
-	AssignedBy int       `json:"assigned_by"` // User who assigned the task (logged-in user)
-	Message    string    `json:"message"`
-	Timestamp  time.Time `json:"timestamp"`
+	ID         string     `json:"id"`
+	TaskID     int        `json:"task_id"`
+	Action     string     `json:"action"`
+	TaskName   string     `json:"task_name"`
+	UserID     int        `json:"user_id"`     // User who receives the notification
+	AssignedBy int        `json:"assigned_by"` // User who assigned the task
+	AssignedTo int        `json:"assigned_to"` // User the task is assigned to
+	ActorID    int        `json:"actor_id"`    // User whose change caused the notification
+	Message    string     `json:"message"`
+	Changes    []Change   `json:"changes,omitempty"`
+	Timestamp  time.Time  `json:"timestamp"`
+	Read       bool       `json:"read"`
+	ReadAt     *time.Time `json:"read_at,omitempty"`
+}
+
+// Change is one field of a task that an update changed, with its old and new value as shown to users
+type Change struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// Page is one slice of a notification feed, newest first. NextCursor is empty on the last page.
+type Page struct {
+	Notifications []Notification
+	NextCursor    string
+}
+
+// Burst is a task_updated notification that later updates of the same task by the same actor are
+// merged into, with the task as it was before the first of them
+type Burst struct {
+	Notification Notification       `json:"notification"`
+	Before       *task.TaskSnapshot `json:"before,omitempty"`
 }
@@ -0,0 +1,128 @@
+package notification
+
+import (
+	"fmt"
+	"time"
+)
+
+// Channels a user can turn on or off, ChannelEmail and ChannelWebhook match the Channel names
+const (
+	ChannelInApp   = "in_app"
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+// AllChannels is what a user without preferences receives
+var AllChannels = []string{ChannelInApp, ChannelEmail, ChannelWebhook}
+
+// Preferences decide which task events reach a user and how
+type Preferences struct {
+	UserID int `json:"user_id"`
+	// EventTypes the user wants, empty means every task event
+	EventTypes []string `json:"event_types"`
+	Channels   []string `json:"channels"`
+	// QuietHours hold back emails until they end, the inbox still gets everything right away.
+	// nil when not set.
+	QuietHours *QuietHours `json:"quiet_hours"`
+	// Digest, when set, sends task events by email as one summary per day or week instead of
+	// one email each. nil when not set.
+	Digest *DigestSchedule `json:"digest"`
+	// MutedTasks never notify the user
+	MutedTasks []int     `json:"muted_tasks"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// QuietHours is a daily window in the user's timezone, it wraps past midnight when End is before Start
+type QuietHours struct {
+	// Start and End are "HH:MM"
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone"`
+}
+
+// DefaultPreferences sends every event over every channel, at any time
+func DefaultPreferences(userID int) Preferences {
+	return Preferences{
+		UserID:     userID,
+		EventTypes: []string{},
+		Channels:   append([]string{}, AllChannels...),
+		MutedTasks: []int{},
+	}
+}
+
+// Wants tells whether the user wants events of the type about the task
+func (p Preferences) Wants(eventType string, taskID int) bool {
+	for _, muted := range p.MutedTasks {
+		if muted == taskID {
+			return false
+		}
+	}
+	if len(p.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range p.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Preferences) UsesChannel(channel string) bool {
+	for _, c := range p.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// QuietUntil tells whether at falls in the user's quiet hours and when they end
+func (p Preferences) QuietUntil(at time.Time) (time.Time, bool) {
+	if p.QuietHours == nil {
+		return time.Time{}, false
+	}
+	start, end, loc, err := p.QuietHours.Parse()
+	if err != nil {
+		return time.Time{}, false
+	}
+	local := at.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	quiet := minute >= start || minute < end
+	if start < end {
+		quiet = minute >= start && minute < end
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+	until := time.Date(local.Year(), local.Month(), local.Day(), end/60, end%60, 0, 0, loc)
+	if !until.After(at) {
+		until = time.Date(local.Year(), local.Month(), local.Day()+1, end/60, end%60, 0, 0, loc)
+	}
+	return until, true
+}
+
+// Parse returns the window as minutes after midnight in its timezone
+func (q QuietHours) Parse() (int, int, *time.Location, error) {
+	start, err := minuteOfDay(q.Start)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	end, err := minuteOfDay(q.End)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	loc, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("unknown timezone %q", q.Timezone)
+	}
+	return start, end, loc, nil
+}
+
+func minuteOfDay(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("time %q is not HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
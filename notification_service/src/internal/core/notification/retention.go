@@ -0,0 +1,52 @@
+package notification
+
+import (
+	"context"
+	"time"
+)
+
+// Retention is how long notifications stay in the inbox, per event type
+type Retention struct {
+	Default time.Duration
+	// ByType overrides Default for single event types, e.g. longer for security events
+	ByType map[string]time.Duration
+}
+
+// For returns how long notifications of the event type are kept
+func (r Retention) For(action string) time.Duration {
+	if ttl, ok := r.ByType[action]; ok {
+		return ttl
+	}
+	return r.Default
+}
+
+// Max returns the longest retention of any event type
+func (r Retention) Max() time.Duration {
+	longest := r.Default
+	for _, ttl := range r.ByType {
+		if ttl > longest {
+			longest = ttl
+		}
+	}
+	return longest
+}
+
+// Archive keeps notifications after their retention ran out, so the history stays searchable
+type Archive interface {
+	// Save stores the notifications, saving one that is already archived again changes nothing
+	Save(ctx context.Context, notifications []Notification) error
+	// Search returns the archived notifications matching the query, newest first
+	Search(ctx context.Context, query ArchiveQuery) ([]Notification, error)
+	// DeleteUser removes every archived notification of the user
+	DeleteUser(ctx context.Context, userID int) error
+	Close() error
+}
+
+// ArchiveQuery selects archived notifications by the time they were sent
+type ArchiveQuery struct {
+	// UserID limits the search to one recipient, zero searches every user
+	UserID int
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
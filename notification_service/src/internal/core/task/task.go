@@ -1,7 +1,28 @@
 package task
 
-import "time"
+import (
+	"events"
+	"time"
+)
 
+// TaskEventsStream is the Redis stream task_service appends task events to, events that keep failing
+// are moved to TaskEventsDeadLetterStream
+const (
+	TaskEventsStream           = events.TaskEventsStream
+	TaskEventsDeadLetterStream = "task_events:dead"
+)
+
+// Task event types, their payload is the TaskChanged message of the shared events.proto
+const (
+	EventTaskCreated = events.EventTaskCreated
+	EventTaskUpdated = events.EventTaskUpdated
+	EventTaskDeleted = events.EventTaskDeleted
+)
+
+// StatusCompleted is the status of a finished task, it is no longer due
+const StatusCompleted = "completed"
+
+// TaskEvent is a decoded task event, whatever version of the contract it arrived in
 type TaskEvent struct {
 	EventType  string    `json:"event_type"`
 	TaskID     int       `json:"task_id"`
@@ -9,4 +30,25 @@ type TaskEvent struct {
 	AssignedTo int       `json:"assigned_to"`
 	AssignedBy int       `json:"assigned_by"`
 	Timestamp  time.Time `json:"timestamp"`
+	// ActorID made the change, zero in events published before it existed, then AssignedBy is the actor
+	ActorID  int   `json:"actor_id"`
+	Watchers []int `json:"watchers,omitempty"`
+	// display names resolved by task_service, empty when it could not reach user_service
+	AssignedToName string `json:"assigned_to_name,omitempty"`
+	AssignedByName string `json:"assigned_by_name,omitempty"`
+	// the task before and after the change, nil when the event does not carry it
+	Before *TaskSnapshot `json:"-"`
+	After  *TaskSnapshot `json:"-"`
+}
+
+// TaskSnapshot is the state of a task at one point in time
+type TaskSnapshot struct {
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	Status         string    `json:"status"`
+	Priority       int       `json:"priority"`
+	Deadline       time.Time `json:"deadline"`
+	AssignedTo     int       `json:"assigned_to"`
+	AssignedBy     int       `json:"assigned_by"`
+	AssignedToName string    `json:"assigned_to_name,omitempty"`
 }
@@ -0,0 +1,43 @@
+package user
+
+import "time"
+
+// EventUserDeleted is published when an account is deleted
+const EventUserDeleted = "user_deleted"
+
+// UserEventsStream is where user_service appends account events, UserEventsDeadLetterStream
+// takes those that could not be processed
+const (
+	UserEventsStream           = "user_events"
+	UserEventsDeadLetterStream = "user_events:dead"
+)
+
+// UserEvent is a security or account event user_service appends to the user_events stream
+type UserEvent struct {
+	EventType string    `json:"event_type"`
+	UserID    int       `json:"user_id"`
+	IpAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserInfo is the user_service directory entry of a user, Email is where channels reach them
+type UserInfo struct {
+	Id          int
+	Username    string
+	DisplayName string
+	Email       string
+	// Active is false for blocked accounts, Roles are the user's roles when it was looked up
+	Active bool
+	Roles  []string
+}
+
+func (u UserInfo) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
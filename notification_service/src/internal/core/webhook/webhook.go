@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"encoding/json"
+	"notificationservice/src/internal/core/task"
+	"time"
+)
+
+// Delivery states, a pending delivery is retried until it succeeds or runs out of attempts
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is a URL that task events are POSTed to
+type Webhook struct {
+	ID      string `json:"id"`
+	OwnerID int    `json:"owner_id"`
+	URL     string `json:"url"`
+	// Secret signs every delivery, it is only shown to the owner when the webhook is created
+	Secret string `json:"secret"`
+	// EventTypes filters the events sent, empty means every task event
+	EventTypes []string `json:"event_types"`
+	// AllTasks sends the events of every task, otherwise only tasks the owner assigned, is
+	// assigned or watches. Only admins may set it, it is turned off once the owner isn't one.
+	AllTasks bool `json:"all_tasks"`
+	Active   bool `json:"active"`
+	// DisabledReason says why the webhook was turned off automatically
+	DisabledReason string    `json:"disabled_reason,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Wants tells whether events of the type pass the webhook's filter
+func (w Webhook) Wants(eventType string) bool {
+	if len(w.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range w.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is one event sent to one webhook, along with the log of its attempts
+type Delivery struct {
+	ID        string          `json:"id"`
+	WebhookID string          `json:"webhook_id"`
+	EventID   string          `json:"event_id"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	Status    string          `json:"status"`
+	Attempts  int             `json:"attempts"`
+	// NextAttemptAt is set while the delivery is pending
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	// ReplayOf is the delivery this one repeats
+	ReplayOf  string    `json:"replay_of,omitempty"`
+	Log       []Attempt `json:"log"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Attempt is one POST of a delivery. StatusCode is 0 when no response came back.
+type Attempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	// Response is the start of the response body
+	Response   string `json:"response,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Event is the JSON body POSTed for a task event
+type Event struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	ActorID    int       `json:"actor_id"`
+	TaskID     int       `json:"task_id"`
+	TaskName   string    `json:"task_name"`
+	AssignedTo int       `json:"assigned_to"`
+	AssignedBy int       `json:"assigned_by"`
+	Watchers   []int     `json:"watchers"`
+	// the task before and after the change, when the event carries it
+	Before *task.TaskSnapshot `json:"before,omitempty"`
+	After  *task.TaskSnapshot `json:"after,omitempty"`
+}
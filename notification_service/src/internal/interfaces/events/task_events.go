@@ -0,0 +1,105 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	sharedevents "events"
+	pb "events/generated"
+	"fmt"
+	"notificationservice/src/internal/core/task"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrInvalidEvent is returned for events that don't match their contract, they fail the same way
+// on every delivery
+var ErrInvalidEvent = errors.New("invalid event")
+
+// DecodeTaskEnvelope decodes and checks an EventEnvelope carrying a task event, it returns the
+// envelope id along with the event
+func DecodeTaskEnvelope(data []byte) (string, task.TaskEvent, error) {
+	var envelope pb.EventEnvelope
+	if err := proto.Unmarshal(data, &envelope); err != nil {
+		return "", task.TaskEvent{}, invalid("undecodable envelope: %v", err)
+	}
+	if envelope.GetId() == "" {
+		return "", task.TaskEvent{}, invalid("envelope without id")
+	}
+	if !sharedevents.IsTaskEventType(envelope.GetType()) {
+		return "", task.TaskEvent{}, invalid("unknown event type %q", envelope.GetType())
+	}
+	if err := envelope.GetOccurredAt().CheckValid(); err != nil {
+		return "", task.TaskEvent{}, invalid("bad occurred_at: %v", err)
+	}
+
+	var event task.TaskEvent
+	switch envelope.GetVersion() {
+	case sharedevents.TaskChangedVersion:
+		var payload pb.TaskChanged
+		if err := proto.Unmarshal(envelope.GetPayload(), &payload); err != nil {
+			return "", task.TaskEvent{}, invalid("undecodable %s v1 payload: %v", envelope.GetType(), err)
+		}
+		event = task.TaskEvent{
+			TaskID:         int(payload.GetTaskId()),
+			TaskName:       payload.GetTaskName(),
+			AssignedTo:     int(payload.GetAssignedTo()),
+			AssignedBy:     int(payload.GetAssignedBy()),
+			AssignedToName: payload.GetAssignedToName(),
+			AssignedByName: payload.GetAssignedByName(),
+			Before:         taskSnapshot(payload.GetBefore()),
+			After:          taskSnapshot(payload.GetAfter()),
+		}
+		for _, watcher := range payload.GetWatchers() {
+			event.Watchers = append(event.Watchers, int(watcher))
+		}
+	default:
+		return "", task.TaskEvent{}, invalid("unsupported %s version %d", envelope.GetType(), envelope.GetVersion())
+	}
+
+	event.EventType = envelope.GetType()
+	event.Timestamp = envelope.GetOccurredAt().AsTime()
+	event.ActorID = int(envelope.GetActorId())
+	return envelope.GetId(), event, checkTaskEvent(event)
+}
+
+// DecodeLegacyTaskEvent decodes the bare JSON task events published before the envelope existed
+func DecodeLegacyTaskEvent(data []byte) (task.TaskEvent, error) {
+	var event task.TaskEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return task.TaskEvent{}, invalid("undecodable legacy event: %v", err)
+	}
+	if !sharedevents.IsTaskEventType(event.EventType) {
+		return task.TaskEvent{}, invalid("unknown event type %q", event.EventType)
+	}
+	return event, checkTaskEvent(event)
+}
+
+func taskSnapshot(snapshot *pb.TaskSnapshot) *task.TaskSnapshot {
+	if snapshot == nil {
+		return nil
+	}
+	return &task.TaskSnapshot{
+		Name:           snapshot.GetName(),
+		Description:    snapshot.GetDescription(),
+		Status:         snapshot.GetStatus(),
+		Priority:       int(snapshot.GetPriority()),
+		Deadline:       snapshot.GetDeadline().AsTime(),
+		AssignedTo:     int(snapshot.GetAssignedTo()),
+		AssignedBy:     int(snapshot.GetAssignedBy()),
+		AssignedToName: snapshot.GetAssignedToName(),
+	}
+}
+
+func checkTaskEvent(event task.TaskEvent) error {
+	if event.TaskID <= 0 {
+		return invalid("%s without task id", event.EventType)
+	}
+	if event.AssignedBy <= 0 {
+		return invalid("%s for task %d without assigner", event.EventType, event.TaskID)
+	}
+	return nil
+}
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidEvent, fmt.Sprintf(format, args...))
+}
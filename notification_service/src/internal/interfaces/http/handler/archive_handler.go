@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"notificationservice/src/internal/usecase"
+	errorhandling "notificationservice/src/pkg/error_handling"
+	pkgresponse "notificationservice/src/pkg/response"
+	"strconv"
+	"time"
+)
+
+type ArchiveHandler struct {
+	archiveUseCase *usecase.ArchiveUseCase
+}
+
+func NewArchiveHandler(uc *usecase.ArchiveUseCase) *ArchiveHandler {
+	return &ArchiveHandler{
+		archiveUseCase: uc,
+	}
+}
+
+// Search returns the archived notifications of the logged-in user sent between ?from and ?to
+func (h *ArchiveHandler) Search(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+	h.search(w, r, userID)
+}
+
+// SearchAll searches the archived notifications of every user, or of ?user_id, for admins
+func (h *ArchiveHandler) SearchAll(w http.ResponseWriter, r *http.Request) {
+	userID := 0
+	if userIDStr := r.URL.Query().Get("user_id"); userIDStr != "" {
+		parsed, err := strconv.Atoi(userIDStr)
+		if err != nil || parsed <= 0 {
+			errorhandling.HandleError(w, "Invalid User ID", http.StatusBadRequest)
+			return
+		}
+		userID = parsed
+	}
+	h.search(w, r, userID)
+}
+
+func (h *ArchiveHandler) search(w http.ResponseWriter, r *http.Request, userID int) {
+	from, err := parseArchiveTime(r.URL.Query().Get("from"), false)
+	if err != nil {
+		errorhandling.HandleError(w, "Invalid From Date", http.StatusBadRequest)
+		return
+	}
+	to, err := parseArchiveTime(r.URL.Query().Get("to"), true)
+	if err != nil {
+		errorhandling.HandleError(w, "Invalid To Date", http.StatusBadRequest)
+		return
+	}
+
+	notifications, err := h.archiveUseCase.Search(r.Context(), userID, from, to, limitParam(r))
+	if errors.Is(err, usecase.ErrArchiveDisabled) {
+		errorhandling.HandleError(w, err.Error(), http.StatusNotFound)
+		return
+	} else if errors.Is(err, usecase.ErrInvalidRange) {
+		errorhandling.HandleError(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		errorhandling.HandleError(w, "Failed to Search Archived Notifications", http.StatusInternalServerError)
+		return
+	}
+
+	transformed := make([]map[string]interface{}, len(notifications))
+	for i, notif := range notifications {
+		transformed[i] = transformNotification(notif)
+	}
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Archived Notifications Retrieved Successfully",
+		Data: map[string]interface{}{
+			"notifications": transformed,
+			"count":         len(transformed),
+		},
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+// parseArchiveTime reads an RFC 3339 time or a date. A date that ends a range includes its whole
+// day. Empty is the zero time, the use case picks the default then.
+func parseArchiveTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		return day.AddDate(0, 0, 1), nil
+	}
+	return day, nil
+}
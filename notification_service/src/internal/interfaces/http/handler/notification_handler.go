@@ -1,12 +1,16 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"notificationservice/src/internal/core/notification"
 	"notificationservice/src/internal/usecase"
 	errorhandling "notificationservice/src/pkg/error_handling"
 	pkgresponse "notificationservice/src/pkg/response"
 	"strconv"
+
+	"github.com/go-chi/chi/v5"
 )
 
 type NotificationHandler struct {
@@ -19,109 +23,218 @@ func NewNotificationHandler(uc *usecase.NotificationUseCase) *NotificationHandle
 	}
 }
 
+// GetRecentNotification returns the latest notification involving the logged-in user
 func (h *NotificationHandler) GetRecentNotification(w http.ResponseWriter, r *http.Request) {
-	// Check if x-userId header is present for user-specific recent notification
-	userIDHeader := r.Header.Get("x-userId")
-
-	var notification *notification.Notification
-	var err error
-
-	if userIDHeader != "" {
-		// Get recent notification for specific user (where they are assigned_by)
-		userID, parseErr := strconv.Atoi(userIDHeader)
-		if parseErr == nil {
-			notification, err = h.notificationUseCase.GetMyRecentNotification(r.Context(), userID)
-		} else {
-			// Fall back to global recent if invalid user ID
-			notification, err = h.notificationUseCase.GetMostRecentNotification(r.Context())
-		}
-	} else {
-		// Get global recent notification
-		notification, err = h.notificationUseCase.GetMostRecentNotification(r.Context())
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
 	}
 
+	notification, err := h.notificationUseCase.GetMyRecentNotification(r.Context(), userID)
 	if err != nil {
 		errorhandling.HandleError(w, "Failed to Retrieve Recent Notification", http.StatusInternalServerError)
 		return
 	}
+	writeRecentNotification(w, notification)
+}
 
-	// Return single recent notification or null if none exists
-	if notification == nil {
-		response := pkgresponse.StandardResponse{
-			Status:  "SUCCESS",
-			Message: "No Recent Notifications Found",
-			Data:    nil,
-		}
-		pkgresponse.WriteResponse(w, http.StatusOK, response)
+// GetAllRecentNotification returns the latest notification of every user, for admins
+func (h *NotificationHandler) GetAllRecentNotification(w http.ResponseWriter, r *http.Request) {
+	notification, err := h.notificationUseCase.GetMostRecentNotification(r.Context())
+	if err != nil {
+		errorhandling.HandleError(w, "Failed to Retrieve Recent Notification", http.StatusInternalServerError)
 		return
 	}
+	writeRecentNotification(w, notification)
+}
+
+// GetUserNotifications returns the inbox of the logged-in user, ?unread=true leaves out read entries
+func (h *NotificationHandler) GetUserNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	page, err := h.notificationUseCase.GetMyNotifications(r.Context(), userID, r.URL.Query().Get("cursor"), limitParam(r), r.URL.Query().Get("unread") == "true")
+	writeNotifications(w, page, err)
+}
 
-	// Transform notification to show assigned_to instead of assigned_by
-	transformedNotification := map[string]interface{}{
-		"id":          notification.ID,
-		"task_id":     notification.TaskID,
-		"action":      notification.Action,
-		"task_name":   notification.TaskName,
-		"assigned_to": notification.UserID, // Show who the task was assigned TO
-		"message":     notification.Message,
-		"timestamp":   notification.Timestamp,
+// MarkRead marks one notification of the logged-in user as read
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	err := h.notificationUseCase.MarkRead(r.Context(), userID, chi.URLParam(r, "id"))
+	if errors.Is(err, usecase.ErrNotificationNotFound) {
+		errorhandling.HandleError(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		errorhandling.HandleError(w, "Failed to Mark Notification as Read", http.StatusInternalServerError)
+		return
 	}
 
 	response := pkgresponse.StandardResponse{
 		Status:  "SUCCESS",
-		Message: "Recent Notification Retrieved Successfully",
-		Data:    transformedNotification,
+		Message: "Notification Marked as Read",
 	}
 	pkgresponse.WriteResponse(w, http.StatusOK, response)
 }
 
-func (h *NotificationHandler) GetUserNotifications(w http.ResponseWriter, r *http.Request) {
-	// Check if x-userId header is present for user-specific notifications
-	userIDHeader := r.Header.Get("x-userId")
+// MarkAllRead marks every notification of the logged-in user as read
+func (h *NotificationHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	marked, err := h.notificationUseCase.MarkAllRead(r.Context(), userID)
+	if err != nil {
+		errorhandling.HandleError(w, "Failed to Mark Notifications as Read", http.StatusInternalServerError)
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Notifications Marked as Read",
+		Data: map[string]interface{}{
+			"marked": marked,
+		},
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+// GetUnreadCount returns how many unread notifications the logged-in user has
+func (h *NotificationHandler) GetUnreadCount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	count, err := h.notificationUseCase.UnreadCount(r.Context(), userID)
+	if err != nil {
+		errorhandling.HandleError(w, "Failed to Count Unread Notifications", http.StatusInternalServerError)
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Unread Count Retrieved Successfully",
+		Data: map[string]interface{}{
+			"unread": count,
+		},
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+// GetAllNotifications returns the notifications of every user, for admins
+func (h *NotificationHandler) GetAllNotifications(w http.ResponseWriter, r *http.Request) {
+	page, err := h.notificationUseCase.GetAllNotifications(r.Context(), r.URL.Query().Get("cursor"), limitParam(r))
+	writeNotifications(w, page, err)
+}
+
+// GetPreferences returns the notification preferences of the logged-in user
+func (h *NotificationHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	prefs, err := h.notificationUseCase.GetPreferences(r.Context(), userID)
+	if err != nil {
+		errorhandling.HandleError(w, "Failed to Retrieve Preferences", http.StatusInternalServerError)
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Preferences Retrieved Successfully",
+		Data:    prefs,
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+// UpdatePreferences changes the notification preferences of the logged-in user, fields left out
+// of the body keep their value
+func (h *NotificationHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	var input usecase.PreferencesInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errorhandling.HandleError(w, "Invalid Request Body", http.StatusBadRequest)
+		return
+	}
+
+	prefs, err := h.notificationUseCase.UpdatePreferences(r.Context(), userID, input)
+	if errors.Is(err, usecase.ErrInvalidPreferences) {
+		errorhandling.HandleError(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		errorhandling.HandleError(w, "Failed to Update Preferences", http.StatusInternalServerError)
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Preferences Updated Successfully",
+		Data:    prefs,
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
 
-	// Get limit from query parameter
-	limitStr := r.URL.Query().Get("limit")
-	limit := 50 // default for all notifications
-	if limitStr != "" {
+func limitParam(r *http.Request) int {
+	limit := 0 // the use case picks the default page size
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
 		if parsedLimit, err := strconv.Atoi(limitStr); err == nil {
 			limit = parsedLimit
 		}
 	}
+	return limit
+}
 
-	var notifications []notification.Notification
-	var err error
-
-	if userIDHeader != "" {
-		// Get notifications where logged-in user is assigned_by
-		userID, parseErr := strconv.Atoi(userIDHeader)
-		if parseErr == nil {
-			notifications, err = h.notificationUseCase.GetMyNotifications(r.Context(), userID, limit)
-		} else {
-			// Fall back to all notifications if invalid user ID
-			notifications, err = h.notificationUseCase.GetAllNotifications(r.Context(), limit)
+func writeRecentNotification(w http.ResponseWriter, notification *notification.Notification) {
+	// Return single recent notification or null if none exists
+	if notification == nil {
+		response := pkgresponse.StandardResponse{
+			Status:  "SUCCESS",
+			Message: "No Recent Notifications Found",
+			Data:    nil,
 		}
-	} else {
-		// Get all notifications
-		notifications, err = h.notificationUseCase.GetAllNotifications(r.Context(), limit)
+		pkgresponse.WriteResponse(w, http.StatusOK, response)
+		return
 	}
 
-	if err != nil {
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Recent Notification Retrieved Successfully",
+		Data:    transformNotification(*notification),
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+func writeNotifications(w http.ResponseWriter, page notification.Page, err error) {
+	if errors.Is(err, usecase.ErrInvalidCursor) {
+		errorhandling.HandleError(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
 		errorhandling.HandleError(w, "Failed to Retrieve Notifications", http.StatusInternalServerError)
 		return
 	}
 
-	// Transform notifications to show assigned_to instead of assigned_by
-	transformedNotifications := make([]map[string]interface{}, len(notifications))
-	for i, notif := range notifications {
-		transformedNotifications[i] = map[string]interface{}{
-			"id":          notif.ID,
-			"task_id":     notif.TaskID,
-			"action":      notif.Action,
-			"task_name":   notif.TaskName,
-			"assigned_to": notif.UserID, // Show who the task was assigned TO
-			"message":     notif.Message,
-			"timestamp":   notif.Timestamp,
-		}
+	transformedNotifications := make([]map[string]interface{}, len(page.Notifications))
+	for i, notif := range page.Notifications {
+		transformedNotifications[i] = transformNotification(notif)
 	}
 
 	response := pkgresponse.StandardResponse{
@@ -130,8 +243,30 @@ func (h *NotificationHandler) GetUserNotifications(w http.ResponseWriter, r *htt
 		Data: map[string]interface{}{
 			"notifications": transformedNotifications,
 			"count":         len(transformedNotifications),
-			// "user_filter":   userIDHeader != "",
+			"next_cursor":   page.NextCursor,
 		},
 	}
 	pkgresponse.WriteResponse(w, http.StatusOK, response)
 }
+
+// Transform notification to the inbox entry shown to its recipient
+func transformNotification(notif notification.Notification) map[string]interface{} {
+	assignedTo := notif.AssignedTo
+	if assignedTo == 0 {
+		// entries stored before the inbox kept the assignee as the recipient
+		assignedTo = notif.UserID
+	}
+	return map[string]interface{}{
+		"id":          notif.ID,
+		"task_id":     notif.TaskID,
+		"action":      notif.Action,
+		"task_name":   notif.TaskName,
+		"assigned_to": assignedTo,
+		"assigned_by": notif.AssignedBy,
+		"message":     notif.Message,
+		"changes":     notif.Changes,
+		"timestamp":   notif.Timestamp,
+		"read":        notif.Read,
+		"read_at":     notif.ReadAt,
+	}
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"notificationservice/src/internal/core/notification"
+	"notificationservice/src/internal/usecase"
+	errorhandling "notificationservice/src/pkg/error_handling"
+	"time"
+)
+
+// clients wait this long before reconnecting a dropped stream
+const streamRetry = 5 * time.Second
+
+type StreamHandler struct {
+	notificationUseCase *usecase.NotificationUseCase
+	inboxHub            *usecase.InboxHub
+	heartbeat           time.Duration
+}
+
+func NewStreamHandler(uc *usecase.NotificationUseCase, hub *usecase.InboxHub, heartbeat time.Duration) *StreamHandler {
+	return &StreamHandler{
+		notificationUseCase: uc,
+		inboxHub:            hub,
+		heartbeat:           heartbeat,
+	}
+}
+
+// Stream keeps a Server-Sent Events connection open and pushes every new notification of the
+// logged-in user. A client reconnecting with Last-Event-ID first gets what it missed.
+func (h *StreamHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		errorhandling.HandleError(w, "Streaming Not Supported", http.StatusInternalServerError)
+		return
+	}
+
+	// subscribing before reading the history, nothing stored in between is missed
+	sub := h.inboxHub.Subscribe(userID)
+	defer h.inboxHub.Unsubscribe(sub)
+
+	var missed []notification.Notification
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		var err error
+		missed, err = h.notificationUseCase.GetMyNotificationsSince(r.Context(), userID, lastEventID)
+		if errors.Is(err, usecase.ErrInvalidCursor) {
+			errorhandling.HandleError(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			errorhandling.HandleError(w, "Failed to Retrieve Notifications", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+
+	// the history may overlap with what the subscription already received
+	replayed := make(map[string]bool, len(missed))
+	for _, notif := range missed {
+		if err := writeStreamEvent(w, notif); err != nil {
+			return
+		}
+		replayed[notif.ID] = true
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.Closed:
+			// fell behind, the client reconnects and catches up from Last-Event-ID
+			return
+		case notif := <-sub.Notifications:
+			if replayed[notif.ID] {
+				delete(replayed, notif.ID)
+				continue
+			}
+			if err := writeStreamEvent(w, notif); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeStreamEvent(w io.Writer, notif notification.Notification) error {
+	data, err := json.Marshal(transformNotification(notif))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: notification\ndata: %s\n\n", usecase.StreamPosition(notif), data)
+	return err
+}
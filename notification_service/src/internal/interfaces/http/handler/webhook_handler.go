@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"notificationservice/src/internal/core/auth"
+	"notificationservice/src/internal/core/webhook"
+	"notificationservice/src/internal/usecase"
+	errorhandling "notificationservice/src/pkg/error_handling"
+	pkgresponse "notificationservice/src/pkg/response"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type WebhookHandler struct {
+	webhookUseCase *usecase.WebhookUseCase
+}
+
+func NewWebhookHandler(uc *usecase.WebhookUseCase) *WebhookHandler {
+	return &WebhookHandler{
+		webhookUseCase: uc,
+	}
+}
+
+// Create registers a webhook for the logged-in user, the response is the only time its secret is shown
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("auth_claims").(auth.Claims)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	var input usecase.WebhookInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errorhandling.HandleError(w, "Invalid Request Body", http.StatusBadRequest)
+		return
+	}
+
+	hook, err := h.webhookUseCase.CreateWebhook(r.Context(), claims, input)
+	if err != nil {
+		handleWebhookError(w, err, "Failed to Create Webhook")
+		return
+	}
+
+	data := transformWebhook(hook)
+	data["secret"] = hook.Secret
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Webhook Created Successfully",
+		Data:    data,
+	}
+	pkgresponse.WriteResponse(w, http.StatusCreated, response)
+}
+
+// List returns the webhooks of the logged-in user, admins get every webhook
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("auth_claims").(auth.Claims)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	hooks, err := h.webhookUseCase.ListWebhooks(r.Context(), claims)
+	if err != nil {
+		errorhandling.HandleError(w, "Failed to Retrieve Webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	transformed := make([]map[string]interface{}, len(hooks))
+	for i, hook := range hooks {
+		transformed[i] = transformWebhook(hook)
+	}
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Webhooks Retrieved Successfully",
+		Data: map[string]interface{}{
+			"webhooks": transformed,
+			"count":    len(transformed),
+		},
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+func (h *WebhookHandler) Get(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("auth_claims").(auth.Claims)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	hook, err := h.webhookUseCase.GetWebhook(r.Context(), claims, chi.URLParam(r, "id"))
+	if err != nil {
+		handleWebhookError(w, err, "Failed to Retrieve Webhook")
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Webhook Retrieved Successfully",
+		Data:    transformWebhook(hook),
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+// Update changes the URL, filters or state of a webhook, {"active": true} turns a disabled one back on
+func (h *WebhookHandler) Update(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("auth_claims").(auth.Claims)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	var input usecase.WebhookInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errorhandling.HandleError(w, "Invalid Request Body", http.StatusBadRequest)
+		return
+	}
+
+	hook, err := h.webhookUseCase.UpdateWebhook(r.Context(), claims, chi.URLParam(r, "id"), input)
+	if err != nil {
+		handleWebhookError(w, err, "Failed to Update Webhook")
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Webhook Updated Successfully",
+		Data:    transformWebhook(hook),
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("auth_claims").(auth.Claims)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.webhookUseCase.DeleteWebhook(r.Context(), claims, chi.URLParam(r, "id")); err != nil {
+		handleWebhookError(w, err, "Failed to Delete Webhook")
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Webhook Deleted Successfully",
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+// ListDeliveries returns the newest deliveries of a webhook with the log of their attempts
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("auth_claims").(auth.Claims)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	deliveries, err := h.webhookUseCase.ListDeliveries(r.Context(), claims, chi.URLParam(r, "id"), limitParam(r))
+	if err != nil {
+		handleWebhookError(w, err, "Failed to Retrieve Deliveries")
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Deliveries Retrieved Successfully",
+		Data: map[string]interface{}{
+			"deliveries": deliveries,
+			"count":      len(deliveries),
+		},
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+// Replay sends a past delivery again, as a new delivery with its own log
+func (h *WebhookHandler) Replay(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("auth_claims").(auth.Claims)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	delivery, err := h.webhookUseCase.ReplayDelivery(r.Context(), claims, chi.URLParam(r, "id"), chi.URLParam(r, "deliveryID"))
+	if err != nil {
+		handleWebhookError(w, err, "Failed to Replay Delivery")
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Delivery Queued",
+		Data:    delivery,
+	}
+	pkgresponse.WriteResponse(w, http.StatusAccepted, response)
+}
+
+func handleWebhookError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, usecase.ErrWebhookNotFound), errors.Is(err, usecase.ErrDeliveryNotFound):
+		errorhandling.HandleError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, usecase.ErrInvalidWebhook), errors.Is(err, usecase.ErrTooManyWebhooks):
+		errorhandling.HandleError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, usecase.ErrAllTasksForAdmin):
+		errorhandling.HandleError(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, usecase.ErrWebhookDisabled):
+		errorhandling.HandleError(w, err.Error(), http.StatusConflict)
+	default:
+		errorhandling.HandleError(w, fallback, http.StatusInternalServerError)
+	}
+}
+
+// transformWebhook leaves out the secret, it is only shown when the webhook is created
+func transformWebhook(hook webhook.Webhook) map[string]interface{} {
+	return map[string]interface{}{
+		"id":              hook.ID,
+		"owner_id":        hook.OwnerID,
+		"url":             hook.URL,
+		"event_types":     hook.EventTypes,
+		"all_tasks":       hook.AllTasks,
+		"active":          hook.Active,
+		"disabled_reason": hook.DisabledReason,
+		"created_at":      hook.CreatedAt,
+		"updated_at":      hook.UpdatedAt,
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"notificationservice/src/internal/core/auth"
+	pb "notificationservice/src/internal/interfaces/grpc/generated/generated"
+	errorhandling "notificationservice/src/pkg/error_handling"
+	"strconv"
+	"time"
+)
+
+// grpcTimeout bounds every call to user_service made while authenticating a request
+const grpcTimeout = 3 * time.Second
+
+// SessionAuthMiddleware validates the "sess" cookie with user_service, the same way task_service does
+func SessionAuthMiddleware(grpcClient pb.SessionValidatorClient) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie("sess")
+			if err != nil {
+				errorhandling.HandleError(w, "Session Cookie is missing", http.StatusUnauthorized)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), grpcTimeout)
+			defer cancel()
+			resp, err := grpcClient.ValidateSession(ctx, &pb.ValidateSessionRequest{
+				SessionId: cookie.Value,
+			})
+			if err != nil || !resp.Valid {
+				errorhandling.HandleError(w, "invalid session", http.StatusUnauthorized)
+				return
+			}
+
+			userID, err := strconv.Atoi(resp.UserId)
+			if err != nil {
+				errorhandling.HandleError(w, "invalid user ID from session", http.StatusInternalServerError)
+				return
+			}
+
+			claims := auth.Claims{UserID: userID, Roles: resp.Roles}
+			ctx = context.WithValue(r.Context(), "user_id", claims.UserID)
+			ctx = context.WithValue(ctx, "auth_claims", claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireRole only lets callers with the role through, it must run after SessionAuthMiddleware
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("auth_claims").(auth.Claims)
+			if !ok || !claims.HasRole(role) {
+				errorhandling.HandleError(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -2,24 +2,54 @@ package routes
 
 import (
 	"net/http"
+	"notificationservice/src/internal/core/auth"
 	"notificationservice/src/internal/interfaces/http/handler"
+	authmiddleware "notificationservice/src/internal/interfaces/http/middleware"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-func InitRoutes(notificationHandler *handler.NotificationHandler) http.Handler {
+func InitRoutes(notificationHandler *handler.NotificationHandler, streamHandler *handler.StreamHandler, webhookHandler *handler.WebhookHandler, archiveHandler *handler.ArchiveHandler, authMiddleware func(http.Handler) http.Handler) http.Handler {
 	router := chi.NewRouter()
 
 	// Middleware
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.RealIP)
 
-	// Notification routes
+	// Notification routes, scoped to the logged-in user
 	router.Route("/v1/notifications", func(r chi.Router) {
+		r.Use(authMiddleware)
 		r.Get("/recent", notificationHandler.GetRecentNotification)
 		r.Get("/user", notificationHandler.GetUserNotifications)
+		r.Get("/stream", streamHandler.Stream)
+		r.Get("/unread-count", notificationHandler.GetUnreadCount)
+		r.Get("/preferences", notificationHandler.GetPreferences)
+		r.Put("/preferences", notificationHandler.UpdatePreferences)
+		r.Get("/archive", archiveHandler.Search)
+		r.Post("/read-all", notificationHandler.MarkAllRead)
+		r.Post("/{id}/read", notificationHandler.MarkRead)
+	})
+
+	// Webhooks of the logged-in user, admins manage every webhook
+	router.Route("/v1/webhooks", func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Post("/", webhookHandler.Create)
+		r.Get("/", webhookHandler.List)
+		r.Get("/{id}", webhookHandler.Get)
+		r.Patch("/{id}", webhookHandler.Update)
+		r.Delete("/{id}", webhookHandler.Delete)
+		r.Get("/{id}/deliveries", webhookHandler.ListDeliveries)
+		r.Post("/{id}/deliveries/{deliveryID}/replay", webhookHandler.Replay)
+	})
 
+	// Global feeds across all users
+	router.Route("/v1/admin/notifications", func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Use(authmiddleware.RequireRole(auth.RoleAdmin))
+		r.Get("/recent", notificationHandler.GetAllRecentNotification)
+		r.Get("/", notificationHandler.GetAllNotifications)
+		r.Get("/archive", archiveHandler.SearchAll)
 	})
 
 	return router
@@ -3,55 +3,54 @@ package subscriber
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
-	"notificationservice/src/internal/adaptors/redis"
-	"notificationservice/src/internal/core/task"
+	redisclient "notificationservice/src/internal/adaptors/redis"
+	"notificationservice/src/internal/core/user"
+	"notificationservice/src/internal/interfaces/events"
 	"notificationservice/src/internal/usecase"
+
+	"github.com/redis/go-redis/v9"
 )
 
 type EventSubscriber struct {
-	redisClient         *redis.RedisClient
+	redisClient         *redisclient.RedisClient
 	notificationUseCase *usecase.NotificationUseCase
+	webhookUseCase      *usecase.WebhookUseCase
+	archiveUseCase      *usecase.ArchiveUseCase
 }
 
-func NewEventSubscriber(redisClient *redis.RedisClient, uc *usecase.NotificationUseCase) *EventSubscriber {
+func NewEventSubscriber(redisClient *redisclient.RedisClient, uc *usecase.NotificationUseCase, webhookUC *usecase.WebhookUseCase, archiveUC *usecase.ArchiveUseCase) *EventSubscriber {
 	return &EventSubscriber{
 		redisClient:         redisClient,
 		notificationUseCase: uc,
+		webhookUseCase:      webhookUC,
+		archiveUseCase:      archiveUC,
 	}
 }
 
-func (s *EventSubscriber) StartListening(ctx context.Context, channel string) {
-	log.Println("Starting notification service event listener...")
-
-	// Subscribe to task events
-	pubsub := s.redisClient.Subscribe(ctx, channel)
-	defer pubsub.Close()
-
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Event subscriber shutting down...")
-			return
-		default:
-			msg, err := pubsub.ReceiveMessage(ctx)
-			if err != nil {
-				log.Printf("Error receiving message: %v", err)
-				continue
-			}
-
-			var event task.TaskEvent
-			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
-				log.Printf("Failed to unmarshal event: %v", err)
-				continue
-			}
+// handleUserEvent processes one entry of the user event stream, the JSON event is under payload.
+// The stream id keeps a redelivered event from notifying the user twice.
+func (s *EventSubscriber) handleUserEvent(ctx context.Context, message redis.XMessage) error {
+	payload, _ := message.Values["payload"].(string)
+	var event user.UserEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		return fmt.Errorf("%w: %v", events.ErrInvalidEvent, err)
+	}
 
-			log.Printf("Received event: %s for task %d", event.EventType, event.TaskID)
+	log.Printf("Received user event: %s for user %d", event.EventType, event.UserID)
 
-			// Process the event and store notification
-			if err := s.notificationUseCase.ProcessTaskEvent(ctx, event); err != nil {
-				log.Printf("Failed to process event: %v", err)
-			}
+	if err := s.notificationUseCase.ProcessUserEvent(ctx, user.UserEventsStream+":"+message.ID, event); err != nil {
+		return err
+	}
+	// the history and the webhooks of a deleted account go too
+	if event.EventType == user.EventUserDeleted {
+		if err := s.archiveUseCase.DeleteUser(ctx, event.UserID); err != nil {
+			return err
+		}
+		if err := s.webhookUseCase.DeleteUserWebhooks(ctx, event.UserID); err != nil {
+			return err
 		}
 	}
+	return nil
 }
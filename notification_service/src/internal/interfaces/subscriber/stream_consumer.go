@@ -0,0 +1,185 @@
+package subscriber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"notificationservice/src/internal/core/task"
+	"notificationservice/src/internal/core/user"
+	"notificationservice/src/internal/interfaces/events"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	streamReadCount = 10
+	streamReadBlock = 5 * time.Second
+)
+
+// StreamOptions configures how a replica consumes the event streams
+type StreamOptions struct {
+	// Group is shared by every replica, each event is handled by one of them
+	Group string
+	// Consumer names this replica within the group and must be unique across replicas
+	Consumer string
+	// ReclaimIdle is how long an event may stay unacknowledged before another consumer takes it over
+	ReclaimIdle time.Duration
+	// MaxDeliveries is how often an event is tried before it goes to the dead-letter stream
+	MaxDeliveries int64
+}
+
+// eventStream is a stream the group consumes, with where its failed entries go and how one is handled
+type eventStream struct {
+	name       string
+	deadLetter string
+	// handle returns events.ErrInvalidEvent for an entry that would fail the same way every time
+	handle func(ctx context.Context, message redis.XMessage) error
+}
+
+// ConsumeTaskEvents reads task events through the consumer group until ctx is done
+func (s *EventSubscriber) ConsumeTaskEvents(ctx context.Context, opts StreamOptions) {
+	s.consume(ctx, opts, eventStream{
+		name:       task.TaskEventsStream,
+		deadLetter: task.TaskEventsDeadLetterStream,
+		handle:     s.handleTaskEvent,
+	})
+}
+
+// ConsumeUserEvents reads the account events of user_service through the consumer group until ctx is done
+func (s *EventSubscriber) ConsumeUserEvents(ctx context.Context, opts StreamOptions) {
+	s.consume(ctx, opts, eventStream{
+		name:       user.UserEventsStream,
+		deadLetter: user.UserEventsDeadLetterStream,
+		handle:     s.handleUserEvent,
+	})
+}
+
+// consume reads the stream through the consumer group until ctx is done. An event is acknowledged
+// once it was processed; a failed one stays pending and is retried when it is reclaimed, until it
+// runs out of deliveries and is moved to the dead-letter stream.
+func (s *EventSubscriber) consume(ctx context.Context, opts StreamOptions, stream eventStream) {
+	log.Printf("Consuming %s as %s in group %s", stream.name, opts.Consumer, opts.Group)
+
+	for {
+		err := s.redisClient.EnsureConsumerGroup(ctx, stream.name, opts.Group)
+		if err == nil {
+			break
+		}
+		log.Printf("Failed to create consumer group: %v", err)
+		if !sleepCtx(ctx, time.Second) {
+			return
+		}
+	}
+
+	reclaim := time.NewTicker(opts.ReclaimIdle / 2)
+	defer reclaim.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("Consumer of %s shutting down...", stream.name)
+			return
+		case <-reclaim.C:
+			s.reclaim(ctx, opts, stream)
+		default:
+			messages, err := s.redisClient.ReadStreamGroup(ctx, stream.name, opts.Group, opts.Consumer, streamReadCount, streamReadBlock)
+			if errors.Is(err, redis.Nil) {
+				continue
+			} else if err != nil {
+				log.Printf("Error reading %s: %v", stream.name, err)
+				sleepCtx(ctx, time.Second)
+				continue
+			}
+
+			for _, message := range messages {
+				s.deliver(ctx, opts, stream, message)
+			}
+		}
+	}
+}
+
+// reclaim takes over events left unacknowledged by this or a crashed consumer and retries them,
+// or dead-letters those that used up their deliveries
+func (s *EventSubscriber) reclaim(ctx context.Context, opts StreamOptions, stream eventStream) {
+	messages, err := s.redisClient.ClaimIdleMessages(ctx, stream.name, opts.Group, opts.Consumer, opts.ReclaimIdle, streamReadCount)
+	if err != nil {
+		log.Printf("Error reclaiming %s: %v", stream.name, err)
+		return
+	}
+
+	for _, message := range messages {
+		if message.Deliveries > opts.MaxDeliveries {
+			s.deadLetter(ctx, opts, stream, message.XMessage, fmt.Sprintf("failed after %d deliveries", opts.MaxDeliveries))
+			continue
+		}
+		log.Printf("Retrying %s entry %s (delivery %d)", stream.name, message.ID, message.Deliveries)
+		s.deliver(ctx, opts, stream, message.XMessage)
+	}
+}
+
+func (s *EventSubscriber) deliver(ctx context.Context, opts StreamOptions, stream eventStream, message redis.XMessage) {
+	err := stream.handle(ctx, message)
+	if errors.Is(err, events.ErrInvalidEvent) {
+		// it would fail the same way on every delivery
+		s.deadLetter(ctx, opts, stream, message, err.Error())
+		return
+	} else if err != nil {
+		// left pending, it is retried once it has been idle for ReclaimIdle
+		log.Printf("Failed to process %s entry %s: %v", stream.name, message.ID, err)
+		return
+	}
+
+	if err := s.redisClient.AckStream(ctx, stream.name, opts.Group, message.ID); err != nil {
+		log.Printf("Failed to acknowledge %s entry %s: %v", stream.name, message.ID, err)
+	}
+}
+
+// handleTaskEvent decodes and processes one stream entry. The event id keeps a redelivered
+// event from adding the same notifications or webhook deliveries twice.
+func (s *EventSubscriber) handleTaskEvent(ctx context.Context, message redis.XMessage) error {
+	eventID, event, err := decodeTaskEvent(message)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Received event: %s for task %d", event.EventType, event.TaskID)
+
+	// Process the event and store notification
+	if err := s.notificationUseCase.ProcessTaskEvent(ctx, eventID, event); err != nil {
+		return err
+	}
+	return s.webhookUseCase.EnqueueTaskEvent(ctx, eventID, event)
+}
+
+// decodeTaskEvent reads the EventEnvelope of an entry. Entries appended before the envelope
+// existed hold the JSON event under payload and are identified by their stream id.
+func decodeTaskEvent(message redis.XMessage) (string, task.TaskEvent, error) {
+	if envelope, ok := message.Values["envelope"].(string); ok {
+		return events.DecodeTaskEnvelope([]byte(envelope))
+	}
+	if payload, ok := message.Values["payload"].(string); ok {
+		event, err := events.DecodeLegacyTaskEvent([]byte(payload))
+		return message.ID, event, err
+	}
+	return "", task.TaskEvent{}, fmt.Errorf("%w: entry without envelope", events.ErrInvalidEvent)
+}
+
+func (s *EventSubscriber) deadLetter(ctx context.Context, opts StreamOptions, stream eventStream, message redis.XMessage, reason string) {
+	log.Printf("Moving %s entry %s to %s: %s", stream.name, message.ID, stream.deadLetter, reason)
+	err := s.redisClient.DeadLetter(ctx, stream.name, opts.Group, stream.deadLetter, message, reason)
+	if err != nil {
+		log.Printf("Failed to dead-letter %s entry %s: %v", stream.name, message.ID, err)
+	}
+}
+
+// sleepCtx waits for d and reports false when ctx ended first
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
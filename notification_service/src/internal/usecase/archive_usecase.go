@@ -0,0 +1,125 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"notificationservice/src/internal/adaptors/redis"
+	"notificationservice/src/internal/core/notification"
+	"time"
+)
+
+const (
+	archiveBatchSize = 200
+	// archiveLease keeps other replicas off notifications while they are being archived
+	archiveLease = 5 * time.Minute
+	// defaultArchiveRange is searched when a search gives no start
+	defaultArchiveRange = 30 * 24 * time.Hour
+)
+
+var (
+	ErrArchiveDisabled = errors.New("Notification Archive Not Enabled")
+	ErrInvalidRange    = errors.New("Invalid Date Range")
+)
+
+// ArchiveUseCase moves notifications whose retention ran out from Redis to the archive and
+// searches it. Without an archive expired notifications are simply dropped.
+type ArchiveUseCase struct {
+	redisClient *redis.RedisClient
+	archive     notification.Archive
+}
+
+// NewArchiveUseCase takes a nil archive when archiving is off
+func NewArchiveUseCase(redisClient *redis.RedisClient, archive notification.Archive) *ArchiveUseCase {
+	return &ArchiveUseCase{
+		redisClient: redisClient,
+		archive:     archive,
+	}
+}
+
+// Run archives the expired notifications every interval until ctx is done
+func (uc *ArchiveUseCase) Run(ctx context.Context, interval time.Duration) {
+	if uc.archive == nil {
+		return
+	}
+	log.Println("Starting notification archiver...")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Notification archiver shutting down...")
+			return
+		case <-ticker.C:
+			uc.archiveExpired(ctx)
+		}
+	}
+}
+
+// archiveExpired saves the claimed notifications before removing them, one that fails to save
+// stays in Redis and is claimed again once its lease runs out
+func (uc *ArchiveUseCase) archiveExpired(ctx context.Context) {
+	for {
+		notifications, err := uc.redisClient.ClaimExpiredNotifications(ctx, time.Now(), archiveLease, archiveBatchSize)
+		if err != nil {
+			log.Printf("Error claiming expired notifications: %v", err)
+			return
+		}
+		if len(notifications) == 0 {
+			return
+		}
+		if err := uc.archive.Save(ctx, notifications); err != nil {
+			log.Printf("Error archiving %d notifications: %v", len(notifications), err)
+			return
+		}
+		if err := uc.redisClient.RemoveNotifications(ctx, notifications); err != nil {
+			log.Printf("Error removing archived notifications: %v", err)
+			return
+		}
+		log.Printf("Archived %d notifications", len(notifications))
+		if len(notifications) < archiveBatchSize {
+			return
+		}
+	}
+}
+
+// Search returns the archived notifications sent between from and to, newest first. userID zero
+// searches every user. A zero to is now, a zero from is 30 days before to.
+func (uc *ArchiveUseCase) Search(ctx context.Context, userID int, from time.Time, to time.Time, limit int) ([]notification.Notification, error) {
+	if uc.archive == nil {
+		return nil, ErrArchiveDisabled
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-defaultArchiveRange)
+	}
+	if !from.Before(to) {
+		return nil, ErrInvalidRange
+	}
+
+	notifications, err := uc.archive.Search(ctx, notification.ArchiveQuery{
+		UserID: userID,
+		From:   from,
+		To:     to,
+		Limit:  pageSize(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search archive: %v", err)
+	}
+	return notifications, nil
+}
+
+// DeleteUser removes the archived notifications of a deleted account
+func (uc *ArchiveUseCase) DeleteUser(ctx context.Context, userID int) error {
+	if uc.archive == nil {
+		return nil
+	}
+	if err := uc.archive.DeleteUser(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete archived notifications: %v", err)
+	}
+	return nil
+}
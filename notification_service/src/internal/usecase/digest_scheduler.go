@@ -0,0 +1,161 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"notificationservice/src/internal/adaptors/redis"
+	client "notificationservice/src/internal/adaptors/user_grpc_client"
+	"notificationservice/src/internal/core/notification"
+	"time"
+)
+
+const (
+	digestBatchSize = 50
+	// digestLease keeps other replicas off a user while their digest is built and sent
+	digestLease = 5 * time.Minute
+	// digestRetry is the wait before a digest that could not be sent is tried again
+	digestRetry = 5 * time.Minute
+)
+
+// DigestScheduler sends every user with a digest schedule one summary of the events waiting
+// since their last digest. The schedule and the waiting events live in Redis, so a restart
+// picks up where it left off, and each digest is marked before it is sent so it goes out once
+// even when replicas race or one dies mid-send.
+type DigestScheduler struct {
+	redisClient   *redis.RedisClient
+	userDirectory *client.UserDirectory
+	channel       notification.DigestChannel
+}
+
+func NewDigestScheduler(redisClient *redis.RedisClient, userDirectory *client.UserDirectory, channel notification.DigestChannel) *DigestScheduler {
+	return &DigestScheduler{
+		redisClient:   redisClient,
+		userDirectory: userDirectory,
+		channel:       channel,
+	}
+}
+
+// Run sends the due digests every interval until ctx is done
+func (s *DigestScheduler) Run(ctx context.Context, interval time.Duration) {
+	log.Println("Starting digest scheduler...")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Digest scheduler shutting down...")
+			return
+		case <-ticker.C:
+			s.sendDue(ctx)
+		}
+	}
+}
+
+func (s *DigestScheduler) sendDue(ctx context.Context) {
+	for {
+		userIDs, err := s.redisClient.ClaimDueDigests(ctx, time.Now(), digestLease, digestBatchSize)
+		if err != nil {
+			log.Printf("Error claiming digests: %v", err)
+			return
+		}
+		for _, userID := range userIDs {
+			s.send(ctx, userID)
+		}
+		if len(userIDs) < digestBatchSize {
+			return
+		}
+	}
+}
+
+// send sends the user's digest for the latest scheduled time and schedules the next one. When it
+// fails before the digest is rescheduled, the lease runs out and it is tried again.
+func (s *DigestScheduler) send(ctx context.Context, userID int) {
+	prefs, err := s.redisClient.GetPreferences(ctx, []int{userID})
+	if err != nil {
+		log.Printf("Error getting preferences of user %d: %v", userID, err)
+		return
+	}
+	schedule := prefs[userID].Digest
+	if schedule == nil {
+		if err := s.redisClient.UnscheduleDigest(ctx, userID); err != nil {
+			log.Printf("Error unscheduling digest of user %d: %v", userID, err)
+		}
+		return
+	}
+
+	now := time.Now()
+	until, err := schedule.Previous(now)
+	if err != nil {
+		log.Printf("Invalid digest schedule of user %d: %v", userID, err)
+		return
+	}
+	since, err := schedule.Previous(until.Add(-time.Second))
+	if err != nil {
+		log.Printf("Invalid digest schedule of user %d: %v", userID, err)
+		return
+	}
+
+	items, err := s.redisClient.GetDigestItems(ctx, userID)
+	if err != nil {
+		log.Printf("Error getting digest of user %d: %v", userID, err)
+		return
+	}
+	// events that arrived after the digest time wait for the next one
+	var included []notification.DigestItem
+	var ids []string
+	for _, item := range items {
+		if !item.Timestamp.After(until) {
+			included = append(included, item)
+			ids = append(ids, item.NotificationID)
+		}
+	}
+
+	if len(included) > 0 {
+		first, err := s.redisClient.MarkDigestSent(ctx, userID, until)
+		if err != nil {
+			log.Printf("Error marking digest of user %d: %v", userID, err)
+			return
+		}
+		// not first: another replica sent it, or began to and died, either way it is not sent again
+		if first {
+			digest := notification.BuildDigest(userID, *schedule, since, until, included, now)
+			if err := s.deliver(ctx, digest); err != nil {
+				log.Printf("Failed to send digest to user %d: %v", userID, err)
+				if err := s.redisClient.UnmarkDigestSent(ctx, userID, until); err != nil {
+					log.Printf("Error unmarking digest of user %d: %v", userID, err)
+					return
+				}
+				if err := s.redisClient.ScheduleDigest(ctx, userID, now.Add(digestRetry)); err != nil {
+					log.Printf("Error rescheduling digest of user %d: %v", userID, err)
+				}
+				return
+			}
+			log.Printf("Sent %s digest to user %d: %s", schedule.Frequency, userID, digest.Summary())
+		}
+		if err := s.redisClient.RemoveDigestItems(ctx, userID, ids...); err != nil {
+			log.Printf("Error clearing digest of user %d: %v", userID, err)
+			return
+		}
+	}
+
+	next, err := schedule.Next(now)
+	if err != nil {
+		log.Printf("Invalid digest schedule of user %d: %v", userID, err)
+		return
+	}
+	if err := s.redisClient.ScheduleDigest(ctx, userID, next); err != nil {
+		log.Printf("Error scheduling digest of user %d: %v", userID, err)
+	}
+}
+
+func (s *DigestScheduler) deliver(ctx context.Context, digest notification.Digest) error {
+	recipient, ok := s.userDirectory.Lookup(ctx, []int{digest.UserID})[digest.UserID]
+	if !ok {
+		return fmt.Errorf("user %d could not be looked up", digest.UserID)
+	}
+	sendCtx, cancel := context.WithTimeout(ctx, channelSendTimeout)
+	defer cancel()
+	return s.channel.SendDigest(sendCtx, recipient, digest)
+}
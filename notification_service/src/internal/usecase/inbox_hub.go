@@ -0,0 +1,120 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"notificationservice/src/internal/adaptors/redis"
+	"notificationservice/src/internal/core/notification"
+	"sync"
+)
+
+// inboxSubscriptionBuffer is how many notifications may wait for a slow stream before it is dropped
+const inboxSubscriptionBuffer = 32
+
+// InboxSubscription receives the notifications stored for one user while it is open. Closed is
+// closed when the hub dropped the subscription because it fell behind.
+type InboxSubscription struct {
+	Notifications <-chan notification.Notification
+	Closed        <-chan struct{}
+
+	userID        int
+	notifications chan notification.Notification
+	closed        chan struct{}
+	closeOnce     sync.Once
+}
+
+func (s *InboxSubscription) close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+}
+
+// InboxHub pushes newly stored notifications to the open streams of their recipients. Every
+// replica runs one, they all hear each notification through Redis whichever replica stored it.
+type InboxHub struct {
+	redisClient *redis.RedisClient
+
+	mu            sync.Mutex
+	subscriptions map[int]map[*InboxSubscription]struct{}
+}
+
+func NewInboxHub(redisClient *redis.RedisClient) *InboxHub {
+	return &InboxHub{
+		redisClient:   redisClient,
+		subscriptions: make(map[int]map[*InboxSubscription]struct{}),
+	}
+}
+
+// Run forwards inbox updates to the subscriptions until ctx is done
+func (h *InboxHub) Run(ctx context.Context) {
+	pubsub := h.redisClient.Subscribe(ctx, redis.InboxUpdatesChannel)
+	defer pubsub.Close()
+
+	for {
+		msg, err := pubsub.ReceiveMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Println("Inbox hub shutting down...")
+				return
+			}
+			log.Printf("Error receiving inbox update: %v", err)
+			continue
+		}
+
+		var notif notification.Notification
+		if err := json.Unmarshal([]byte(msg.Payload), &notif); err != nil {
+			log.Printf("Failed to unmarshal inbox update: %v", err)
+			continue
+		}
+		h.dispatch(notif)
+	}
+}
+
+// Subscribe opens a subscription to the user's new notifications, it must be closed with Unsubscribe
+func (h *InboxHub) Subscribe(userID int) *InboxSubscription {
+	notifications := make(chan notification.Notification, inboxSubscriptionBuffer)
+	closed := make(chan struct{})
+	sub := &InboxSubscription{
+		Notifications: notifications,
+		Closed:        closed,
+		userID:        userID,
+		notifications: notifications,
+		closed:        closed,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscriptions[userID] == nil {
+		h.subscriptions[userID] = make(map[*InboxSubscription]struct{})
+	}
+	h.subscriptions[userID][sub] = struct{}{}
+	return sub
+}
+
+func (h *InboxHub) Unsubscribe(sub *InboxSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscriptions[sub.userID], sub)
+	if len(h.subscriptions[sub.userID]) == 0 {
+		delete(h.subscriptions, sub.userID)
+	}
+	sub.close()
+}
+
+// dispatch hands the notification to every stream of its recipient. A stream that can't keep up
+// is dropped rather than holding up the others, its client reconnects and resumes from history.
+func (h *InboxHub) dispatch(notif notification.Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscriptions[notif.UserID] {
+		select {
+		case sub.notifications <- notif:
+		default:
+			log.Printf("Dropping slow notification stream of user %d", notif.UserID)
+			delete(h.subscriptions[notif.UserID], sub)
+			sub.close()
+		}
+	}
+	if len(h.subscriptions[notif.UserID]) == 0 {
+		delete(h.subscriptions, notif.UserID)
+	}
+}
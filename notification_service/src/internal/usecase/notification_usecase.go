@@ -2,193 +2,546 @@ package usecase
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"notificationservice/src/internal/adaptors/redis"
+	client "notificationservice/src/internal/adaptors/user_grpc_client"
 	"notificationservice/src/internal/core/notification"
 	"notificationservice/src/internal/core/task"
+	"notificationservice/src/internal/core/user"
 	"time"
 
 	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
 )
 
 type NotificationUseCase struct {
-	redisClient *redis.RedisClient
+	redisClient    *redis.RedisClient
+	userDirectory  *client.UserDirectory
+	coalesceWindow time.Duration
+	channels       []notification.Channel
 }
 
-func NewNotificationUseCase(redisClient *redis.RedisClient) *NotificationUseCase {
+// NewNotificationUseCase stores notifications in the inbox and also sends them over channels,
+// whose recipients are looked up in userDirectory. Updates of a task by the same actor within
+// coalesceWindow are merged into one notification, zero turns that off.
+func NewNotificationUseCase(redisClient *redis.RedisClient, userDirectory *client.UserDirectory, coalesceWindow time.Duration, channels ...notification.Channel) *NotificationUseCase {
 	return &NotificationUseCase{
-		redisClient: redisClient,
+		redisClient:    redisClient,
+		userDirectory:  userDirectory,
+		coalesceWindow: coalesceWindow,
+		channels:       channels,
 	}
 }
 
-func (uc *NotificationUseCase) ProcessTaskEvent(ctx context.Context, event task.TaskEvent) error {
-	// Create notification for assigned user
-	notif := notification.Notification{
-		ID:         uuid.New().String(),
-		TaskID:     event.TaskID,
-		Action:     event.EventType,
-		TaskName:   event.TaskName,
-		UserID:     event.AssignedTo, // User who will receive notification
-		AssignedBy: event.AssignedBy, // User who assigned the task (logged-in user)
-		Message:    uc.generateMessage(event.EventType, event.TaskName, event.AssignedTo),
-		Timestamp:  time.Now(),
-	}
-
-	// Store notification in Redis
-	notificationJSON, err := json.Marshal(notif)
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// ErrNotificationNotFound is returned when the notification does not exist or belongs to another user
+var ErrNotificationNotFound = errors.New("Notification Not Found")
+
+// ErrInvalidCursor is returned for a page cursor that was not handed out by a previous page
+var ErrInvalidCursor = redis.ErrInvalidCursor
+
+// ProcessTaskEvent stores an inbox entry for every user interested in the task and sends it over
+// the channels they chose, as far as their preferences let the event through. An event that was
+// processed before is dropped, so a redelivered event notifies nobody twice.
+func (uc *NotificationUseCase) ProcessTaskEvent(ctx context.Context, eventID string, event task.TaskEvent) error {
+	processed, err := uc.redisClient.EventProcessed(ctx, eventID)
 	if err != nil {
-		return fmt.Errorf("failed to marshal notification: %v", err)
+		return fmt.Errorf("failed to check event: %v", err)
 	}
+	if processed {
+		log.Printf("Skipping task event %s, it was processed before", eventID)
+		return nil
+	}
+
+	actorID := event.ActorID
+	if actorID == 0 {
+		actorID = event.AssignedBy
+	}
+	changes := taskChanges(event.Before, event.After)
+	message := renderTaskMessage(event, changes)
+	now := time.Now()
 
-	notificationKey := fmt.Sprintf("notification:%s", notif.ID)
-	err = uc.redisClient.StoreNotification(ctx, notificationKey, notificationJSON)
+	recipients := taskRecipients(event)
+	prefs, err := uc.redisClient.GetPreferences(ctx, recipients)
 	if err != nil {
-		return fmt.Errorf("failed to store notification: %v", err)
+		return fmt.Errorf("failed to get preferences: %v", err)
 	}
 
-	log.Printf("Notification stored for user %d: %s (assigned by user %d)", notif.UserID, notif.Message, notif.AssignedBy)
+	var outgoing []notification.Notification
+	for _, recipient := range recipients {
+		if !prefs[recipient].Wants(event.EventType, event.TaskID) {
+			continue
+		}
+		notif := notification.Notification{
+			ID:         fmt.Sprintf("%s-%d", eventID, recipient),
+			TaskID:     event.TaskID,
+			Action:     event.EventType,
+			TaskName:   event.TaskName,
+			UserID:     recipient,
+			AssignedBy: event.AssignedBy,
+			AssignedTo: event.AssignedTo,
+			ActorID:    actorID,
+			Message:    message,
+			Changes:    changes,
+			Timestamp:  now,
+		}
+		inApp := prefs[recipient].UsesChannel(notification.ChannelInApp)
+
+		coalesced := uc.coalesceWindow > 0 && event.EventType == task.EventTaskUpdated && actorID != 0
+		merged := false
+		if coalesced {
+			notif, merged, err = uc.mergeBurst(ctx, actorID, notif, event, inApp)
+			if err != nil {
+				return err
+			}
+		}
+
+		if inApp {
+			if merged {
+				err = uc.redisClient.ReplaceNotification(ctx, notif)
+			} else {
+				err = uc.redisClient.StoreNotification(ctx, notif)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to store notification: %v", err)
+			}
+			log.Printf("Notification stored for user %d: %s (by user %d)", notif.UserID, notif.Message, notif.ActorID)
+		}
+		// the actor made the change, the inbox records it but it is not worth an email
+		if recipient == actorID {
+			continue
+		}
+		if uc.digested(prefs[recipient]) {
+			if err := uc.redisClient.AddDigestItem(ctx, recipient, digestItem(notif, event)); err != nil {
+				return fmt.Errorf("failed to queue digest item: %v", err)
+			}
+		}
+		if coalesced {
+			// sent when the burst closes, with every update merged into it
+			if err := uc.queueBurst(ctx, notif, merged); err != nil {
+				return err
+			}
+			continue
+		}
+		outgoing = append(outgoing, notif)
+	}
+
+	uc.deliver(ctx, outgoing, prefs)
+	if err := uc.redisClient.MarkEventProcessed(ctx, eventID); err != nil {
+		return fmt.Errorf("failed to mark event processed: %v", err)
+	}
 	return nil
 }
 
-func (uc *NotificationUseCase) GetMostRecentNotification(ctx context.Context) (*notification.Notification, error) {
-	// Get all notification keys
-	keys, err := uc.redisClient.GetAllNotificationKeys(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get notification keys: %v", err)
+// mergeBurst merges an update into the open burst of the task, actor and recipient, or opens a
+// burst with it. Changes of a merged notification run from before the first update to after the
+// last, fields changed back and forth drop out. A burst whose notification was already read is
+// not changed under the reader, the update opens a new one.
+func (uc *NotificationUseCase) mergeBurst(ctx context.Context, actorID int, notif notification.Notification, event task.TaskEvent, inApp bool) (notification.Notification, bool, error) {
+	burst, err := uc.redisClient.GetBurst(ctx, event.TaskID, actorID, notif.UserID)
+	if err != nil && !errors.Is(err, goredis.Nil) {
+		return notif, false, fmt.Errorf("failed to get burst: %v", err)
 	}
-
-	if len(keys) == 0 {
-		return nil, nil
+	if err == nil && inApp {
+		stored, err := uc.redisClient.GetNotification(ctx, burst.Notification.ID)
+		if err == nil && stored.Read {
+			burst = notification.Burst{}
+		}
 	}
 
-	var mostRecentNotification *notification.Notification
+	if burst.Notification.ID == "" || burst.Notification.ID == notif.ID {
+		burst = notification.Burst{Notification: notif, Before: event.Before}
+		if err := uc.redisClient.OpenBurst(ctx, actorID, burst, uc.coalesceWindow); err != nil {
+			return notif, false, fmt.Errorf("failed to open burst: %v", err)
+		}
+		return notif, false, nil
+	}
 
-	// Find the most recent notification globally
-	for _, key := range keys {
-		notificationJSON, err := uc.redisClient.GetNotification(ctx, key)
-		if err != nil {
-			continue
+	merged := burst.Notification
+	merged.TaskName = notif.TaskName
+	merged.AssignedBy = notif.AssignedBy
+	merged.AssignedTo = notif.AssignedTo
+	merged.Changes = taskChanges(burst.Before, event.After)
+	merged.Message = renderTaskMessage(event, merged.Changes)
+	merged.Timestamp = notif.Timestamp
+	merged.Read = false
+	merged.ReadAt = nil
+	burst.Notification = merged
+
+	updated, err := uc.redisClient.UpdateBurst(ctx, actorID, burst)
+	if err != nil {
+		return notif, false, fmt.Errorf("failed to update burst: %v", err)
+	}
+	if !updated {
+		// it closed meanwhile, the update starts the next one
+		burst = notification.Burst{Notification: notif, Before: event.Before}
+		if err := uc.redisClient.OpenBurst(ctx, actorID, burst, uc.coalesceWindow); err != nil {
+			return notif, false, fmt.Errorf("failed to open burst: %v", err)
 		}
+		return notif, false, nil
+	}
+	log.Printf("Merged task event into notification %s", merged.ID)
+	return merged, true, nil
+}
 
-		var notif notification.Notification
-		err = json.Unmarshal(notificationJSON, &notif)
+// queueBurst holds the notification of a burst back until the burst closes
+func (uc *NotificationUseCase) queueBurst(ctx context.Context, notif notification.Notification, merged bool) error {
+	if merged {
+		updated, err := uc.redisClient.UpdateOutgoing(ctx, notif)
 		if err != nil {
-			continue
+			return fmt.Errorf("failed to queue notification: %v", err)
 		}
-
-		// If this is the first notification, or if this notification is more recent
-		if mostRecentNotification == nil || notif.Timestamp.After(mostRecentNotification.Timestamp) {
-			mostRecentNotification = &notif
+		if updated {
+			return nil
 		}
+		// the first one already went out, the merged one follows after another window
 	}
+	if err := uc.redisClient.QueueOutgoing(ctx, notif, time.Now().Add(uc.coalesceWindow)); err != nil {
+		return fmt.Errorf("failed to queue notification: %v", err)
+	}
+	return nil
+}
 
-	return mostRecentNotification, nil
+// SendBursts sends the notifications of closed bursts and ended quiet hours every interval until
+// ctx is done
+func (uc *NotificationUseCase) SendBursts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			uc.sendDueBursts(ctx)
+		}
+	}
 }
 
-func (uc *NotificationUseCase) GetAllNotifications(ctx context.Context, limit int) ([]notification.Notification, error) {
-	// Get all notification keys
-	keys, err := uc.redisClient.GetAllNotificationKeys(ctx)
+func (uc *NotificationUseCase) sendDueBursts(ctx context.Context) {
+	ids, err := uc.redisClient.ClaimDueOutgoing(ctx, time.Now(), time.Minute, maxPageSize)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get notification keys: %v", err)
+		log.Printf("Error claiming waiting notifications: %v", err)
+		return
 	}
 
 	var notifications []notification.Notification
-
-	// Get all notifications (no complex filtering or sorting)
-	for _, key := range keys {
-		notificationJSON, err := uc.redisClient.GetNotification(ctx, key)
-		if err != nil {
+	var userIDs []int
+	for _, id := range ids {
+		notif, err := uc.redisClient.TakeOutgoing(ctx, id)
+		if errors.Is(err, goredis.Nil) {
+			continue
+		} else if err != nil {
+			log.Printf("Error taking waiting notification %s: %v", id, err)
 			continue
 		}
+		notifications = append(notifications, notif)
+		userIDs = append(userIDs, notif.UserID)
+	}
+	if len(notifications) == 0 {
+		return
+	}
 
-		var notif notification.Notification
-		err = json.Unmarshal(notificationJSON, &notif)
-		if err != nil {
-			continue
+	// preferences are read now, a channel turned off during the window stays off
+	prefs, err := uc.redisClient.GetPreferences(ctx, userIDs)
+	if err != nil {
+		log.Printf("Error getting preferences: %v", err)
+		return
+	}
+	uc.deliver(ctx, notifications, prefs)
+}
+
+// digested tells whether the user gets task events in digests rather than one email each
+func (uc *NotificationUseCase) digested(p notification.Preferences) bool {
+	if p.Digest == nil {
+		return false
+	}
+	for _, channel := range uc.channels {
+		if _, ok := channel.(notification.DigestChannel); ok && p.UsesChannel(channel.Name()) {
+			return true
 		}
+	}
+	return false
+}
 
-		notifications = append(notifications, notif)
+// digestItem keeps what a digest shows of the event, with the task as the event left it
+func digestItem(notif notification.Notification, event task.TaskEvent) notification.DigestItem {
+	item := notification.DigestItem{
+		NotificationID: notif.ID,
+		TaskID:         notif.TaskID,
+		TaskName:       notif.TaskName,
+		Action:         notif.Action,
+		Message:        notif.Message,
+		Timestamp:      notif.Timestamp,
+	}
+	if event.AssignedTo == notif.UserID {
+		item.Assigned = event.EventType == task.EventTaskCreated ||
+			(event.Before != nil && event.After != nil && event.Before.AssignedTo != notif.UserID)
 	}
+	snapshot := event.After
+	if snapshot == nil {
+		snapshot = event.Before
+	}
+	if snapshot != nil {
+		item.Status = snapshot.Status
+		item.Deadline = snapshot.Deadline
+	}
+	return item
+}
 
-	return notifications, nil
+// taskRecipients lists the assignee, the assigner and the watchers of the task, each once
+func taskRecipients(event task.TaskEvent) []int {
+	candidates := append([]int{event.AssignedTo, event.AssignedBy}, event.Watchers...)
+
+	seen := make(map[int]bool, len(candidates))
+	recipients := make([]int, 0, len(candidates))
+	for _, userID := range candidates {
+		if userID == 0 || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		recipients = append(recipients, userID)
+	}
+	return recipients
 }
 
-func (uc *NotificationUseCase) GetMyNotifications(ctx context.Context, assignedBy int, limit int) ([]notification.Notification, error) {
-	// Get all notification keys
-	keys, err := uc.redisClient.GetAllNotificationKeys(ctx)
+// ProcessUserEvent tells the account owner about a security event on their account. Security
+// events are sent whatever the owner's preferences say.
+func (uc *NotificationUseCase) ProcessUserEvent(ctx context.Context, eventID string, event user.UserEvent) error {
+	// a deleted account has nobody left to tell, its notifications are removed instead
+	if event.EventType == user.EventUserDeleted {
+		return uc.DeleteUserNotifications(ctx, event.UserID)
+	}
+
+	processed, err := uc.redisClient.EventProcessed(ctx, eventID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get notification keys: %v", err)
+		return fmt.Errorf("failed to check event: %v", err)
+	}
+	if processed {
+		log.Printf("Skipping user event %s, it was processed before", eventID)
+		return nil
 	}
 
-	var notifications []notification.Notification
+	notif := notification.Notification{
+		ID:        uuid.New().String(),
+		Action:    event.EventType,
+		UserID:    event.UserID,
+		Message:   renderUserMessage(event),
+		Timestamp: time.Now(),
+	}
 
-	// Simple filter by assignedBy (no complex sorting)
-	for _, key := range keys {
-		notificationJSON, err := uc.redisClient.GetNotification(ctx, key)
-		if err != nil {
-			continue
+	if err := uc.redisClient.StoreNotification(ctx, notif); err != nil {
+		return fmt.Errorf("failed to store notification: %v", err)
+	}
+
+	log.Printf("Notification stored for user %d: %s", notif.UserID, notif.Message)
+	uc.deliver(ctx, []notification.Notification{notif}, nil)
+	if err := uc.redisClient.MarkEventProcessed(ctx, eventID); err != nil {
+		return fmt.Errorf("failed to mark event processed: %v", err)
+	}
+	return nil
+}
+
+// channelSendTimeout bounds one delivery over a channel
+const channelSendTimeout = 15 * time.Second
+
+// deliver sends notifications over the channels their recipients chose in prefs. During quiet
+// hours they are queued until the hours end, SendBursts then delivers them with the preferences
+// of that time. Channels that send digests are left to the DigestScheduler for users with a
+// digest. Recipients missing from prefs get every channel. The inbox already has the
+// notifications, so a failed delivery is logged and not retried, and a redelivered event may
+// send them again.
+func (uc *NotificationUseCase) deliver(ctx context.Context, notifications []notification.Notification, prefs map[int]notification.Preferences) {
+	now := time.Now()
+	channelsOf := func(userID int) []notification.Channel {
+		p, ok := prefs[userID]
+		if !ok {
+			return uc.channels
 		}
+		var chosen []notification.Channel
+		for _, channel := range uc.channels {
+			if _, digests := channel.(notification.DigestChannel); digests && p.Digest != nil {
+				continue
+			}
+			if p.UsesChannel(channel.Name()) {
+				chosen = append(chosen, channel)
+			}
+		}
+		return chosen
+	}
 
-		var notif notification.Notification
-		err = json.Unmarshal(notificationJSON, &notif)
-		if err != nil {
+	var ids []int
+	var sending []notification.Notification
+	for _, notif := range notifications {
+		if len(channelsOf(notif.UserID)) == 0 {
 			continue
 		}
+		if until, quiet := prefs[notif.UserID].QuietUntil(now); quiet {
+			if err := uc.redisClient.QueueOutgoing(ctx, notif, until); err != nil {
+				log.Printf("Failed to hold back notification %s for user %d: %v", notif.ID, notif.UserID, err)
+				continue
+			}
+			log.Printf("Holding back notification %s for user %d until %s", notif.ID, notif.UserID, until.Format(time.RFC3339))
+			continue
+		}
+		ids = append(ids, notif.UserID)
+		sending = append(sending, notif)
+	}
+	if len(ids) == 0 {
+		return
+	}
+	recipients := uc.userDirectory.Lookup(ctx, ids)
 
-		// Simple filter - add if assigned by matches
-		if notif.AssignedBy == assignedBy {
-			notifications = append(notifications, notif)
+	for _, notif := range sending {
+		channels := channelsOf(notif.UserID)
+		recipient, ok := recipients[notif.UserID]
+		if !ok {
+			log.Printf("Not sending notification %s: user %d could not be looked up", notif.ID, notif.UserID)
+			continue
 		}
+		for _, channel := range channels {
+			sendCtx, cancel := context.WithTimeout(ctx, channelSendTimeout)
+			err := channel.Send(sendCtx, recipient, notif)
+			cancel()
+			if err != nil {
+				log.Printf("Failed to send notification %s to user %d by %s: %v", notif.ID, notif.UserID, channel.Name(), err)
+				continue
+			}
+			log.Printf("Sent notification %s to user %d by %s", notif.ID, notif.UserID, channel.Name())
+		}
+	}
+}
+
+// DeleteUserNotifications removes the inbox, the preferences and the pending digest of the user
+func (uc *NotificationUseCase) DeleteUserNotifications(ctx context.Context, userID int) error {
+	deleted, err := uc.redisClient.DeleteUserNotifications(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete notifications: %v", err)
+	}
+	if err := uc.redisClient.DeletePreferences(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete preferences: %v", err)
+	}
+	if err := uc.redisClient.UnscheduleDigest(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete digest: %v", err)
 	}
 
-	return notifications, nil
+	log.Printf("Deleted %d notifications of deleted user %d", deleted, userID)
+	return nil
 }
 
-func (uc *NotificationUseCase) GetMyRecentNotification(ctx context.Context, assignedBy int) (*notification.Notification, error) {
-	// Get all notification keys
-	keys, err := uc.redisClient.GetAllNotificationKeys(ctx)
+func (uc *NotificationUseCase) GetMostRecentNotification(ctx context.Context) (*notification.Notification, error) {
+	page, err := uc.redisClient.ListAllNotifications(ctx, "", 1)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get notification keys: %v", err)
+		return nil, fmt.Errorf("failed to get notifications: %v", err)
 	}
+	return firstOf(page), nil
+}
 
-	var mostRecentNotification *notification.Notification
+// GetAllNotifications pages through the notifications of every user, newest first
+func (uc *NotificationUseCase) GetAllNotifications(ctx context.Context, cursor string, limit int) (notification.Page, error) {
+	page, err := uc.redisClient.ListAllNotifications(ctx, cursor, pageSize(limit))
+	return page, listError(err)
+}
 
-	// Find the most recent notification where assignedBy matches
-	for _, key := range keys {
-		notificationJSON, err := uc.redisClient.GetNotification(ctx, key)
-		if err != nil {
-			continue
-		}
+// GetMyNotifications pages through the inbox of the user, only the unread entries when unreadOnly is set
+func (uc *NotificationUseCase) GetMyNotifications(ctx context.Context, userID int, cursor string, limit int, unreadOnly bool) (notification.Page, error) {
+	var page notification.Page
+	var err error
+	if unreadOnly {
+		page, err = uc.redisClient.ListUnreadNotifications(ctx, userID, cursor, pageSize(limit))
+	} else {
+		page, err = uc.redisClient.ListUserNotifications(ctx, userID, cursor, pageSize(limit))
+	}
+	return page, listError(err)
+}
 
-		var notif notification.Notification
-		err = json.Unmarshal(notificationJSON, &notif)
-		if err != nil {
-			continue
-		}
+func (uc *NotificationUseCase) GetMyRecentNotification(ctx context.Context, userID int) (*notification.Notification, error) {
+	page, err := uc.redisClient.ListUserNotifications(ctx, userID, "", 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notifications: %v", err)
+	}
+	return firstOf(page), nil
+}
 
-		// Check if this notification is from the logged-in user (assignedBy)
-		if notif.AssignedBy == assignedBy {
-			// If this is the first match, or if this notification is more recent
-			if mostRecentNotification == nil || notif.Timestamp.After(mostRecentNotification.Timestamp) {
-				mostRecentNotification = &notif
-			}
-		}
+// GetMyNotificationsSince returns the notifications stored for the user after the stream position,
+// oldest first, so a reconnecting stream can catch up
+func (uc *NotificationUseCase) GetMyNotificationsSince(ctx context.Context, userID int, position string) ([]notification.Notification, error) {
+	notifications, err := uc.redisClient.ListUserNotificationsAfter(ctx, userID, position, maxPageSize)
+	return notifications, listError(err)
+}
+
+// StreamPosition identifies the notification in a stream, it is what GetMyNotificationsSince resumes from
+func StreamPosition(notif notification.Notification) string {
+	return redis.StreamPosition(notif)
+}
+
+// MarkRead marks one notification of the user's inbox as read, it is left out of their next digest
+func (uc *NotificationUseCase) MarkRead(ctx context.Context, userID int, notificationID string) error {
+	notif, err := uc.redisClient.GetNotification(ctx, notificationID)
+	if err != nil || notif.UserID != userID {
+		return ErrNotificationNotFound
+	}
+	if _, err := uc.redisClient.MarkNotificationsRead(ctx, userID, []string{notificationID}, time.Now()); err != nil {
+		return fmt.Errorf("failed to update notification: %v", err)
+	}
+	if err := uc.redisClient.RemoveDigestItems(ctx, userID, notificationID); err != nil {
+		return fmt.Errorf("failed to update digest: %v", err)
 	}
+	return nil
+}
+
+// MarkAllRead marks every unread notification of the user's inbox as read and returns how many changed
+func (uc *NotificationUseCase) MarkAllRead(ctx context.Context, userID int) (int, error) {
+	ids, err := uc.redisClient.UnreadNotificationIDs(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get unread notifications: %v", err)
+	}
+	marked, err := uc.redisClient.MarkNotificationsRead(ctx, userID, ids, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to update notifications: %v", err)
+	}
+	if err := uc.redisClient.RemoveDigestItems(ctx, userID, ids...); err != nil {
+		return 0, fmt.Errorf("failed to update digest: %v", err)
+	}
+	return marked, nil
+}
 
-	return mostRecentNotification, nil
+// UnreadCount returns the number of unread notifications in the user's inbox
+func (uc *NotificationUseCase) UnreadCount(ctx context.Context, userID int) (int, error) {
+	count, err := uc.redisClient.CountUnread(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %v", err)
+	}
+	return int(count), nil
+}
+
+// pageSize keeps a requested page size between 1 and maxPageSize
+func pageSize(limit int) int {
+	if limit <= 0 {
+		return defaultPageSize
+	}
+	if limit > maxPageSize {
+		return maxPageSize
+	}
+	return limit
+}
+
+func listError(err error) error {
+	if err == nil || errors.Is(err, ErrInvalidCursor) {
+		return err
+	}
+	return fmt.Errorf("failed to get notifications: %v", err)
 }
 
-func (uc *NotificationUseCase) generateMessage(action, taskName string, assignedTo int) string {
-	switch action {
-	case "task_created":
-		return fmt.Sprintf("Task '%s' assigned to user %d", taskName, assignedTo)
-	case "task_updated":
-		return fmt.Sprintf("Task '%s' updated (assigned to user %d)", taskName, assignedTo)
-	case "task_deleted":
-		return fmt.Sprintf("Task '%s' deleted (was assigned to user %d)", taskName, assignedTo)
-	default:
-		return fmt.Sprintf("Action '%s' performed on task '%s' (assigned to user %d)", action, taskName, assignedTo)
+func firstOf(page notification.Page) *notification.Notification {
+	if len(page.Notifications) == 0 {
+		return nil
 	}
+	return &page.Notifications[0]
 }
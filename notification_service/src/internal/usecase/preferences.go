@@ -0,0 +1,135 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"events"
+	"fmt"
+	"log"
+	"notificationservice/src/internal/core/notification"
+	"time"
+)
+
+// maxMutedTasks caps the mute list, it is checked for every event the user could receive
+const maxMutedTasks = 500
+
+// ErrInvalidPreferences is returned for preferences that can't be used, wrapped with the reason
+var ErrInvalidPreferences = errors.New("Invalid Preferences")
+
+// PreferencesInput is what a user sends to change their preferences, nil fields are left as they
+// are. An empty quiet_hours or digest object turns quiet hours or digests off.
+type PreferencesInput struct {
+	Digest     *notification.DigestSchedule `json:"digest"`
+	EventTypes *[]string                    `json:"event_types"`
+	Channels   *[]string                    `json:"channels"`
+	QuietHours *notification.QuietHours     `json:"quiet_hours"`
+	MutedTasks *[]int                       `json:"muted_tasks"`
+}
+
+// GetPreferences returns the preferences of the user, or the defaults when they never set any
+func (uc *NotificationUseCase) GetPreferences(ctx context.Context, userID int) (notification.Preferences, error) {
+	prefs, err := uc.redisClient.GetPreferences(ctx, []int{userID})
+	if err != nil {
+		return notification.Preferences{}, fmt.Errorf("failed to get preferences: %v", err)
+	}
+	return prefs[userID], nil
+}
+
+// UpdatePreferences checks the input and saves it over the user's preferences
+func (uc *NotificationUseCase) UpdatePreferences(ctx context.Context, userID int, input PreferencesInput) (notification.Preferences, error) {
+	prefs, err := uc.GetPreferences(ctx, userID)
+	if err != nil {
+		return notification.Preferences{}, err
+	}
+
+	if input.EventTypes != nil {
+		eventTypes := []string{}
+		for _, eventType := range *input.EventTypes {
+			if !events.IsTaskEventType(eventType) {
+				return notification.Preferences{}, fmt.Errorf("%w: unknown event type %q", ErrInvalidPreferences, eventType)
+			}
+			if !containsString(eventTypes, eventType) {
+				eventTypes = append(eventTypes, eventType)
+			}
+		}
+		prefs.EventTypes = eventTypes
+	}
+	if input.Channels != nil {
+		channels := []string{}
+		for _, channel := range *input.Channels {
+			if !containsString(notification.AllChannels, channel) {
+				return notification.Preferences{}, fmt.Errorf("%w: unknown channel %q", ErrInvalidPreferences, channel)
+			}
+			if !containsString(channels, channel) {
+				channels = append(channels, channel)
+			}
+		}
+		prefs.Channels = channels
+	}
+	if input.QuietHours != nil {
+		if *input.QuietHours == (notification.QuietHours{}) {
+			prefs.QuietHours = nil
+		} else {
+			start, end, _, err := input.QuietHours.Parse()
+			if err != nil {
+				return notification.Preferences{}, fmt.Errorf("%w: quiet hours: %v", ErrInvalidPreferences, err)
+			}
+			if start == end {
+				return notification.Preferences{}, fmt.Errorf("%w: quiet hours must not start and end at the same time", ErrInvalidPreferences)
+			}
+			quiet := *input.QuietHours
+			prefs.QuietHours = &quiet
+		}
+	}
+	if input.Digest != nil {
+		if *input.Digest == (notification.DigestSchedule{}) {
+			prefs.Digest = nil
+		} else {
+			if err := input.Digest.Validate(); err != nil {
+				return notification.Preferences{}, fmt.Errorf("%w: digest: %v", ErrInvalidPreferences, err)
+			}
+			digest := *input.Digest
+			prefs.Digest = &digest
+		}
+	}
+	if input.MutedTasks != nil {
+		muted := []int{}
+		for _, taskID := range *input.MutedTasks {
+			if taskID <= 0 {
+				return notification.Preferences{}, fmt.Errorf("%w: invalid task id %d", ErrInvalidPreferences, taskID)
+			}
+			if !containsInt(muted, taskID) {
+				muted = append(muted, taskID)
+			}
+		}
+		if len(muted) > maxMutedTasks {
+			return notification.Preferences{}, fmt.Errorf("%w: at most %d tasks can be muted", ErrInvalidPreferences, maxMutedTasks)
+		}
+		prefs.MutedTasks = muted
+	}
+	prefs.UpdatedAt = time.Now()
+
+	if err := uc.redisClient.SavePreferences(ctx, prefs); err != nil {
+		return notification.Preferences{}, fmt.Errorf("failed to save preferences: %v", err)
+	}
+	if input.Digest != nil {
+		// events waiting for a digest that was turned off are left in the inbox only
+		if err := uc.scheduleDigest(ctx, prefs); err != nil {
+			return notification.Preferences{}, fmt.Errorf("failed to schedule digest: %v", err)
+		}
+	}
+	log.Printf("User %d updated notification preferences", userID)
+	return prefs, nil
+}
+
+// scheduleDigest sets when the user's next digest goes out, or stops their digests
+func (uc *NotificationUseCase) scheduleDigest(ctx context.Context, prefs notification.Preferences) error {
+	if prefs.Digest == nil {
+		return uc.redisClient.UnscheduleDigest(ctx, prefs.UserID)
+	}
+	next, err := prefs.Digest.Next(time.Now())
+	if err != nil {
+		return err
+	}
+	return uc.redisClient.ScheduleDigest(ctx, prefs.UserID, next)
+}
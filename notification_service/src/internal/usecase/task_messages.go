@@ -0,0 +1,101 @@
+package usecase
+
+import (
+	"fmt"
+	"log"
+	"notificationservice/src/internal/core/notification"
+	"notificationservice/src/internal/core/task"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// taskMessages holds one template per task event type, an update lists what it changed when
+// the event carries the task before and after it
+var taskMessages = template.Must(template.New("task").Parse(`
+{{- define "task_created"}}Task '{{.TaskName}}' assigned to {{.AssignedTo}}{{end}}
+
+{{- define "task_updated"}}Task '{{.TaskName}}' updated
+	{{- if .Changes}}: {{range $i, $change := .Changes}}{{if $i}}, {{end}}{{template "change" $change}}{{end}}
+	{{- else}} (assigned to {{.AssignedTo}}){{end}}
+{{- end}}
+
+{{- define "task_deleted"}}Task '{{.TaskName}}' deleted (was assigned to {{.AssignedTo}}){{end}}
+
+{{- define "default"}}Action '{{.Action}}' performed on task '{{.TaskName}}' (assigned to {{.AssignedTo}}){{end}}
+
+{{- define "change"}}
+	{{- if eq .Field "name"}}renamed from '{{.From}}'
+	{{- else if eq .Field "description"}}description updated
+	{{- else if eq .Field "deadline"}}deadline moved from {{.From}} to {{.To}}
+	{{- else if eq .Field "assigned_to"}}reassigned from {{.From}} to {{.To}}
+	{{- else}}{{.Field}} changed from {{.From}} to {{.To}}
+	{{- end}}
+{{- end}}`))
+
+type taskMessageData struct {
+	Action     string
+	TaskName   string
+	AssignedTo string
+	Changes    []notification.Change
+}
+
+func renderTaskMessage(event task.TaskEvent, changes []notification.Change) string {
+	name := event.EventType
+	if taskMessages.Lookup(name) == nil {
+		name = "default"
+	}
+
+	var message strings.Builder
+	err := taskMessages.ExecuteTemplate(&message, name, taskMessageData{
+		Action:     event.EventType,
+		TaskName:   event.TaskName,
+		AssignedTo: userLabel(event.AssignedToName, event.AssignedTo),
+		Changes:    changes,
+	})
+	if err != nil {
+		log.Printf("Failed to render %s message: %v", event.EventType, err)
+		return fmt.Sprintf("Task '%s' changed", event.TaskName)
+	}
+	return message.String()
+}
+
+// taskChanges lists the fields that differ between the snapshots, nil when either is missing
+func taskChanges(before *task.TaskSnapshot, after *task.TaskSnapshot) []notification.Change {
+	if before == nil || after == nil {
+		return nil
+	}
+
+	var changes []notification.Change
+	add := func(field string, from string, to string) {
+		if from != to {
+			changes = append(changes, notification.Change{Field: field, From: from, To: to})
+		}
+	}
+	add("name", before.Name, after.Name)
+	add("status", before.Status, after.Status)
+	add("priority", strconv.Itoa(before.Priority), strconv.Itoa(after.Priority))
+	add("deadline", formatDeadline(before.Deadline), formatDeadline(after.Deadline))
+	add("description", before.Description, after.Description)
+	if before.AssignedTo != after.AssignedTo {
+		changes = append(changes, notification.Change{
+			Field: "assigned_to",
+			From:  userLabel(before.AssignedToName, before.AssignedTo),
+			To:    userLabel(after.AssignedToName, after.AssignedTo),
+		})
+	}
+	return changes
+}
+
+func formatDeadline(deadline time.Time) string {
+	return deadline.UTC().Format("Mon 2 Jan 15:04")
+}
+
+// userLabel shows the display name carried by the event, or the id when the name is unknown
+func userLabel(name string, userID int) string {
+	if name != "" {
+		return name
+	}
+	return fmt.Sprintf("user %d", userID)
+}
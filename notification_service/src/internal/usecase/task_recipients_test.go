@@ -0,0 +1,26 @@
+package usecase
+
+import (
+	"notificationservice/src/internal/core/task"
+	"slices"
+	"testing"
+)
+
+func TestTaskRecipientsIncludeWatchers(t *testing.T) {
+	// alice assigned the task to bob and added carol as a watcher, bob changed it
+	const alice, bob, carol = 1, 2, 3
+	event := task.TaskEvent{
+		EventType:  task.EventTaskUpdated,
+		TaskID:     10,
+		TaskName:   "Plan sprint",
+		AssignedBy: alice,
+		AssignedTo: bob,
+		ActorID:    bob,
+		Watchers:   []int{carol, alice},
+	}
+
+	recipients := taskRecipients(event)
+	if want := []int{bob, alice, carol}; !slices.Equal(recipients, want) {
+		t.Fatalf("recipients are %v, want %v", recipients, want)
+	}
+}
@@ -0,0 +1,33 @@
+package usecase
+
+import (
+	"fmt"
+	"log"
+	"notificationservice/src/internal/core/user"
+	"strings"
+	"text/template"
+)
+
+// userMessages holds one template per security event type, the others use "default"
+var userMessages = template.Must(template.New("user").Parse(`
+{{- define "account_locked"}}Your account was temporarily locked after repeated failed login attempts from {{.IpAddress}}{{end}}
+
+{{- define "password_changed"}}Your password was changed from {{.IpAddress}}, all other sessions were signed out{{end}}
+
+{{- define "refresh_token_reuse"}}A reused session token was detected from {{.IpAddress}}, that login has been signed out on all devices{{end}}
+
+{{- define "default"}}Security event '{{.EventType}}' on your account{{end}}`))
+
+func renderUserMessage(event user.UserEvent) string {
+	name := event.EventType
+	if userMessages.Lookup(name) == nil {
+		name = "default"
+	}
+
+	var message strings.Builder
+	if err := userMessages.ExecuteTemplate(&message, name, event); err != nil {
+		log.Printf("Failed to render %s message: %v", event.EventType, err)
+		return fmt.Sprintf("Security event '%s' on your account", event.EventType)
+	}
+	return message.String()
+}
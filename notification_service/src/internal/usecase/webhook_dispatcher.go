@@ -0,0 +1,313 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"notificationservice/src/internal/adaptors/redis"
+	client "notificationservice/src/internal/adaptors/user_grpc_client"
+	"notificationservice/src/internal/core/auth"
+	"notificationservice/src/internal/core/webhook"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	webhookBatchSize   = 20
+	webhookBaseBackoff = 10 * time.Second
+	webhookMaxBackoff  = time.Hour
+	// attempts logged per delivery, older ones are dropped
+	webhookLogSize = 20
+	// bytes of the response body kept in the log
+	webhookResponseLimit = 512
+)
+
+// WebhookOptions configures how deliveries are sent
+type WebhookOptions struct {
+	// MaxAttempts is how often a delivery is tried before it is given up
+	MaxAttempts int
+	// DisableAfter is how many failed attempts in a row turn a webhook off
+	DisableAfter int
+	Timeout      time.Duration
+	// AllowPrivate lets webhooks reach loopback and private addresses, e.g. a CI server on the
+	// internal network. Off, users can't make this service call into the internal network.
+	AllowPrivate bool
+}
+
+// WebhookDispatcher POSTs the queued deliveries, signed with the webhook's secret, and retries
+// failed ones with exponential backoff. Replicas share the queue, a claimed delivery is leased
+// to one of them. Hooks on all tasks are only sent to while their owner is still an active admin,
+// as of the last userDirectory lookup.
+type WebhookDispatcher struct {
+	redisClient   *redis.RedisClient
+	userDirectory *client.UserDirectory
+	httpClient    *http.Client
+	opts          WebhookOptions
+}
+
+func NewWebhookDispatcher(redisClient *redis.RedisClient, userDirectory *client.UserDirectory, opts WebhookOptions) *WebhookDispatcher {
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	if !opts.AllowPrivate {
+		// checked on the resolved address, a public host name can't point the request inside
+		dialer.Control = func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+				return fmt.Errorf("webhook address %s is not public", host)
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &WebhookDispatcher{
+		redisClient:   redisClient,
+		userDirectory: userDirectory,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   opts.Timeout,
+			// a redirect counts as a failure, the receiver should register the final URL
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		opts: opts,
+	}
+}
+
+// Run sends the due deliveries every interval until ctx is done
+func (d *WebhookDispatcher) Run(ctx context.Context, interval time.Duration) {
+	log.Println("Starting webhook dispatcher...")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Webhook dispatcher shutting down...")
+			return
+		case <-ticker.C:
+			d.dispatchDue(ctx)
+		}
+	}
+}
+
+// dispatchDue sends the claimed deliveries in parallel, one slow receiver must not hold up the others
+func (d *WebhookDispatcher) dispatchDue(ctx context.Context) {
+	for {
+		// the lease outlasts an attempt, so no other replica sends the delivery meanwhile
+		ids, err := d.redisClient.ClaimDueDeliveries(ctx, time.Now(), 2*d.opts.Timeout+time.Minute, webhookBatchSize)
+		if err != nil {
+			log.Printf("Error claiming webhook deliveries: %v", err)
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, id := range ids {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				d.attempt(ctx, id)
+			}(id)
+		}
+		wg.Wait()
+
+		if len(ids) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// attempt sends one delivery and records the outcome
+func (d *WebhookDispatcher) attempt(ctx context.Context, deliveryID string) {
+	delivery, err := d.redisClient.GetDelivery(ctx, deliveryID)
+	if errors.Is(err, goredis.Nil) {
+		// expired, drop it from the schedule
+		if err := d.redisClient.UnscheduleDelivery(ctx, deliveryID); err != nil {
+			log.Printf("Error unscheduling webhook delivery %s: %v", deliveryID, err)
+		}
+		return
+	} else if err != nil {
+		log.Printf("Error getting webhook delivery %s: %v", deliveryID, err)
+		return
+	}
+	if delivery.Status != webhook.DeliveryPending {
+		d.save(ctx, delivery)
+		return
+	}
+
+	hook, err := d.redisClient.GetWebhook(ctx, delivery.WebhookID)
+	if errors.Is(err, goredis.Nil) || (err == nil && !hook.Active) {
+		d.giveUp(ctx, delivery, "webhook was deleted or disabled")
+		return
+	} else if err != nil {
+		log.Printf("Error getting webhook %s: %v", delivery.WebhookID, err)
+		return
+	}
+	if hook.AllTasks {
+		owner, found := d.userDirectory.Lookup(ctx, []int{hook.OwnerID})[hook.OwnerID]
+		if !found {
+			// user_service may be unreachable, try again later without counting an attempt. A
+			// deleted owner's webhooks are removed when user_deleted arrives.
+			log.Printf("Could not look up owner %d of webhook %s, delaying delivery %s", hook.OwnerID, hook.ID, delivery.ID)
+			next := time.Now().Add(webhookBaseBackoff)
+			delivery.NextAttemptAt = &next
+			d.save(ctx, delivery)
+			return
+		}
+		if !owner.Active || !owner.HasRole(auth.RoleAdmin) {
+			d.disable(ctx, hook.ID, "owner is no longer an admin")
+			d.giveUp(ctx, delivery, "owner of the webhook is no longer an admin")
+			return
+		}
+	}
+
+	result := d.post(ctx, hook, delivery)
+	delivery.Attempts++
+	delivery.Log = append(delivery.Log, result)
+	if len(delivery.Log) > webhookLogSize {
+		delivery.Log = delivery.Log[len(delivery.Log)-webhookLogSize:]
+	}
+	delivery.UpdatedAt = time.Now()
+
+	if result.Error == "" {
+		delivery.Status = webhook.DeliverySucceeded
+		delivery.NextAttemptAt = nil
+		d.save(ctx, delivery)
+		if err := d.redisClient.ResetWebhookFailures(ctx, hook.ID); err != nil {
+			log.Printf("Error resetting failures of webhook %s: %v", hook.ID, err)
+		}
+		return
+	}
+
+	log.Printf("Webhook delivery %s to %s failed (attempt %d): %s", delivery.ID, hook.URL, delivery.Attempts, result.Error)
+	if delivery.Attempts >= d.opts.MaxAttempts {
+		delivery.Status = webhook.DeliveryFailed
+		delivery.NextAttemptAt = nil
+	} else {
+		next := time.Now().Add(webhookBackoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+	}
+	d.save(ctx, delivery)
+	d.recordFailure(ctx, hook)
+}
+
+// post sends the payload, a 2xx answer is a success
+func (d *WebhookDispatcher) post(ctx context.Context, hook webhook.Webhook, delivery webhook.Delivery) (result webhook.Attempt) {
+	started := time.Now()
+	result.At = started
+	defer func() { result.DurationMs = time.Since(started).Milliseconds() }()
+
+	timestamp := strconv.FormatInt(started.Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "notification-service-webhooks")
+	req.Header.Set("X-Webhook-Id", hook.ID)
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Delivery", delivery.ID)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+webhookSignature(hook.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+
+	result.StatusCode = resp.StatusCode
+	result.Response = string(body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		result.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	return result
+}
+
+// webhookSignature is the hex HMAC-SHA256 of "<timestamp>.<body>" under the webhook's secret.
+// Receivers recompute it and reject old timestamps, so a captured delivery can't be replayed.
+func webhookSignature(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *WebhookDispatcher) giveUp(ctx context.Context, delivery webhook.Delivery, reason string) {
+	delivery.Status = webhook.DeliveryFailed
+	delivery.NextAttemptAt = nil
+	delivery.Log = append(delivery.Log, webhook.Attempt{At: time.Now(), Error: reason})
+	delivery.UpdatedAt = time.Now()
+	d.save(ctx, delivery)
+}
+
+func (d *WebhookDispatcher) save(ctx context.Context, delivery webhook.Delivery) {
+	if err := d.redisClient.SaveDelivery(ctx, delivery); err != nil {
+		// the lease runs out and the delivery is attempted again
+		log.Printf("Error saving webhook delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// recordFailure counts the failed attempt and turns the webhook off after DisableAfter in a row
+func (d *WebhookDispatcher) recordFailure(ctx context.Context, hook webhook.Webhook) {
+	failures, err := d.redisClient.RecordWebhookFailure(ctx, hook.ID)
+	if err != nil {
+		log.Printf("Error counting failures of webhook %s: %v", hook.ID, err)
+		return
+	}
+	if failures < int64(d.opts.DisableAfter) {
+		return
+	}
+	d.disable(ctx, hook.ID, fmt.Sprintf("disabled after %d failed attempts in a row", failures))
+}
+
+// disable turns the webhook off with the reason shown to its owner
+func (d *WebhookDispatcher) disable(ctx context.Context, id string, reason string) {
+	// read again, the owner may have changed it while the attempt was in flight
+	current, err := d.redisClient.GetWebhook(ctx, id)
+	if err != nil || !current.Active {
+		return
+	}
+	current.Active = false
+	current.DisabledReason = reason
+	current.UpdatedAt = time.Now()
+	if err := d.redisClient.SaveWebhook(ctx, current); err != nil {
+		log.Printf("Error disabling webhook %s: %v", id, err)
+		return
+	}
+	log.Printf("Disabled webhook %s of user %d: %s", id, current.OwnerID, reason)
+}
+
+// webhookBackoff doubles the wait after every failed attempt, up to webhookMaxBackoff
+func webhookBackoff(attempts int) time.Duration {
+	if attempts > 12 {
+		return webhookMaxBackoff
+	}
+	backoff := webhookBaseBackoff << (attempts - 1)
+	if backoff > webhookMaxBackoff {
+		return webhookMaxBackoff
+	}
+	return backoff
+}
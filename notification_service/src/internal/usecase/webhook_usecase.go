@@ -0,0 +1,365 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"events"
+	"fmt"
+	"log"
+	"net/url"
+	"notificationservice/src/internal/adaptors/redis"
+	"notificationservice/src/internal/core/auth"
+	"notificationservice/src/internal/core/notification"
+	"notificationservice/src/internal/core/task"
+	"notificationservice/src/internal/core/webhook"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	maxWebhooksPerUser  = 20
+	webhookDeliveryPage = 50
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("Webhook Not Found")
+	ErrDeliveryNotFound = errors.New("Delivery Not Found")
+	ErrWebhookDisabled  = errors.New("Webhook Is Disabled")
+	ErrTooManyWebhooks  = errors.New("Too Many Webhooks")
+	ErrAllTasksForAdmin = errors.New("Only Admins Can Receive Events of All Tasks")
+)
+
+// ErrInvalidWebhook is returned for a URL or event filter that can't be used, wrapped with the reason
+var ErrInvalidWebhook = errors.New("Invalid Webhook")
+
+// WebhookInput is what a user sends to create or change a webhook, nil fields are left as they are
+type WebhookInput struct {
+	URL        *string   `json:"url"`
+	EventTypes *[]string `json:"event_types"`
+	AllTasks   *bool     `json:"all_tasks"`
+	// Active turns a webhook back on after it was disabled, or off
+	Active *bool `json:"active"`
+}
+
+// WebhookUseCase manages webhooks and queues a delivery for every task event they want, the
+// WebhookDispatcher sends them
+type WebhookUseCase struct {
+	redisClient *redis.RedisClient
+}
+
+func NewWebhookUseCase(redisClient *redis.RedisClient) *WebhookUseCase {
+	return &WebhookUseCase{
+		redisClient: redisClient,
+	}
+}
+
+// CreateWebhook registers a webhook owned by the caller with a new signing secret
+func (uc *WebhookUseCase) CreateWebhook(ctx context.Context, claims auth.Claims, input WebhookInput) (webhook.Webhook, error) {
+	if input.URL == nil {
+		return webhook.Webhook{}, fmt.Errorf("%w: url is required", ErrInvalidWebhook)
+	}
+	owned, err := uc.redisClient.ListUserWebhooks(ctx, claims.UserID)
+	if err != nil {
+		return webhook.Webhook{}, fmt.Errorf("failed to get webhooks: %v", err)
+	}
+	if len(owned) >= maxWebhooksPerUser {
+		return webhook.Webhook{}, ErrTooManyWebhooks
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return webhook.Webhook{}, err
+	}
+	now := time.Now()
+	hook := webhook.Webhook{
+		ID:        uuid.NewString(),
+		OwnerID:   claims.UserID,
+		Secret:    hex.EncodeToString(secret),
+		Active:    true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := applyWebhookInput(&hook, claims, input); err != nil {
+		return webhook.Webhook{}, err
+	}
+
+	if err := uc.redisClient.SaveWebhook(ctx, hook); err != nil {
+		return webhook.Webhook{}, fmt.Errorf("failed to save webhook: %v", err)
+	}
+	log.Printf("User %d created webhook %s for %s", hook.OwnerID, hook.ID, hook.URL)
+	return hook, nil
+}
+
+// ListWebhooks returns the caller's webhooks, or every webhook for admins
+func (uc *WebhookUseCase) ListWebhooks(ctx context.Context, claims auth.Claims) ([]webhook.Webhook, error) {
+	var hooks []webhook.Webhook
+	var err error
+	if claims.HasRole(auth.RoleAdmin) {
+		hooks, err = uc.redisClient.ListWebhooks(ctx)
+	} else {
+		hooks, err = uc.redisClient.ListUserWebhooks(ctx, claims.UserID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %v", err)
+	}
+	return hooks, nil
+}
+
+// GetWebhook returns a webhook the caller owns, admins may see every webhook
+func (uc *WebhookUseCase) GetWebhook(ctx context.Context, claims auth.Claims, id string) (webhook.Webhook, error) {
+	hook, err := uc.redisClient.GetWebhook(ctx, id)
+	if errors.Is(err, goredis.Nil) {
+		return webhook.Webhook{}, ErrWebhookNotFound
+	} else if err != nil {
+		return webhook.Webhook{}, fmt.Errorf("failed to get webhook: %v", err)
+	}
+	if hook.OwnerID != claims.UserID && !claims.HasRole(auth.RoleAdmin) {
+		return webhook.Webhook{}, ErrWebhookNotFound
+	}
+	return hook, nil
+}
+
+// UpdateWebhook changes a webhook, turning it back on also forgets its past failures
+func (uc *WebhookUseCase) UpdateWebhook(ctx context.Context, claims auth.Claims, id string, input WebhookInput) (webhook.Webhook, error) {
+	hook, err := uc.GetWebhook(ctx, claims, id)
+	if err != nil {
+		return webhook.Webhook{}, err
+	}
+	if err := applyWebhookInput(&hook, claims, input); err != nil {
+		return webhook.Webhook{}, err
+	}
+	if input.Active != nil {
+		hook.Active = *input.Active
+		if hook.Active {
+			hook.DisabledReason = ""
+			if err := uc.redisClient.ResetWebhookFailures(ctx, hook.ID); err != nil {
+				return webhook.Webhook{}, fmt.Errorf("failed to update webhook: %v", err)
+			}
+		}
+	}
+	hook.UpdatedAt = time.Now()
+
+	if err := uc.redisClient.SaveWebhook(ctx, hook); err != nil {
+		return webhook.Webhook{}, fmt.Errorf("failed to update webhook: %v", err)
+	}
+	return hook, nil
+}
+
+func (uc *WebhookUseCase) DeleteWebhook(ctx context.Context, claims auth.Claims, id string) error {
+	hook, err := uc.GetWebhook(ctx, claims, id)
+	if err != nil {
+		return err
+	}
+	if err := uc.redisClient.DeleteWebhook(ctx, hook); err != nil {
+		return fmt.Errorf("failed to delete webhook: %v", err)
+	}
+	log.Printf("User %d deleted webhook %s", claims.UserID, hook.ID)
+	return nil
+}
+
+// DeleteUserWebhooks removes the webhooks of a deleted account, their queued deliveries are given
+// up when they come due
+func (uc *WebhookUseCase) DeleteUserWebhooks(ctx context.Context, userID int) error {
+	hooks, err := uc.redisClient.ListUserWebhooks(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get webhooks: %v", err)
+	}
+	for _, hook := range hooks {
+		if err := uc.redisClient.DeleteWebhook(ctx, hook); err != nil {
+			return fmt.Errorf("failed to delete webhook: %v", err)
+		}
+	}
+	if len(hooks) > 0 {
+		log.Printf("Deleted %d webhooks of deleted user %d", len(hooks), userID)
+	}
+	return nil
+}
+
+// ListDeliveries returns the newest deliveries of a webhook with their attempts
+func (uc *WebhookUseCase) ListDeliveries(ctx context.Context, claims auth.Claims, id string, limit int) ([]webhook.Delivery, error) {
+	hook, err := uc.GetWebhook(ctx, claims, id)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > webhookDeliveryPage {
+		limit = webhookDeliveryPage
+	}
+	deliveries, err := uc.redisClient.ListDeliveries(ctx, hook.ID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deliveries: %v", err)
+	}
+	return deliveries, nil
+}
+
+// ReplayDelivery sends the payload of a past delivery again as a new delivery, right away
+func (uc *WebhookUseCase) ReplayDelivery(ctx context.Context, claims auth.Claims, id string, deliveryID string) (webhook.Delivery, error) {
+	hook, err := uc.GetWebhook(ctx, claims, id)
+	if err != nil {
+		return webhook.Delivery{}, err
+	}
+	if !hook.Active {
+		return webhook.Delivery{}, ErrWebhookDisabled
+	}
+	original, err := uc.redisClient.GetDelivery(ctx, deliveryID)
+	if errors.Is(err, goredis.Nil) || (err == nil && original.WebhookID != hook.ID) {
+		return webhook.Delivery{}, ErrDeliveryNotFound
+	} else if err != nil {
+		return webhook.Delivery{}, fmt.Errorf("failed to get delivery: %v", err)
+	}
+
+	replay := newDelivery(uuid.NewString(), hook.ID, original.EventID, original.EventType, original.Payload)
+	replay.ReplayOf = original.ID
+	if _, err := uc.redisClient.CreateDelivery(ctx, replay); err != nil {
+		return webhook.Delivery{}, fmt.Errorf("failed to queue delivery: %v", err)
+	}
+	log.Printf("User %d replayed delivery %s of webhook %s as %s", claims.UserID, original.ID, hook.ID, replay.ID)
+	return replay, nil
+}
+
+// EnqueueTaskEvent queues a delivery of the event for every active webhook that wants it. Hooks
+// on the owner's own tasks also follow the owner's preferences, hooks on all tasks are feeds for
+// integrations and get everything. The deliveries are keyed by eventID and webhook, so a
+// redelivered event is not sent twice.
+func (uc *WebhookUseCase) EnqueueTaskEvent(ctx context.Context, eventID string, event task.TaskEvent) error {
+	hooks, err := uc.redisClient.ListWebhooks(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get webhooks: %v", err)
+	}
+
+	recipients := taskRecipients(event)
+	var owners []int
+	for _, hook := range hooks {
+		if hook.Active && !hook.AllTasks && containsInt(recipients, hook.OwnerID) && !containsInt(owners, hook.OwnerID) {
+			owners = append(owners, hook.OwnerID)
+		}
+	}
+	prefs, err := uc.redisClient.GetPreferences(ctx, owners)
+	if err != nil {
+		return fmt.Errorf("failed to get preferences: %v", err)
+	}
+
+	var payload []byte
+	for _, hook := range hooks {
+		if !hook.Active || !hook.Wants(event.EventType) {
+			continue
+		}
+		if !hook.AllTasks {
+			p, ok := prefs[hook.OwnerID]
+			if !ok || !p.Wants(event.EventType, event.TaskID) || !p.UsesChannel(notification.ChannelWebhook) {
+				continue
+			}
+		}
+		if payload == nil {
+			payload, err = json.Marshal(webhookEvent(eventID, event))
+			if err != nil {
+				return err
+			}
+		}
+
+		delivery := newDelivery(fmt.Sprintf("%s-%s", eventID, hook.ID), hook.ID, eventID, event.EventType, payload)
+		if _, err := uc.redisClient.CreateDelivery(ctx, delivery); err != nil {
+			return fmt.Errorf("failed to queue delivery: %v", err)
+		}
+	}
+	return nil
+}
+
+func newDelivery(id string, webhookID string, eventID string, eventType string, payload []byte) webhook.Delivery {
+	now := time.Now()
+	return webhook.Delivery{
+		ID:            id,
+		WebhookID:     webhookID,
+		EventID:       eventID,
+		EventType:     eventType,
+		Payload:       payload,
+		Status:        webhook.DeliveryPending,
+		NextAttemptAt: &now,
+		Log:           []webhook.Attempt{},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+func webhookEvent(eventID string, event task.TaskEvent) webhook.Event {
+	actorID := event.ActorID
+	if actorID == 0 {
+		actorID = event.AssignedBy
+	}
+	watchers := event.Watchers
+	if watchers == nil {
+		watchers = []int{}
+	}
+	return webhook.Event{
+		ID:         eventID,
+		Type:       event.EventType,
+		OccurredAt: event.Timestamp,
+		ActorID:    actorID,
+		TaskID:     event.TaskID,
+		TaskName:   event.TaskName,
+		AssignedTo: event.AssignedTo,
+		AssignedBy: event.AssignedBy,
+		Watchers:   watchers,
+		Before:     event.Before,
+		After:      event.After,
+	}
+}
+
+// applyWebhookInput checks and copies the URL and filters of the input onto the webhook
+func applyWebhookInput(hook *webhook.Webhook, claims auth.Claims, input WebhookInput) error {
+	if input.URL != nil {
+		parsed, err := url.Parse(strings.TrimSpace(*input.URL))
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+		}
+		if parsed.User != nil {
+			return fmt.Errorf("%w: url must not contain credentials", ErrInvalidWebhook)
+		}
+		hook.URL = parsed.String()
+	}
+	if input.EventTypes != nil {
+		eventTypes := []string{}
+		for _, eventType := range *input.EventTypes {
+			if !events.IsTaskEventType(eventType) {
+				return fmt.Errorf("%w: unknown event type %q", ErrInvalidWebhook, eventType)
+			}
+			if !containsString(eventTypes, eventType) {
+				eventTypes = append(eventTypes, eventType)
+			}
+		}
+		hook.EventTypes = eventTypes
+	}
+	if hook.EventTypes == nil {
+		hook.EventTypes = []string{}
+	}
+	if input.AllTasks != nil {
+		if *input.AllTasks && !claims.HasRole(auth.RoleAdmin) {
+			return ErrAllTasksForAdmin
+		}
+		hook.AllTasks = *input.AllTasks
+	}
+	return nil
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,19 +1,25 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"task_service/src/internal/adaptors/jwks"
 	"task_service/src/internal/adaptors/persistance"
 	redisclient "task_service/src/internal/adaptors/redis"
 	"task_service/src/internal/adaptors/redis/notification"
 	client "task_service/src/internal/adaptors/user_grpc_client"
 	"task_service/src/internal/config"
 	taskhandler "task_service/src/internal/interfaces/input/api/rest/handler"
+	"task_service/src/internal/interfaces/input/api/rest/middleware"
 	"task_service/src/internal/interfaces/input/api/rest/routes"
+	pb "task_service/src/internal/interfaces/input/grpc/generated/generated"
+	"task_service/src/internal/interfaces/input/subscriber"
 	task "task_service/src/internal/usecase"
 	"task_service/src/pkg/migrate"
+	"time"
 )
 
 func main() {
@@ -44,17 +50,6 @@ func main() {
 		log.Fatalf("failed to load config: %v", err)
 	}
 
-	var notificationService *notification.NotificationService
-	redisClient, err := redisclient.NewRedisClient()
-	if err != nil {
-		log.Printf("Warning: Failed to connect to Redis: %v. Notifications will be disabled.", err)
-		notificationService = nil // Disable notifications if Redis fails
-	} else {
-		defer redisClient.Close()
-		notificationService = notification.NewNotificationService(redisClient.GetClient())
-		fmt.Println("Connected to Redis")
-	}
-
 	//gRPC client setup
 	grpcClient, err := client.NewSessionValidatorClient(fmt.Sprintf("localhost:%s", configP.GRPC_PORT))
 	if err != nil {
@@ -62,10 +57,33 @@ func main() {
 	}
 
 	taskRepo := persistance.NewTaskRepo(database)
-	taskService := task.NewTaskService(taskRepo, notificationService, grpcClient) //added notificationService and grpcClient
+	userCacheTTL, err := parseDurationOr(configP.USER_CACHE_TTL, 5*time.Minute)
+	if err != nil {
+		log.Fatalf("invalid USER_CACHE_TTL: %v", err)
+	}
+	userDirectory := client.NewUserDirectory(grpcClient, userCacheTTL)
+	taskService := task.NewTaskService(&taskRepo, grpcClient, userDirectory) //added grpcClient
 	taskHandler := taskhandler.NewTaskHandler(taskService)
 
-	router := routes.InitRoutes(&taskHandler, grpcClient)
+	outboxInterval, err := parseDurationOr(configP.OUTBOX_POLL_INTERVAL, time.Second)
+	if err != nil {
+		log.Fatalf("invalid OUTBOX_POLL_INTERVAL: %v", err)
+	}
+	// boards hear task events from the stream once Redis is up
+	boardHub := task.NewBoardHub()
+	go startRedisWorkers(context.Background(), configP, persistance.NewOutboxRepo(database), outboxInterval, &taskService, boardHub)
+	boardSessionCheck, err := parseDurationOr(configP.BOARD_SESSION_CHECK_INTERVAL, time.Minute)
+	if err != nil || boardSessionCheck <= 0 {
+		log.Fatalf("invalid BOARD_SESSION_CHECK_INTERVAL: %q", configP.BOARD_SESSION_CHECK_INTERVAL)
+	}
+	boardHandler := taskhandler.NewBoardHandler(taskService, boardHub, grpcClient, boardSessionCheck)
+
+	authMiddleware, err := newAuthMiddleware(configP, grpcClient)
+	if err != nil {
+		log.Fatalf("failed to set up authentication: %v", err)
+	}
+
+	router := routes.InitRoutes(&taskHandler, boardHandler, authMiddleware)
 
 	// server starting
 	fmt.Printf("Starting server on port %s\n", configP.APP_PORT)
@@ -74,3 +92,83 @@ func main() {
 		log.Fatalf("failed to start server: %v", err)
 	}
 }
+
+// startRedisWorkers waits for Redis, then relays the outbox to it, feeds the boards and listens
+// for account events. Task changes are accepted meanwhile, their events wait in the outbox.
+func startRedisWorkers(ctx context.Context, configP *config.Config, outboxRepo persistance.OutboxRepo, outboxInterval time.Duration, taskService *task.TaskService, boardHub *task.BoardHub) {
+	redisClient, err := redisclient.NewRedisClient()
+	for err != nil {
+		log.Printf("Warning: Failed to connect to Redis: %v. Task events are kept in the outbox, retrying in %s.", err, redisRetryInterval)
+		time.Sleep(redisRetryInterval)
+		redisClient, err = redisclient.NewRedisClient()
+	}
+	fmt.Println("Connected to Redis")
+
+	// every replica shares the group, each user event is handled by one of them
+	group := configP.USER_EVENTS_GROUP
+	if group == "" {
+		group = "task_service"
+	}
+	consumer := configP.USER_EVENTS_CONSUMER
+	if consumer == "" {
+		hostname, _ := os.Hostname()
+		consumer = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+
+	notificationService := notification.NewNotificationService(redisClient.GetClient())
+	go task.NewOutboxRelay(outboxRepo, notificationService, outboxInterval).Run(ctx)
+	go subscriber.NewBoardFeed(redisClient, boardHub).Run(ctx)
+
+	// deleted accounts are announced on Redis, their tasks are handed back once it is reachable
+	subscriber.NewUserEventSubscriber(redisClient, taskService, group, consumer).StartListening(ctx)
+}
+
+const redisRetryInterval = 30 * time.Second
+
+// newAuthMiddleware picks how cookie requests are authenticated from AUTH_MODE,
+// personal access tokens are accepted in every mode
+func newAuthMiddleware(configP *config.Config, grpcClient pb.SessionValidatorClient) (func(http.Handler) http.Handler, error) {
+	cookieAuth, err := newCookieAuthMiddleware(configP, grpcClient)
+	if err != nil {
+		return nil, err
+	}
+	return middleware.AccessTokenMiddleware(grpcClient, cookieAuth), nil
+}
+
+func newCookieAuthMiddleware(configP *config.Config, grpcClient pb.SessionValidatorClient) (func(http.Handler) http.Handler, error) {
+	switch configP.AUTH_MODE {
+	case "", "session":
+		log.Println("Authenticating requests with gRPC session validation")
+		return middleware.SessionAuthMiddleware(grpcClient), nil
+	case "jwt":
+		jwksURL := configP.JWKS_URL
+		if jwksURL == "" {
+			jwksURL = fmt.Sprintf("http://localhost:%s/.well-known/jwks.json", configP.USER_PORT)
+		}
+		cacheTTL, err := parseDurationOr(configP.JWKS_CACHE_TTL, 10*time.Minute)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS_CACHE_TTL: %w", err)
+		}
+		keyCache := jwks.NewKeyCache(jwksURL, cacheTTL)
+
+		var revocationClient pb.SessionValidatorClient
+		if configP.AUTH_REVOCATION_CHECK {
+			revocationClient = grpcClient
+		}
+		revocationTTL, err := parseDurationOr(configP.AUTH_REVOCATION_CACHE_TTL, 30*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AUTH_REVOCATION_CACHE_TTL: %w", err)
+		}
+		log.Printf("Authenticating requests with local JWT verification (JWKS %s, revocation check %t)", jwksURL, configP.AUTH_REVOCATION_CHECK)
+		return middleware.JWTAuthMiddleware(keyCache, revocationClient, revocationTTL), nil
+	default:
+		return nil, fmt.Errorf("unknown AUTH_MODE %q", configP.AUTH_MODE)
+	}
+}
+
+func parseDurationOr(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return time.ParseDuration(value)
+}
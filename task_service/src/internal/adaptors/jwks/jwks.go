@@ -0,0 +1,159 @@
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// minRefreshInterval stops a flood of tokens with unknown kids from hammering user_service
+const minRefreshInterval = 30 * time.Second
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+type PublicKey struct {
+	Alg string
+	Key crypto.PublicKey
+}
+
+// KeyCache fetches user_service's JWKS and keeps it in memory for ttl.
+// An unknown kid triggers an early refresh so a key rotation is picked up without waiting for the ttl.
+type KeyCache struct {
+	url        string
+	ttl        time.Duration
+	httpClient *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]PublicKey
+	fetchedAt   time.Time
+	refreshedAt time.Time
+}
+
+func NewKeyCache(url string, ttl time.Duration) *KeyCache {
+	return &KeyCache{
+		url:        url,
+		ttl:        ttl,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		keys:       map[string]PublicKey{},
+	}
+}
+
+func (c *KeyCache) Key(ctx context.Context, kid string) (PublicKey, error) {
+	c.mu.RLock()
+	key, found := c.keys[kid]
+	fresh := time.Since(c.fetchedAt) < c.ttl
+	c.mu.RUnlock()
+
+	if found && fresh {
+		return key, nil
+	}
+
+	if err := c.refresh(ctx); err != nil {
+		// keep serving the keys we have if user_service is unreachable
+		log.Printf("Failed to refresh JWKS: %v", err)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	key, found = c.keys[kid]
+	if !found {
+		return PublicKey{}, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+func (c *KeyCache) refresh(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// covers both another request refreshing while we waited for the lock and a failing user_service
+	if time.Since(c.refreshedAt) < minRefreshInterval {
+		return nil
+	}
+	c.refreshedAt = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected JWKS status %d", resp.StatusCode)
+	}
+
+	var set jwkSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %v", err)
+	}
+
+	keys := map[string]PublicKey{}
+	for _, k := range set.Keys {
+		publicKey, err := parseJWK(k)
+		if err != nil {
+			log.Printf("Skipping JWK %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = publicKey
+	}
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	return nil
+}
+
+func parseJWK(k jwk) (PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return PublicKey{}, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return PublicKey{}, err
+		}
+		return PublicKey{
+			Alg: "RS256",
+			Key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())},
+		}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return PublicKey{}, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return PublicKey{}, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return PublicKey{}, errors.New("invalid Ed25519 key size")
+		}
+		return PublicKey{Alg: "EdDSA", Key: ed25519.PublicKey(x)}, nil
+	default:
+		return PublicKey{}, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,99 @@
+package persistance
+
+import (
+	"database/sql"
+	"fmt"
+	"task_service/src/internal/core/outbox"
+	"task_service/src/internal/core/task"
+	"task_service/src/internal/interfaces/events"
+	"time"
+)
+
+// TaskEventFunc builds the event for a task the repo just changed from its state before and after
+// the change and the task's watchers, before is nil for a created task and after for a deleted one.
+// The event is stored in the outbox in the same transaction as the change, so the func runs while
+// the task is locked and must not call other services.
+type TaskEventFunc func(before *task.Task, after *task.Task, watchers []int) task.TaskEvent
+
+type OutboxRepo struct {
+	db *Database
+}
+
+func NewOutboxRepo(d *Database) OutboxRepo {
+	return OutboxRepo{db: d}
+}
+
+// enqueueTaskEvent writes the event envelope to the outbox, it is only published if tx commits
+func enqueueTaskEvent(tx *sql.Tx, event task.TaskEvent) error {
+	payload, err := events.EncodeTaskEvent(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode task event: %v", err)
+	}
+	query := `INSERT INTO outbox(topic, payload, content_type) VALUES($1, $2, $3)`
+	if _, err := tx.Exec(query, task.TaskEventsStream, payload, outbox.ContentTypeProtobuf); err != nil {
+		return fmt.Errorf("failed to write outbox: %v", err)
+	}
+	return nil
+}
+
+// RelayPending locks up to limit messages that are due, skipping those another relay holds, and
+// hands them to publish in order. Published messages are marked sent, a failed one is rescheduled
+// after retryAfter(attempts) and ends the batch, the rest would most likely fail the same way.
+func (o *OutboxRepo) RelayPending(limit int, publish func(outbox.Message) error, retryAfter func(attempts int) time.Duration) (int, error) {
+	tx, err := o.db.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT id, topic, payload, content_type, attempts, created_at FROM outbox
+			  WHERE sent_at IS NULL AND next_attempt_at <= CURRENT_TIMESTAMP
+			  ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`
+	rows, err := tx.Query(query, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read outbox: %v", err)
+	}
+	var messages []outbox.Message
+	for rows.Next() {
+		var m outbox.Message
+		if err := rows.Scan(&m.Id, &m.Topic, &m.Payload, &m.ContentType, &m.Attempts, &m.CreatedAt); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan outbox: %v", err)
+		}
+		messages = append(messages, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating over outbox: %v", err)
+	}
+
+	sent := 0
+	for _, m := range messages {
+		if publishErr := publish(m); publishErr != nil {
+			query := `UPDATE outbox SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3 WHERE id = $1`
+			if _, err := tx.Exec(query, m.Id, publishErr.Error(), time.Now().Add(retryAfter(m.Attempts+1))); err != nil {
+				return 0, fmt.Errorf("failed to reschedule outbox message: %v", err)
+			}
+			break
+		}
+		query := `UPDATE outbox SET attempts = attempts + 1, last_error = NULL, sent_at = CURRENT_TIMESTAMP WHERE id = $1`
+		if _, err := tx.Exec(query, m.Id); err != nil {
+			return 0, fmt.Errorf("failed to mark outbox message sent: %v", err)
+		}
+		sent++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return sent, nil
+}
+
+// DeleteSent removes messages published before the given time
+func (o *OutboxRepo) DeleteSent(before time.Time) (int64, error) {
+	result, err := o.db.db.Exec(`DELETE FROM outbox WHERE sent_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clean up outbox: %v", err)
+	}
+	return result.RowsAffected()
+}
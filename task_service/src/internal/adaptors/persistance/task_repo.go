@@ -1,6 +1,7 @@
 package persistance
 
 import (
+	"database/sql"
 	"fmt"
 	"task_service/src/internal/core/task"
 )
@@ -15,7 +16,7 @@ func NewTaskRepo(d *Database) TaskRepo {
 
 var emptyTask task.Task
 
-func (t *TaskRepo) CreateNewTask(task1 task.TaskCreate) (task.Task, int, error) {
+func (t *TaskRepo) CreateNewTask(task1 task.TaskCreate, event TaskEventFunc) (task.Task, int, error) {
 	var count int
 	var createdTask task.Task
 	tx, err := t.db.db.Begin()
@@ -47,6 +48,10 @@ func (t *TaskRepo) CreateNewTask(task1 task.TaskCreate) (task.Task, int, error)
 	if err != nil {
 		return emptyTask, count, err
 	}
+	err = enqueueTaskEvent(tx, event(nil, &createdTask, nil))
+	if err != nil {
+		return emptyTask, count, err
+	}
 	err = tx.Commit()
 	if err != nil {
 		return emptyTask, count, err
@@ -55,14 +60,23 @@ func (t *TaskRepo) CreateNewTask(task1 task.TaskCreate) (task.Task, int, error)
 	return createdTask, count, nil
 }
 
-func (t *TaskRepo) UpdateOldTask(task1 task.Task) (task.Task, error) {
+func (t *TaskRepo) UpdateOldTask(task1 task.Task, event TaskEventFunc) (task.Task, error) {
 	// we are sending assigned by to verify that the same user who assigned the task, can update the task, no other can can update, only the user who assigned the task, can update it.
 	var existingTask task.Task
-	query1 := `select name, description, task_status, priority, deadline from tasks where assigned_by=$1 and id=$2`
-	err := t.db.db.QueryRow(query1, task1.AssignedBy, task1.Id).Scan(
+	tx, err := t.db.db.Begin()
+	if err != nil {
+		return emptyTask, err
+	}
+	defer tx.Rollback()
+	query1 := `select id, name, assigned_by, assigned_to, description, task_status, created_at, priority, deadline from tasks where assigned_by=$1 and id=$2 for update`
+	err = tx.QueryRow(query1, task1.AssignedBy, task1.Id).Scan(
+		&existingTask.Id,
 		&existingTask.Name,
+		&existingTask.AssignedBy,
+		&existingTask.AssignedTo,
 		&existingTask.Description,
 		&existingTask.TaskStatus,
+		&existingTask.CreatedAt,
 		&existingTask.Priority,
 		&existingTask.Deadline,
 	)
@@ -84,19 +98,32 @@ func (t *TaskRepo) UpdateOldTask(task1 task.Task) (task.Task, error) {
 	if task1.Deadline.IsZero() {
 		task1.Deadline = existingTask.Deadline
 	}
-	query := `update tasks set name=$1, description=$2, task_status=$3, priority=$4, deadline=$5 where id=$6 returning name, description, task_status, priority, deadline, created_at`
+	query := `update tasks set name=$1, description=$2, task_status=$3, priority=$4, deadline=$5 where id=$6 returning name, description, task_status, priority, deadline, created_at, assigned_to`
 	//for this, before writing query, check in task struct, if any field is empty, then do not add it into the query.
-	err = t.db.db.QueryRow(query, task1.Name, task1.Description, task1.TaskStatus, task1.Priority, task1.Deadline, task1.Id).Scan(
+	err = tx.QueryRow(query, task1.Name, task1.Description, task1.TaskStatus, task1.Priority, task1.Deadline, task1.Id).Scan(
 		&task1.Name,
 		&task1.Description,
 		&task1.TaskStatus,
 		&task1.Priority,
 		&task1.Deadline,
 		&task1.CreatedAt,
+		&task1.AssignedTo,
 	)
 	if err != nil {
 		return emptyTask, err
 	}
+	watchers, err := getWatchers(tx, task1.Id)
+	if err != nil {
+		return emptyTask, err
+	}
+	err = enqueueTaskEvent(tx, event(&existingTask, &task1, watchers))
+	if err != nil {
+		return emptyTask, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return emptyTask, err
+	}
 	return task1, nil
 }
 
@@ -164,24 +191,34 @@ func (t *TaskRepo) GetTaskByID(taskID int) (task.Task, error) {
 	return taskData, nil
 }
 
-func (t *TaskRepo) DeleteTask(taskID int) error {
-	query := `DELETE FROM tasks WHERE id = $1`
-
-	result, err := t.db.db.Exec(query, taskID)
+func (t *TaskRepo) DeleteTask(taskID int, event TaskEventFunc) error {
+	tx, err := t.db.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to delete task: %v", err)
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
+	// watchers are deleted with the task, so they are read first
+	watchers, err := getWatchers(tx, taskID)
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
+		return err
 	}
 
-	if rowsAffected == 0 {
+	query := `DELETE FROM tasks WHERE id = $1
+			  RETURNING id, name, assigned_to, description, task_status, created_at, priority, assigned_by, deadline`
+
+	var deleted task.Task
+	err = tx.QueryRow(query, taskID).Scan(&deleted.Id, &deleted.Name, &deleted.AssignedTo, &deleted.Description, &deleted.TaskStatus, &deleted.CreatedAt, &deleted.Priority, &deleted.AssignedBy, &deleted.Deadline)
+	if err == sql.ErrNoRows {
 		return fmt.Errorf("task not found")
+	} else if err != nil {
+		return fmt.Errorf("failed to delete task: %v", err)
 	}
 
-	return nil
+	if err := enqueueTaskEvent(tx, event(&deleted, nil, watchers)); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // Get tasks by user ID (tasks assigned to or created by user)
@@ -249,3 +286,92 @@ func (t *TaskRepo) GetUserTaskDb(taskStatus task.TaskStatus) (int, task.TaskStat
 	}
 	return count, taskStatus, nil
 }
+
+// ReassignTasksOfUser hands the open tasks assigned to userID back to whoever assigned them.
+// Tasks the user assigned to themselves and completed tasks are left as they are.
+func (t *TaskRepo) ReassignTasksOfUser(userID int, event TaskEventFunc) ([]task.Task, error) {
+	tx, err := t.db.db.Begin()
+	if err != nil {
+		return []task.Task{}, fmt.Errorf("failed to reassign user tasks: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE tasks SET assigned_to = assigned_by
+			  WHERE assigned_to = $1 AND assigned_by <> $1 AND task_status <> 'completed'
+			  RETURNING id, name, assigned_to, description, task_status, created_at, priority, assigned_by, deadline`
+
+	rows, err := tx.Query(query, userID)
+	if err != nil {
+		return []task.Task{}, fmt.Errorf("failed to reassign user tasks: %v", err)
+	}
+
+	var tasks []task.Task
+	for rows.Next() {
+		var t task.Task
+		err := rows.Scan(&t.Id, &t.Name, &t.AssignedTo, &t.Description, &t.TaskStatus, &t.CreatedAt, &t.Priority, &t.AssignedBy, &t.Deadline)
+		if err != nil {
+			rows.Close()
+			return []task.Task{}, fmt.Errorf("failed to scan task: %v", err)
+		}
+		tasks = append(tasks, t)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return []task.Task{}, fmt.Errorf("error iterating over rows: %v", err)
+	}
+
+	for _, reassigned := range tasks {
+		before := reassigned
+		before.AssignedTo = userID
+		watchers, err := getWatchers(tx, reassigned.Id)
+		if err != nil {
+			return []task.Task{}, err
+		}
+		if err := enqueueTaskEvent(tx, event(&before, &reassigned, watchers)); err != nil {
+			return []task.Task{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return []task.Task{}, fmt.Errorf("failed to reassign user tasks: %v", err)
+	}
+	return tasks, nil
+}
+
+func (t *TaskRepo) AddWatcher(taskID int, userID int) error {
+	query := `INSERT INTO task_watchers(task_id, user_id) VALUES($1, $2) ON CONFLICT DO NOTHING`
+	_, err := t.db.db.Exec(query, taskID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to add watcher: %v", err)
+	}
+	return nil
+}
+
+func (t *TaskRepo) RemoveWatcher(taskID int, userID int) error {
+	query := `DELETE FROM task_watchers WHERE task_id = $1 AND user_id = $2`
+	_, err := t.db.db.Exec(query, taskID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove watcher: %v", err)
+	}
+	return nil
+}
+
+// getWatchers reads the watchers of the task in tx, for the event of a change made in it
+func getWatchers(tx *sql.Tx, taskID int) ([]int, error) {
+	query := `SELECT user_id FROM task_watchers WHERE task_id = $1`
+	rows, err := tx.Query(query, taskID)
+	if err != nil {
+		return []int{}, fmt.Errorf("failed to get watchers: %v", err)
+	}
+	defer rows.Close()
+
+	watchers := []int{}
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return []int{}, fmt.Errorf("failed to scan watcher: %v", err)
+		}
+		watchers = append(watchers, userID)
+	}
+	return watchers, rows.Err()
+}
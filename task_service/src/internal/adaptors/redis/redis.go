@@ -3,7 +3,9 @@ package redisclient
 import (
 	"context"
 	"fmt"
+	"strings"
 	"task_service/src/internal/config"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -41,3 +43,78 @@ func (r *RedisClient) GetClient() *redis.Client {
 func (r *RedisClient) Close() error {
 	return r.client.Close()
 }
+
+func (r *RedisClient) Subscribe(ctx context.Context, channels ...string) *redis.PubSub {
+	return r.client.Subscribe(ctx, channels...)
+}
+
+// ReadStream waits up to block for entries of stream after lastID, "$" reads only entries added
+// from now on. Unlike a consumer group every reader gets every entry. It returns no entries when
+// none arrived in time.
+func (r *RedisClient) ReadStream(ctx context.Context, stream string, lastID string, count int64, block time.Duration) ([]redis.XMessage, error) {
+	streams, err := r.client.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{stream, lastID},
+		Count:   count,
+		Block:   block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(streams) == 0 {
+		return nil, nil
+	}
+	return streams[0].Messages, nil
+}
+
+// EnsureConsumerGroup creates the group reading the stream from its start, creating the stream when
+// nothing was appended yet. An existing group is left as it is.
+func (r *RedisClient) EnsureConsumerGroup(ctx context.Context, stream string, group string) error {
+	err := r.client.XGroupCreateMkStream(ctx, stream, group, "0").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// ReadStreamGroup returns up to count entries never delivered to the group, waiting up to block for
+// them. Each entry goes to one consumer of the group. It returns no entries when none arrived in time.
+func (r *RedisClient) ReadStreamGroup(ctx context.Context, stream string, group string, consumer string, count int64, block time.Duration) ([]redis.XMessage, error) {
+	streams, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{stream, ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(streams) == 0 {
+		return nil, nil
+	}
+	return streams[0].Messages, nil
+}
+
+func (r *RedisClient) AckStream(ctx context.Context, stream string, group string, ids ...string) error {
+	return r.client.XAck(ctx, stream, group, ids...).Err()
+}
+
+// ClaimIdleMessages takes over up to count entries that were delivered to a consumer of the group
+// but not acknowledged for at least minIdle, because processing failed or the consumer crashed
+func (r *RedisClient) ClaimIdleMessages(ctx context.Context, stream string, group string, consumer string, minIdle time.Duration, count int64) ([]redis.XMessage, error) {
+	messages, _, err := r.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   stream,
+		Group:    group,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Start:    "0",
+		Count:    count,
+	}).Result()
+	return messages, err
+}
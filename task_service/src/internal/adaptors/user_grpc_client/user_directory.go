@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"task_service/src/internal/core/user"
+	pb "task_service/src/internal/interfaces/input/grpc/generated/generated"
+	"time"
+)
+
+const (
+	// lookupTimeout bounds one BatchGetUsers call, names are a nice-to-have and must not stall a request
+	lookupTimeout = 2 * time.Second
+	// expired entries are pruned once the cache grows past this size
+	userCachePruneSize = 10000
+	// maxBatchGetUsers is the most ids user_service accepts in one BatchGetUsers call
+	maxBatchGetUsers = 500
+)
+
+type cachedUser struct {
+	info      user.UserInfo
+	expiresAt time.Time
+}
+
+// UserDirectory resolves user ids to names through user_service, caching entries for ttl
+// so a list of tasks costs at most one BatchGetUsers call instead of one call per row
+type UserDirectory struct {
+	grpcClient pb.SessionValidatorClient
+	ttl        time.Duration
+
+	mu    sync.Mutex
+	users map[int]cachedUser
+}
+
+func NewUserDirectory(grpcClient pb.SessionValidatorClient, ttl time.Duration) *UserDirectory {
+	return &UserDirectory{
+		grpcClient: grpcClient,
+		ttl:        ttl,
+		users:      map[int]cachedUser{},
+	}
+}
+
+// Lookup returns the users among ids that could be resolved. When user_service is unreachable
+// only the cached entries are returned, callers then fall back to showing ids.
+func (d *UserDirectory) Lookup(ctx context.Context, ids []int) map[int]user.UserInfo {
+	found := make(map[int]user.UserInfo, len(ids))
+	seen := make(map[int]bool, len(ids))
+	var missing []string
+	now := time.Now()
+
+	d.mu.Lock()
+	for _, id := range ids {
+		if seen[id] || id == 0 {
+			continue
+		}
+		seen[id] = true
+		if cached, ok := d.users[id]; ok && now.Before(cached.expiresAt) {
+			found[id] = cached.info
+			continue
+		}
+		missing = append(missing, strconv.Itoa(id))
+	}
+	d.mu.Unlock()
+
+	if len(missing) == 0 {
+		return found
+	}
+
+	// the batches share the timeout, a failed one leaves its ids unresolved and the rest go on
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+	var entries []*pb.UserInfo
+	for start := 0; start < len(missing); start += maxBatchGetUsers {
+		batch := missing[start:min(start+maxBatchGetUsers, len(missing))]
+		resp, err := d.grpcClient.BatchGetUsers(ctx, &pb.BatchGetUsersRequest{UserIds: batch})
+		if err != nil {
+			log.Printf("Error looking up users: %v", err)
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		entries = append(entries, resp.GetUsers()...)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.users) > userCachePruneSize {
+		for id, cached := range d.users {
+			if now.After(cached.expiresAt) {
+				delete(d.users, id)
+			}
+		}
+	}
+	for _, entry := range entries {
+		id, err := strconv.Atoi(entry.GetUserId())
+		if err != nil {
+			continue
+		}
+		info := user.UserInfo{
+			Id:          id,
+			Username:    entry.GetUsername(),
+			DisplayName: entry.GetDisplayName(),
+			Email:       entry.GetEmail(),
+		}
+		d.users[id] = cachedUser{info: info, expiresAt: now.Add(d.ttl)}
+		found[id] = info
+	}
+	return found
+}
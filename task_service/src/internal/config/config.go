@@ -23,6 +23,24 @@ type Config struct {
 	REDIS_PORT        string `mapstructure:"REDIS_PORT"`
 	REDIS_PASSWORD    string `mapstructure:"REDIS_PASSWORD"`
 	NOTIFICATION_PORT string `mapstructure:"NOTIFICATION_PORT"`
+	// "session" validates the sess cookie over gRPC on every request, "jwt" verifies the at token locally
+	AUTH_MODE string `mapstructure:"AUTH_MODE"`
+	// user_service JWKS endpoint, defaults to http://localhost:USER_PORT/.well-known/jwks.json
+	JWKS_URL       string `mapstructure:"JWKS_URL"`
+	JWKS_CACHE_TTL string `mapstructure:"JWKS_CACHE_TTL"`
+	// in jwt mode, also ask user_service whether the token's session was revoked
+	AUTH_REVOCATION_CHECK     bool   `mapstructure:"AUTH_REVOCATION_CHECK"`
+	AUTH_REVOCATION_CACHE_TTL string `mapstructure:"AUTH_REVOCATION_CACHE_TTL"`
+	// how long user names looked up from user_service are cached, e.g. "5m"
+	USER_CACHE_TTL string `mapstructure:"USER_CACHE_TTL"`
+	// how often the outbox relay looks for task events to publish, e.g. "1s"
+	OUTBOX_POLL_INTERVAL string `mapstructure:"OUTBOX_POLL_INTERVAL"`
+	// consumer group task_service reads the user_events stream with, defaults to "task_service"
+	USER_EVENTS_GROUP string `mapstructure:"USER_EVENTS_GROUP"`
+	// name of this replica within the group, must be unique, defaults to "<hostname>-<pid>"
+	USER_EVENTS_CONSUMER string `mapstructure:"USER_EVENTS_CONSUMER"`
+	// how often an open board WebSocket checks its login is still valid, e.g. "1m"
+	BOARD_SESSION_CHECK_INTERVAL string `mapstructure:"BOARD_SESSION_CHECK_INTERVAL"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -0,0 +1,45 @@
+package auth
+
+const (
+	MethodSession     = "session"
+	MethodJWT         = "jwt"
+	MethodAccessToken = "access_token"
+
+	ScopeTasksRead  = "tasks:read"
+	ScopeTasksWrite = "tasks:write"
+
+	RoleAdmin = "admin"
+)
+
+// Claims describes the authenticated caller, the middleware puts it in the request context under "auth_claims"
+type Claims struct {
+	UserID int `json:"user_id"`
+	// SessionFamily is the "sid" claim of the access token, empty in session mode
+	SessionFamily string   `json:"session_family,omitempty"`
+	Roles         []string `json:"roles,omitempty"`
+	// Method is how the caller authenticated, Scopes only restrict personal access tokens
+	Method string   `json:"method"`
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+func (c Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope is always true for browser logins, a personal access token must have been granted the scope
+func (c Claims) HasScope(scope string) bool {
+	if c.Method != MethodAccessToken {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
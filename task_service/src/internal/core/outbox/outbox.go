@@ -0,0 +1,19 @@
+package outbox
+
+import "time"
+
+// Payload encodings, rows written before the event envelope existed hold the bare JSON event
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// Message is an event stored with the change it describes, waiting to be published to Topic
+type Message struct {
+	Id          int64
+	Topic       string
+	Payload     []byte
+	ContentType string
+	Attempts    int
+	CreatedAt   time.Time
+}
@@ -1,6 +1,10 @@
 package task
 
-import "time"
+import (
+	"events"
+	"task_service/src/internal/core/user"
+	"time"
+)
 
 type Task struct {
 	Id          int       `json:"id"`
@@ -12,7 +16,25 @@ type Task struct {
 	CreatedAt   time.Time `json:"created_at"`
 	Deadline    time.Time `json:"deadline"`
 	Priority    int       `json:"priority"`
+	// filled from user_service when the task is returned, nil when the user could not be looked up
+	AssignedByUser *user.UserInfo `json:"assigned_by_user,omitempty"`
+	AssignedToUser *user.UserInfo `json:"assigned_to_user,omitempty"`
 }
+
+// TaskEventsStream is the Redis stream task events are appended to
+const TaskEventsStream = events.TaskEventsStream
+
+// Task event types, their payload is the TaskChanged message of the shared events.proto
+const (
+	EventTaskCreated = events.EventTaskCreated
+	EventTaskUpdated = events.EventTaskUpdated
+	EventTaskDeleted = events.EventTaskDeleted
+	// EventTaskMoved is only sent to boards, it is a task_updated that changed the status
+	EventTaskMoved = "task_moved"
+	// TaskChangedVersion is the version of the TaskChanged payload written by this service
+	TaskChangedVersion = events.TaskChangedVersion
+)
+
 type TaskEvent struct {
 	EventType  string    `json:"event_type"`
 	TaskID     int       `json:"task_id"`
@@ -20,6 +42,34 @@ type TaskEvent struct {
 	AssignedTo int       `json:"assigned_to"`
 	AssignedBy int       `json:"assigned_by"`
 	Timestamp  time.Time `json:"timestamp"`
+	// ActorID made the change, Watchers follow the task, both are notified along with assigner and assignee
+	ActorID  int   `json:"actor_id"`
+	Watchers []int `json:"watchers,omitempty"`
+	// display names, empty when user_service could not be reached
+	AssignedToName string `json:"assigned_to_name,omitempty"`
+	AssignedByName string `json:"assigned_by_name,omitempty"`
+	// the task before and after the change, Before is nil for a created task and After for a deleted one
+	Before *Task `json:"before,omitempty"`
+	After  *Task `json:"after,omitempty"`
+}
+
+// Board scopes: "my" follows every task the user assigned, is assigned or watches, "task" one task
+const (
+	BoardScopeMine = "my"
+	BoardScopeTask = "task"
+)
+
+// BoardUpdate is what a live board is sent for a task event
+type BoardUpdate struct {
+	Type   string `json:"type"`
+	TaskID int    `json:"task_id"`
+	// the task after the change, nil for a deleted task
+	Task *Task `json:"task,omitempty"`
+	// the status before and after the change, set for task_moved and task_deleted
+	FromStatus string    `json:"from_status,omitempty"`
+	ToStatus   string    `json:"to_status,omitempty"`
+	ActorID    int       `json:"actor_id"`
+	OccurredAt time.Time `json:"occurred_at"`
 }
 
 type TaskStatus struct {
@@ -0,0 +1,23 @@
+package user
+
+import "time"
+
+// EventUserDeleted is published by user_service when an account is deleted
+const EventUserDeleted = "user_deleted"
+
+// UserEventsStream is the Redis stream user_service appends account events to
+const UserEventsStream = "user_events"
+
+type UserEvent struct {
+	EventType string    `json:"event_type"`
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserInfo is the directory entry task responses and events show instead of a bare id
+type UserInfo struct {
+	Id          int    `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Email       string `json:"-"`
+}
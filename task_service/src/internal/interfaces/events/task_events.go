@@ -0,0 +1,115 @@
+package events
+
+import (
+	pb "events/generated"
+	"fmt"
+	"task_service/src/internal/core/task"
+	"task_service/src/internal/core/user"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// EncodeTaskEvent wraps the event in a new envelope with a TaskChanged payload
+func EncodeTaskEvent(event task.TaskEvent) ([]byte, error) {
+	watchers := make([]int64, len(event.Watchers))
+	for i, watcher := range event.Watchers {
+		watchers[i] = int64(watcher)
+	}
+	payload, err := proto.Marshal(&pb.TaskChanged{
+		TaskId:         int64(event.TaskID),
+		TaskName:       event.TaskName,
+		AssignedTo:     int64(event.AssignedTo),
+		AssignedBy:     int64(event.AssignedBy),
+		Watchers:       watchers,
+		AssignedToName: event.AssignedToName,
+		AssignedByName: event.AssignedByName,
+		Before:         taskSnapshot(event.Before),
+		After:          taskSnapshot(event.After),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(&pb.EventEnvelope{
+		Id:         uuid.NewString(),
+		Type:       event.EventType,
+		Version:    task.TaskChangedVersion,
+		OccurredAt: timestamppb.New(event.Timestamp),
+		ActorId:    int64(event.ActorID),
+		Payload:    payload,
+	})
+}
+
+func taskSnapshot(t *task.Task) *pb.TaskSnapshot {
+	if t == nil {
+		return nil
+	}
+	snapshot := &pb.TaskSnapshot{
+		Name:        t.Name,
+		Description: t.Description,
+		Status:      t.TaskStatus,
+		Priority:    int32(t.Priority),
+		Deadline:    timestamppb.New(t.Deadline),
+		AssignedTo:  int64(t.AssignedTo),
+		AssignedBy:  int64(t.AssignedBy),
+	}
+	if t.AssignedToUser != nil {
+		snapshot.AssignedToName = t.AssignedToUser.DisplayName
+	}
+	return snapshot
+}
+
+// DecodeTaskEvent reads back an envelope written by EncodeTaskEvent
+func DecodeTaskEvent(data []byte) (task.TaskEvent, error) {
+	var envelope pb.EventEnvelope
+	if err := proto.Unmarshal(data, &envelope); err != nil {
+		return task.TaskEvent{}, fmt.Errorf("undecodable envelope: %w", err)
+	}
+	if envelope.GetVersion() != task.TaskChangedVersion {
+		return task.TaskEvent{}, fmt.Errorf("unsupported %s version %d", envelope.GetType(), envelope.GetVersion())
+	}
+	var payload pb.TaskChanged
+	if err := proto.Unmarshal(envelope.GetPayload(), &payload); err != nil {
+		return task.TaskEvent{}, fmt.Errorf("undecodable %s payload: %w", envelope.GetType(), err)
+	}
+
+	event := task.TaskEvent{
+		EventType:      envelope.GetType(),
+		TaskID:         int(payload.GetTaskId()),
+		TaskName:       payload.GetTaskName(),
+		AssignedTo:     int(payload.GetAssignedTo()),
+		AssignedBy:     int(payload.GetAssignedBy()),
+		Timestamp:      envelope.GetOccurredAt().AsTime(),
+		ActorID:        int(envelope.GetActorId()),
+		AssignedToName: payload.GetAssignedToName(),
+		AssignedByName: payload.GetAssignedByName(),
+		Before:         snapshotTask(int(payload.GetTaskId()), payload.GetBefore()),
+		After:          snapshotTask(int(payload.GetTaskId()), payload.GetAfter()),
+	}
+	for _, watcher := range payload.GetWatchers() {
+		event.Watchers = append(event.Watchers, int(watcher))
+	}
+	return event, nil
+}
+
+func snapshotTask(taskID int, snapshot *pb.TaskSnapshot) *task.Task {
+	if snapshot == nil {
+		return nil
+	}
+	t := &task.Task{
+		Id:          taskID,
+		Name:        snapshot.GetName(),
+		Description: snapshot.GetDescription(),
+		TaskStatus:  snapshot.GetStatus(),
+		Priority:    int(snapshot.GetPriority()),
+		Deadline:    snapshot.GetDeadline().AsTime(),
+		AssignedTo:  int(snapshot.GetAssignedTo()),
+		AssignedBy:  int(snapshot.GetAssignedBy()),
+	}
+	if snapshot.GetAssignedToName() != "" {
+		t.AssignedToUser = &user.UserInfo{Id: t.AssignedTo, DisplayName: snapshot.GetAssignedToName()}
+	}
+	return t
+}
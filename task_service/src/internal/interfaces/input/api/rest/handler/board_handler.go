@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"task_service/src/internal/core/task"
+	"task_service/src/internal/interfaces/input/api/rest/middleware"
+	pb "task_service/src/internal/interfaces/input/grpc/generated/generated"
+	taskservice "task_service/src/internal/usecase"
+	errorhandling "task_service/src/pkg/error_handling"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	boardWriteWait = 10 * time.Second
+	// the client must answer a ping within boardPongWait, pings go out well before it runs out
+	boardPongWait     = 60 * time.Second
+	boardPingInterval = 25 * time.Second
+	boardMaxCommand   = 4096
+)
+
+// boardCommand is what a board client sends: {"action":"subscribe","scope":"my"} or
+// {"action":"subscribe","scope":"task","task_id":42}, and the same with "unsubscribe"
+type boardCommand struct {
+	Action string `json:"action"`
+	Scope  string `json:"scope"`
+	TaskID int    `json:"task_id"`
+}
+
+// boardReply answers a command, task events are sent as task.BoardUpdate
+type boardReply struct {
+	Type    string `json:"type"`
+	Scope   string `json:"scope,omitempty"`
+	TaskID  int    `json:"task_id,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type BoardHandler struct {
+	taskService        taskservice.TaskService
+	boardHub           *taskservice.BoardHub
+	grpcClient         pb.SessionValidatorClient
+	sessionCheckPeriod time.Duration
+	// the default origin check only lets pages of this host open a board with their cookies
+	upgrader websocket.Upgrader
+}
+
+func NewBoardHandler(taskcase taskservice.TaskService, hub *taskservice.BoardHub, grpcClient pb.SessionValidatorClient, sessionCheckPeriod time.Duration) *BoardHandler {
+	return &BoardHandler{
+		taskService:        taskcase,
+		boardHub:           hub,
+		grpcClient:         grpcClient,
+		sessionCheckPeriod: sessionCheckPeriod,
+	}
+}
+
+// Board upgrades to a WebSocket that streams the task events of the scopes the client
+// subscribes to. Every subscription and, every sessionCheckPeriod, the open socket are checked
+// against user_service, the socket is closed once the login behind it ended.
+func (h *BoardHandler) Board(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+	sessionCheck := middleware.NewSessionCheck(h.grpcClient, r)
+
+	// Upgrade answers failed handshakes itself
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Board handshake failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	sub := h.boardHub.Subscribe(userID)
+	defer h.boardHub.Unsubscribe(sub)
+
+	// the request context is not cancelled when a hijacked connection drops
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	replies := make(chan boardReply, 8)
+	go h.readCommands(ctx, cancel, conn, sub, userID, sessionCheck, replies)
+
+	pings := time.NewTicker(boardPingInterval)
+	defer pings.Stop()
+	sessionChecks := time.NewTicker(h.sessionCheckPeriod)
+	defer sessionChecks.Stop()
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case <-sub.Closed:
+			closeBoard(conn, websocket.CloseTryAgainLater, "board fell behind")
+			return
+		case update := <-sub.Updates:
+			err = writeBoardMessage(conn, update)
+		case reply := <-replies:
+			err = writeBoardMessage(conn, reply)
+		case <-pings.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(boardWriteWait))
+		case <-sessionChecks.C:
+			if err := sessionCheck(ctx); errors.Is(err, middleware.ErrSessionEnded) {
+				closeBoard(conn, websocket.ClosePolicyViolation, "session ended")
+				return
+			} else if err != nil {
+				// user_service being unreachable does not end the session, the next check decides
+				log.Printf("Board session check for user %d failed: %v", userID, err)
+			}
+		}
+		if err != nil {
+			log.Printf("Closing board of user %d: %v", userID, err)
+			return
+		}
+	}
+}
+
+// readCommands applies the client's commands to the subscription until the connection fails,
+// then cancels the board
+func (h *BoardHandler) readCommands(ctx context.Context, cancel context.CancelFunc, conn *websocket.Conn, sub *taskservice.BoardSubscription, userID int, sessionCheck middleware.SessionCheck, replies chan<- boardReply) {
+	defer cancel()
+	conn.SetReadLimit(boardMaxCommand)
+	conn.SetReadDeadline(time.Now().Add(boardPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(boardPongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("Board of user %d closed: %v", userID, err)
+			}
+			return
+		}
+
+		var command boardCommand
+		var reply boardReply
+		if err := json.Unmarshal(data, &command); err != nil {
+			reply = boardReply{Type: "error", Message: "Invalid Command"}
+		} else {
+			reply = h.applyCommand(ctx, sub, userID, sessionCheck, command)
+		}
+
+		select {
+		case replies <- reply:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (h *BoardHandler) applyCommand(ctx context.Context, sub *taskservice.BoardSubscription, userID int, sessionCheck middleware.SessionCheck, command boardCommand) boardReply {
+	failed := func(message string) boardReply {
+		return boardReply{Type: "error", Scope: command.Scope, TaskID: command.TaskID, Message: message}
+	}
+
+	switch command.Action {
+	case "subscribe":
+		if err := sessionCheck(ctx); err != nil {
+			log.Printf("Board subscription of user %d refused: %v", userID, err)
+			return failed("Session Could Not Be Verified")
+		}
+		switch command.Scope {
+		case task.BoardScopeMine:
+			sub.SetMine(true)
+		case task.BoardScopeTask:
+			if err := h.taskService.CheckTaskAccess(command.TaskID, userID); err != nil {
+				return failed(err.Error())
+			}
+			sub.Follow(command.TaskID)
+		default:
+			return failed("Unknown Scope")
+		}
+		return boardReply{Type: "subscribed", Scope: command.Scope, TaskID: command.TaskID}
+	case "unsubscribe":
+		switch command.Scope {
+		case task.BoardScopeMine:
+			sub.SetMine(false)
+		case task.BoardScopeTask:
+			sub.Unfollow(command.TaskID)
+		default:
+			return failed("Unknown Scope")
+		}
+		return boardReply{Type: "unsubscribed", Scope: command.Scope, TaskID: command.TaskID}
+	default:
+		return failed("Unknown Action")
+	}
+}
+
+func writeBoardMessage(conn *websocket.Conn, message interface{}) error {
+	conn.SetWriteDeadline(time.Now().Add(boardWriteWait))
+	return conn.WriteJSON(message)
+}
+
+func closeBoard(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(boardWriteWait))
+}
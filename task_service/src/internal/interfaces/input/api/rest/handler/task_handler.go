@@ -3,8 +3,11 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"task_service/src/internal/core/auth"
 	"task_service/src/internal/core/task"
 	taskservice "task_service/src/internal/usecase"
 	errorhandling "task_service/src/pkg/error_handling"
@@ -98,7 +101,7 @@ func (t *TaskHandler) GetMy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tasks, err := t.taskService.GetTasksByUserID(userId)
+	tasks, err := t.taskService.GetTasksByUserID(r.Context(), userId)
 	if err != nil {
 		errorhandling.HandleError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -143,6 +146,94 @@ func (t *TaskHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	pkgresponse.WriteResponse(w, http.StatusOK, response)
 }
 
+func (t *TaskHandler) Watch(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	taskID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		errorhandling.HandleError(w, "Invalid Task ID", http.StatusBadRequest)
+		return
+	}
+
+	watcherID, ok := watcherFromBody(w, r, userId)
+	if !ok {
+		return
+	}
+	claims, _ := r.Context().Value("auth_claims").(auth.Claims)
+
+	err = t.taskService.WatchTask(r.Context(), taskID, userId, watcherID, claims.HasRole(auth.RoleAdmin))
+	if errors.Is(err, taskservice.ErrNotTaskAssigner) {
+		errorhandling.HandleError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		errorhandling.HandleError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Watching Task",
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+func (t *TaskHandler) Unwatch(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user_id").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	taskID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		errorhandling.HandleError(w, "Invalid Task ID", http.StatusBadRequest)
+		return
+	}
+
+	watcherID, ok := watcherFromBody(w, r, userId)
+	if !ok {
+		return
+	}
+	claims, _ := r.Context().Value("auth_claims").(auth.Claims)
+
+	err = t.taskService.UnwatchTask(r.Context(), taskID, userId, watcherID, claims.HasRole(auth.RoleAdmin))
+	if errors.Is(err, taskservice.ErrNotTaskAssigner) {
+		errorhandling.HandleError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		errorhandling.HandleError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Stopped Watching Task",
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+// watcherFromBody reads the optional {"user_id": ...} the assigner sends to change another user's
+// watch, without it the caller's own watch changes
+func watcherFromBody(w http.ResponseWriter, r *http.Request, userId int) (int, bool) {
+	var request struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		errorhandling.HandleError(w, "Invalid Request Body", http.StatusBadRequest)
+		return 0, false
+	}
+	if request.UserID == 0 {
+		return userId, true
+	}
+	return request.UserID, true
+}
+
 func (t *TaskHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
 	var taskStatus task.TaskStatus
 	err := json.NewDecoder(r.Body).Decode(&taskStatus)
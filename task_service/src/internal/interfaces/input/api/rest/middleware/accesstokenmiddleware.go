@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"task_service/src/internal/core/auth"
+	pb "task_service/src/internal/interfaces/input/grpc/generated/generated"
+	errorhandling "task_service/src/pkg/error_handling"
+)
+
+// AccessTokenMiddleware authenticates requests carrying "Authorization: Bearer <personal access token>"
+// through user_service, and hands every other request to cookieAuth
+func AccessTokenMiddleware(grpcClient pb.SessionValidatorClient, cookieAuth func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		withCookies := cookieAuth(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization := r.Header.Get("Authorization")
+			if authorization == "" {
+				withCookies.ServeHTTP(w, r)
+				return
+			}
+
+			token, found := strings.CutPrefix(authorization, "Bearer ")
+			if !found || token == "" {
+				errorhandling.HandleError(w, "Authorization header must be a Bearer token", http.StatusUnauthorized)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), grpcTimeout)
+			defer cancel()
+			resp, err := grpcClient.ValidateAccessToken(ctx, &pb.ValidateAccessTokenRequest{
+				Token: token,
+			})
+			if err != nil || !resp.Valid {
+				errorhandling.HandleError(w, "invalid access token", http.StatusUnauthorized)
+				return
+			}
+
+			userID, err := strconv.Atoi(resp.UserId)
+			if err != nil {
+				errorhandling.HandleError(w, "invalid user ID from access token", http.StatusInternalServerError)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), auth.Claims{
+				UserID: userID,
+				Method: auth.MethodAccessToken,
+				Scopes: resp.Scopes,
+			})))
+		})
+	}
+}
+
+// RequireScope rejects personal access tokens that were not granted scope
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("auth_claims").(auth.Claims)
+			if !ok {
+				errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+				return
+			}
+			if !claims.HasScope(scope) {
+				errorhandling.HandleError(w, "access token is missing scope "+scope, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"task_service/src/internal/adaptors/jwks"
+	"task_service/src/internal/core/auth"
+	pb "task_service/src/internal/interfaces/input/grpc/generated/generated"
+	errorhandling "task_service/src/pkg/error_handling"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type accessTokenClaims struct {
+	Uid   int      `json:"uid"`
+	Sid   string   `json:"sid"`
+	Roles []string `json:"roles"`
+	jwt.RegisteredClaims
+}
+
+// JWTAuthMiddleware verifies the "at" access token locally against user_service's published keys.
+// When grpcClient is not nil the token's session family is also checked for revocation,
+// with answers cached for revocationTTL so only one call per session goes out in that window.
+func JWTAuthMiddleware(keyCache *jwks.KeyCache, grpcClient pb.SessionValidatorClient, revocationTTL time.Duration) func(http.Handler) http.Handler {
+	revocations := newRevocationCache(revocationTTL)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie("at")
+			if err != nil {
+				errorhandling.HandleError(w, "Access Token Cookie is missing", http.StatusUnauthorized)
+				return
+			}
+
+			claims := &accessTokenClaims{}
+			_, err = jwt.ParseWithClaims(cookie.Value, claims, func(token *jwt.Token) (interface{}, error) {
+				kid, ok := token.Header["kid"].(string)
+				if !ok {
+					return nil, errors.New("token has no kid")
+				}
+				key, err := keyCache.Key(r.Context(), kid)
+				if err != nil {
+					return nil, err
+				}
+				if token.Method.Alg() != key.Alg {
+					return nil, errors.New("signing method does not match key")
+				}
+				return key.Key, nil
+			}, jwt.WithValidMethods([]string{"RS256", "EdDSA"}), jwt.WithExpirationRequired())
+			if err != nil {
+				log.Printf("Rejected access token: %v", err)
+				errorhandling.HandleError(w, "invalid access token", http.StatusUnauthorized)
+				return
+			}
+
+			if grpcClient != nil {
+				active, err := revocations.isActive(r.Context(), grpcClient, claims.Sid)
+				if err != nil {
+					log.Printf("Revocation check failed: %v", err)
+					errorhandling.HandleError(w, "unable to verify session", http.StatusServiceUnavailable)
+					return
+				}
+				if !active {
+					errorhandling.HandleError(w, "session revoked", http.StatusUnauthorized)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), auth.Claims{
+				UserID:        claims.Uid,
+				SessionFamily: claims.Sid,
+				Roles:         claims.Roles,
+				Method:        auth.MethodJWT,
+			})))
+		})
+	}
+}
+
+type revocationEntry struct {
+	active    bool
+	checkedAt time.Time
+}
+
+type revocationCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]revocationEntry
+}
+
+func newRevocationCache(ttl time.Duration) *revocationCache {
+	return &revocationCache{ttl: ttl, entries: map[string]revocationEntry{}}
+}
+
+func (c *revocationCache) isActive(ctx context.Context, grpcClient pb.SessionValidatorClient, sessionFamily string) (bool, error) {
+	if sessionFamily == "" {
+		return false, nil
+	}
+
+	c.mu.Lock()
+	entry, found := c.entries[sessionFamily]
+	c.mu.Unlock()
+	if found && time.Since(entry.checkedAt) < c.ttl {
+		return entry.active, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, grpcTimeout)
+	defer cancel()
+	resp, err := grpcClient.IsSessionActive(ctx, &pb.IsSessionActiveRequest{
+		SessionFamily: sessionFamily,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for family, e := range c.entries {
+		if now.Sub(e.checkedAt) >= c.ttl {
+			delete(c.entries, family)
+		}
+	}
+	c.entries[sessionFamily] = revocationEntry{active: resp.Active, checkedAt: now}
+	return resp.Active, nil
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"task_service/src/internal/core/auth"
+	pb "task_service/src/internal/interfaces/input/grpc/generated/generated"
+)
+
+// ErrSessionEnded is returned by a SessionCheck once the credentials it checks were logged out,
+// revoked or expired
+var ErrSessionEnded = errors.New("session ended")
+
+// SessionCheck asks user_service again whether the credentials a request was authenticated with
+// are still valid. Long-lived connections call it to notice a logout after their handshake.
+type SessionCheck func(ctx context.Context) error
+
+// NewSessionCheck builds the check for the credentials the auth middleware accepted on r, it
+// must run after that middleware
+func NewSessionCheck(grpcClient pb.SessionValidatorClient, r *http.Request) SessionCheck {
+	claims, ok := r.Context().Value("auth_claims").(auth.Claims)
+	if !ok {
+		return func(context.Context) error { return ErrSessionEnded }
+	}
+
+	switch claims.Method {
+	case auth.MethodAccessToken:
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		return func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, grpcTimeout)
+			defer cancel()
+			resp, err := grpcClient.ValidateAccessToken(ctx, &pb.ValidateAccessTokenRequest{
+				Token: token,
+			})
+			if err != nil {
+				return err
+			}
+			return sameUser(resp.Valid, resp.UserId, claims.UserID)
+		}
+	case auth.MethodJWT:
+		// the access token expires long before a connection does, its session family outlives it
+		return func(ctx context.Context) error {
+			if claims.SessionFamily == "" {
+				return ErrSessionEnded
+			}
+			ctx, cancel := context.WithTimeout(ctx, grpcTimeout)
+			defer cancel()
+			resp, err := grpcClient.IsSessionActive(ctx, &pb.IsSessionActiveRequest{
+				SessionFamily: claims.SessionFamily,
+			})
+			if err != nil {
+				return err
+			}
+			if !resp.Active {
+				return ErrSessionEnded
+			}
+			return nil
+		}
+	default:
+		var sessionID string
+		if cookie, err := r.Cookie("sess"); err == nil {
+			sessionID = cookie.Value
+		}
+		return func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, grpcTimeout)
+			defer cancel()
+			resp, err := grpcClient.ValidateSession(ctx, &pb.ValidateSessionRequest{
+				SessionId: sessionID,
+			})
+			if err != nil {
+				return err
+			}
+			return sameUser(resp.Valid, resp.UserId, claims.UserID)
+		}
+	}
+}
+
+func sameUser(valid bool, userID string, expected int) error {
+	if !valid || userID != strconv.Itoa(expected) {
+		return ErrSessionEnded
+	}
+	return nil
+}
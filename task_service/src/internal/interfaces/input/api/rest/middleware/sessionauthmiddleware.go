@@ -4,10 +4,15 @@ import (
 	"context"
 	"net/http"
 	"strconv"
+	"task_service/src/internal/core/auth"
 	pb "task_service/src/internal/interfaces/input/grpc/generated/generated"
 	errorhandling "task_service/src/pkg/error_handling"
+	"time"
 )
 
+// grpcTimeout bounds every call to user_service made while authenticating a request
+const grpcTimeout = 3 * time.Second
+
 func SessionAuthMiddleware(grpcClient pb.SessionValidatorClient) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -19,7 +24,9 @@ func SessionAuthMiddleware(grpcClient pb.SessionValidatorClient) func(http.Handl
 			}
 			sessionID := cookie.Value
 			// gRPC call to user service for session validation
-			resp, err := grpcClient.ValidateSession(context.Background(), &pb.ValidateSessionRequest{
+			ctx, cancel := context.WithTimeout(r.Context(), grpcTimeout)
+			defer cancel()
+			resp, err := grpcClient.ValidateSession(ctx, &pb.ValidateSessionRequest{
 				SessionId: sessionID,
 			})
 			if err != nil || !resp.Valid {
@@ -33,8 +40,13 @@ func SessionAuthMiddleware(grpcClient pb.SessionValidatorClient) func(http.Handl
 				errorhandling.HandleError(w, "invalid user ID from session", http.StatusInternalServerError)
 				return
 			}
-			ctx := context.WithValue(r.Context(), "user_id", userID)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), auth.Claims{UserID: userID, Roles: resp.Roles, Method: auth.MethodSession})))
 		})
 	}
 }
+
+// withClaims stores the caller in the context, "user_id" stays for the handlers that only need the ID
+func withClaims(ctx context.Context, claims auth.Claims) context.Context {
+	ctx = context.WithValue(ctx, "user_id", claims.UserID)
+	return context.WithValue(ctx, "auth_claims", claims)
+}
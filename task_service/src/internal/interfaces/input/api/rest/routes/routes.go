@@ -3,23 +3,26 @@ package routes
 import (
 	"net/http"
 
+	"task_service/src/internal/core/auth"
 	taskhandler "task_service/src/internal/interfaces/input/api/rest/handler"
 	"task_service/src/internal/interfaces/input/api/rest/middleware"
-	pb "task_service/src/internal/interfaces/input/grpc/generated/generated"
 
 	"github.com/go-chi/chi/v5"
 )
 
-func InitRoutes(taskHandler *taskhandler.TaskHandler, grpcClient pb.SessionValidatorClient) http.Handler {
+func InitRoutes(taskHandler *taskhandler.TaskHandler, boardHandler *taskhandler.BoardHandler, authMiddleware func(http.Handler) http.Handler) http.Handler {
 	router := chi.NewRouter()
 
 	router.Route("/v1/tasks", func(r chi.Router) {
-		r.Use(middleware.SessionAuthMiddleware(grpcClient))
-		r.Post("/create", taskHandler.Create)
-		r.Put("/update", taskHandler.Update)
-		r.Delete("/delete/{id}", taskHandler.Delete)
-		r.Get("/my", taskHandler.GetMy)
-		r.Post("/status", taskHandler.GetStatus)
+		r.Use(authMiddleware)
+		r.With(middleware.RequireScope(auth.ScopeTasksWrite)).Post("/create", taskHandler.Create)
+		r.With(middleware.RequireScope(auth.ScopeTasksWrite)).Put("/update", taskHandler.Update)
+		r.With(middleware.RequireScope(auth.ScopeTasksWrite)).Delete("/delete/{id}", taskHandler.Delete)
+		r.With(middleware.RequireScope(auth.ScopeTasksRead)).Get("/my", taskHandler.GetMy)
+		r.With(middleware.RequireScope(auth.ScopeTasksRead)).Post("/status", taskHandler.GetStatus)
+		r.With(middleware.RequireScope(auth.ScopeTasksWrite)).Post("/{id}/watch", taskHandler.Watch)
+		r.With(middleware.RequireScope(auth.ScopeTasksWrite)).Delete("/{id}/watch", taskHandler.Unwatch)
+		r.With(middleware.RequireScope(auth.ScopeTasksRead)).Get("/board/ws", boardHandler.Board)
 	})
 
 	return router
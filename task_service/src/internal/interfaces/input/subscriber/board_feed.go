@@ -0,0 +1,72 @@
+package subscriber
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	redisclient "task_service/src/internal/adaptors/redis"
+	"task_service/src/internal/core/task"
+	"task_service/src/internal/interfaces/events"
+	taskusecase "task_service/src/internal/usecase"
+	"time"
+)
+
+const (
+	boardFeedBlock    = 5 * time.Second
+	boardFeedBatch    = 100
+	boardFeedRetryGap = time.Second
+)
+
+// BoardFeed tails the task event stream into the board hub. It reads without a consumer group,
+// so every replica sees every event, and starts at the newest entry: boards load the current
+// tasks over REST and only need the changes.
+type BoardFeed struct {
+	redisClient *redisclient.RedisClient
+	hub         *taskusecase.BoardHub
+}
+
+func NewBoardFeed(redisClient *redisclient.RedisClient, hub *taskusecase.BoardHub) *BoardFeed {
+	return &BoardFeed{
+		redisClient: redisClient,
+		hub:         hub,
+	}
+}
+
+func (f *BoardFeed) Run(ctx context.Context) {
+	log.Println("Starting board feed...")
+	lastID := "$"
+
+	for {
+		messages, err := f.redisClient.ReadStream(ctx, task.TaskEventsStream, lastID, boardFeedBatch, boardFeedBlock)
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Println("Board feed shutting down...")
+				return
+			}
+			log.Printf("Error reading task events for boards: %v", err)
+			time.Sleep(boardFeedRetryGap)
+			continue
+		}
+
+		for _, msg := range messages {
+			lastID = msg.ID
+			event, err := decodeBoardEvent(msg.Values)
+			if err != nil {
+				log.Printf("Skipping task event %s on boards: %v", msg.ID, err)
+				continue
+			}
+			f.hub.Publish(event)
+		}
+	}
+}
+
+// decodeBoardEvent reads the envelope, or the JSON event appended before envelopes existed
+func decodeBoardEvent(values map[string]interface{}) (task.TaskEvent, error) {
+	if envelope, ok := values["envelope"].(string); ok {
+		return events.DecodeTaskEvent([]byte(envelope))
+	}
+	var event task.TaskEvent
+	payload, _ := values["payload"].(string)
+	err := json.Unmarshal([]byte(payload), &event)
+	return event, err
+}
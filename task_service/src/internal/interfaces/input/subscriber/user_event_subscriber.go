@@ -0,0 +1,120 @@
+package subscriber
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	redisclient "task_service/src/internal/adaptors/redis"
+	"task_service/src/internal/core/user"
+	task "task_service/src/internal/usecase"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	userEventsBatch = 10
+	userEventsBlock = 5 * time.Second
+	// an unacknowledged event is retried once it was pending this long
+	userEventsReclaimIdle = time.Minute
+)
+
+// UserEventSubscriber reads account events from user_service through a consumer group, so each
+// event is handled by one replica and events appended while task_service was down are not lost
+type UserEventSubscriber struct {
+	redisClient *redisclient.RedisClient
+	taskService *task.TaskService
+	group       string
+	consumer    string
+}
+
+// consumer names this replica within group and must be unique across replicas
+func NewUserEventSubscriber(redisClient *redisclient.RedisClient, taskService *task.TaskService, group string, consumer string) *UserEventSubscriber {
+	return &UserEventSubscriber{
+		redisClient: redisClient,
+		taskService: taskService,
+		group:       group,
+		consumer:    consumer,
+	}
+}
+
+// StartListening consumes the user event stream until ctx is done. An event is acknowledged once it
+// was handled; a failed one stays pending and is retried when it is reclaimed.
+func (s *UserEventSubscriber) StartListening(ctx context.Context) {
+	log.Printf("Consuming %s as %s in group %s", user.UserEventsStream, s.consumer, s.group)
+
+	for {
+		err := s.redisClient.EnsureConsumerGroup(ctx, user.UserEventsStream, s.group)
+		if err == nil {
+			break
+		}
+		log.Printf("Failed to create consumer group: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+
+	reclaim := time.NewTicker(userEventsReclaimIdle / 2)
+	defer reclaim.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("User event subscriber shutting down...")
+			return
+		case <-reclaim.C:
+			messages, err := s.redisClient.ClaimIdleMessages(ctx, user.UserEventsStream, s.group, s.consumer, userEventsReclaimIdle, userEventsBatch)
+			if err != nil {
+				log.Printf("Error reclaiming user events: %v", err)
+				continue
+			}
+			for _, message := range messages {
+				log.Printf("Retrying user event %s", message.ID)
+				s.deliver(ctx, message)
+			}
+		default:
+			messages, err := s.redisClient.ReadStreamGroup(ctx, user.UserEventsStream, s.group, s.consumer, userEventsBatch, userEventsBlock)
+			if err != nil {
+				log.Printf("Error reading user events: %v", err)
+				time.Sleep(time.Second)
+				continue
+			}
+			for _, message := range messages {
+				s.deliver(ctx, message)
+			}
+		}
+	}
+}
+
+func (s *UserEventSubscriber) deliver(ctx context.Context, message redis.XMessage) {
+	if err := s.handleUserEvent(message); err != nil {
+		// left pending, it is retried once it has been idle for userEventsReclaimIdle
+		log.Printf("Failed to process user event %s: %v", message.ID, err)
+		return
+	}
+	if err := s.redisClient.AckStream(ctx, user.UserEventsStream, s.group, message.ID); err != nil {
+		log.Printf("Failed to acknowledge user event %s: %v", message.ID, err)
+	}
+}
+
+// handleUserEvent reports an error only for events worth retrying, reassigning the tasks of a
+// deleted user twice changes nothing
+func (s *UserEventSubscriber) handleUserEvent(message redis.XMessage) error {
+	payload, _ := message.Values["payload"].(string)
+	var event user.UserEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		// it would fail the same way on every delivery
+		log.Printf("Skipping invalid user event %s: %v", message.ID, err)
+		return nil
+	}
+
+	// other account events are only of interest to notification_service
+	if event.EventType != user.EventUserDeleted {
+		return nil
+	}
+
+	log.Printf("Received user event: %s for user %d", event.EventType, event.UserID)
+	return s.taskService.HandleUserDeleted(event.UserID)
+}
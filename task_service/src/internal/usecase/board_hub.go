@@ -0,0 +1,164 @@
+package task
+
+import (
+	"log"
+	"sync"
+	"task_service/src/internal/core/task"
+)
+
+// boardSubscriptionBuffer is how many updates may wait for a slow board before it is dropped
+const boardSubscriptionBuffer = 64
+
+// BoardSubscription receives the task events of one open board while it is open. What it receives
+// is chosen with SetMine and Follow. Closed is closed when the hub dropped the subscription
+// because it fell behind.
+type BoardSubscription struct {
+	Updates <-chan task.BoardUpdate
+	Closed  <-chan struct{}
+
+	userID    int
+	updates   chan task.BoardUpdate
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu    sync.Mutex
+	mine  bool
+	tasks map[int]bool
+}
+
+// SetMine turns the "my tasks" scope on or off
+func (s *BoardSubscription) SetMine(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mine = on
+}
+
+// Follow adds one task to the subscription, the caller checks the user may see it
+func (s *BoardSubscription) Follow(taskID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[taskID] = true
+}
+
+func (s *BoardSubscription) Unfollow(taskID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tasks, taskID)
+}
+
+// matches tells whether the event belongs on the board. A followed task the user lost access to
+// is sent this last event and then unfollowed.
+func (s *BoardSubscription) matches(event task.TaskEvent) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	involved := involves(event, s.userID)
+	if s.tasks[event.TaskID] {
+		if !involved || event.EventType == task.EventTaskDeleted {
+			delete(s.tasks, event.TaskID)
+		}
+		return true
+	}
+	return s.mine && involved
+}
+
+func (s *BoardSubscription) close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+}
+
+// involves tells whether the user assigned, is assigned or watches the task, or was its
+// assignee before the change
+func involves(event task.TaskEvent, userID int) bool {
+	if event.AssignedTo == userID || event.AssignedBy == userID {
+		return true
+	}
+	if event.Before != nil && event.Before.AssignedTo == userID {
+		return true
+	}
+	for _, watcher := range event.Watchers {
+		if watcher == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// BoardHub pushes task events to the open boards. Every replica runs one and is fed every event
+// from the task event stream, whichever replica made the change.
+type BoardHub struct {
+	mu            sync.Mutex
+	subscriptions map[*BoardSubscription]struct{}
+}
+
+func NewBoardHub() *BoardHub {
+	return &BoardHub{
+		subscriptions: make(map[*BoardSubscription]struct{}),
+	}
+}
+
+// Subscribe opens a board for the user with nothing selected, it must be closed with Unsubscribe
+func (h *BoardHub) Subscribe(userID int) *BoardSubscription {
+	updates := make(chan task.BoardUpdate, boardSubscriptionBuffer)
+	closed := make(chan struct{})
+	sub := &BoardSubscription{
+		Updates: updates,
+		Closed:  closed,
+		userID:  userID,
+		updates: updates,
+		closed:  closed,
+		tasks:   make(map[int]bool),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscriptions[sub] = struct{}{}
+	return sub
+}
+
+func (h *BoardHub) Unsubscribe(sub *BoardSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscriptions, sub)
+	sub.close()
+}
+
+// Publish hands the event to every board it belongs on. A board that can't keep up is dropped
+// rather than holding up the others, its client reconnects and reloads.
+func (h *BoardHub) Publish(event task.TaskEvent) {
+	update := boardUpdate(event)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscriptions {
+		if !sub.matches(event) {
+			continue
+		}
+		select {
+		case sub.updates <- update:
+		default:
+			log.Printf("Dropping slow board of user %d", sub.userID)
+			delete(h.subscriptions, sub)
+			sub.close()
+		}
+	}
+}
+
+// boardUpdate tells a status change apart from other updates, boards move the card for it
+func boardUpdate(event task.TaskEvent) task.BoardUpdate {
+	update := task.BoardUpdate{
+		Type:       event.EventType,
+		TaskID:     event.TaskID,
+		Task:       event.After,
+		ActorID:    event.ActorID,
+		OccurredAt: event.Timestamp,
+	}
+	switch {
+	case event.EventType == task.EventTaskDeleted && event.Before != nil:
+		update.FromStatus = event.Before.TaskStatus
+	case event.EventType == task.EventTaskUpdated && event.Before != nil && event.After != nil &&
+		event.Before.TaskStatus != event.After.TaskStatus:
+		update.Type = task.EventTaskMoved
+		update.FromStatus = event.Before.TaskStatus
+		update.ToStatus = event.After.TaskStatus
+	}
+	return update
+}
@@ -2,29 +2,48 @@ package task
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"log"
 	"strconv"
 	"task_service/src/internal/adaptors/persistance"
-	"task_service/src/internal/adaptors/redis/notification"
+	client "task_service/src/internal/adaptors/user_grpc_client"
 	"task_service/src/internal/core/task"
+	"task_service/src/internal/core/user"
 	pb "task_service/src/internal/interfaces/input/grpc/generated/generated"
 	"time"
 )
 
+// ErrNotTaskAssigner is returned when someone other than the assigner or an admin changes
+// another user's watch on a task
+var ErrNotTaskAssigner = errors.New("Only the Assigner Can Change Watchers")
+
+// taskStore is the part of persistance.TaskRepo the task use cases need
+type taskStore interface {
+	CreateNewTask(task1 task.TaskCreate, event persistance.TaskEventFunc) (task.Task, int, error)
+	UpdateOldTask(task1 task.Task, event persistance.TaskEventFunc) (task.Task, error)
+	GetTaskByID(taskID int) (task.Task, error)
+	DeleteTask(taskID int, event persistance.TaskEventFunc) error
+	GetAllTask() ([]task.Task, error)
+	GetTasksByUserID(userID int) ([]task.Task, error)
+	GetUserTaskDb(taskStatus task.TaskStatus) (int, task.TaskStatus, error)
+	ReassignTasksOfUser(userID int, event persistance.TaskEventFunc) ([]task.Task, error)
+	AddWatcher(taskID int, userID int) error
+	RemoveWatcher(taskID int, userID int) error
+}
+
 type TaskService struct {
-	taskRepo            persistance.TaskRepo
-	notificationService *notification.NotificationService
-	grpcClient          pb.SessionValidatorClient
+	taskRepo      taskStore
+	grpcClient    pb.SessionValidatorClient
+	userDirectory *client.UserDirectory
 }
 
-// Constructor with notification service and gRPC client
-func NewTaskService(taskRepo persistance.TaskRepo, notificationService *notification.NotificationService, grpcClient pb.SessionValidatorClient) TaskService {
+// Constructor with gRPC client and the user directory used to show names, task events go
+// through the outbox written by taskRepo
+func NewTaskService(taskRepo taskStore, grpcClient pb.SessionValidatorClient, userDirectory *client.UserDirectory) TaskService {
 	return TaskService{
-		taskRepo:            taskRepo,
-		notificationService: notificationService,
-		grpcClient:          grpcClient,
+		taskRepo:      taskRepo,
+		grpcClient:    grpcClient,
+		userDirectory: userDirectory,
 	}
 }
 
@@ -47,14 +66,17 @@ func (t *TaskService) CreateTask(ctx context.Context, taskData task.TaskCreate,
 		}
 	}
 
-	createdTask, count, err := t.taskRepo.CreateNewTask(taskData)
+	// names are resolved before the transaction, the event is built while it is open
+	users := t.userDirectory.Lookup(ctx, []int{taskData.AssignedBy, taskData.AssignedTo, userID})
+	createdTask, count, err := t.taskRepo.CreateNewTask(taskData, func(_ *task.Task, created *task.Task, _ []int) task.TaskEvent {
+		return t.taskEvent(task.EventTaskCreated, nil, created, userID, nil, users)
+	})
 	if err != nil {
 		log.Printf("Error creating task: %v", err)
 		return task.Task{}, count, errors.New("Failed to Create Task")
 	}
 
-	t.publishTaskEvent("task_created", createdTask, userID)
-	return createdTask, count, nil
+	return t.withUsers(ctx, []task.Task{createdTask})[0], count, nil
 }
 
 // UpdateTask + notification
@@ -76,86 +98,228 @@ func (t *TaskService) UpdateTask(ctx context.Context, taskData task.Task, userID
 		}
 	}
 
+	// names are resolved before the task is locked, a slow user_service must not hold the row
+	ids := []int{taskData.AssignedBy, taskData.AssignedTo, userID}
+	if existing, err := t.taskRepo.GetTaskByID(taskData.Id); err == nil {
+		ids = append(ids, existing.AssignedBy, existing.AssignedTo)
+	}
+	users := t.userDirectory.Lookup(ctx, ids)
+
 	// updation
-	updatedTask, err := t.taskRepo.UpdateOldTask(taskData)
+	updatedTask, err := t.taskRepo.UpdateOldTask(taskData, func(before *task.Task, updated *task.Task, watchers []int) task.TaskEvent {
+		return t.taskEvent(task.EventTaskUpdated, before, updated, userID, watchers, users)
+	})
 	if err != nil {
 		log.Printf("Error updating task: %v", err)
 		return task.Task{}, errors.New("Failed to Update Task")
 	}
 
-	// Send notification
-	t.publishTaskEvent("task_updated", updatedTask, userID)
-	return updatedTask, nil
+	return t.withUsers(ctx, []task.Task{updatedTask})[0], nil
 }
 
 // DeleteTask + notification
 func (t *TaskService) DeleteTask(ctx context.Context, taskID int, userID int) error {
-	// getting task details for notifications
-	taskData, err := t.taskRepo.GetTaskByID(taskID)
+	// checking the task exists before deleting it
+	existing, err := t.taskRepo.GetTaskByID(taskID)
 	if err != nil {
 		log.Printf("Error getting task by ID: %v", err)
 		return errors.New("Task Not Found")
 	}
+	users := t.userDirectory.Lookup(ctx, []int{existing.AssignedBy, existing.AssignedTo, userID})
 
 	// deleting task
-	err = t.taskRepo.DeleteTask(taskID)
+	err = t.taskRepo.DeleteTask(taskID, func(deleted *task.Task, _ *task.Task, watchers []int) task.TaskEvent {
+		return t.taskEvent(task.EventTaskDeleted, deleted, nil, userID, watchers, users)
+	})
 	if err != nil {
 		log.Printf("Error deleting task: %v", err)
 		return errors.New("Failed to Delete Task")
 	}
 
-	// Send notification
-	t.publishTaskEvent("task_deleted", taskData, userID)
 	return nil
 }
 
 // created but not used
-func (t *TaskService) GetAllTasks() ([]task.Task, error) {
+func (t *TaskService) GetAllTasks(ctx context.Context) ([]task.Task, error) {
 	tasks, err := t.taskRepo.GetAllTask()
 	if err != nil {
 		log.Printf("Error getting all tasks: %v", err)
 		return []task.Task{}, errors.New("Failed to Retrieve Tasks")
 	}
-	return tasks, nil
+	return t.withUsers(ctx, tasks), nil
 }
 
-func (t *TaskService) GetTasksByUserID(userID int) ([]task.Task, error) {
+func (t *TaskService) GetTasksByUserID(ctx context.Context, userID int) ([]task.Task, error) {
 	tasks, err := t.taskRepo.GetTasksByUserID(userID)
 	if err != nil {
 		log.Printf("Error getting tasks by user ID: %v", err)
 		return []task.Task{}, errors.New("Failed to Retrieve User Tasks")
 	}
-	return tasks, nil
+	return t.withUsers(ctx, tasks), nil
 }
 
-func (t *TaskService) publishTaskEvent(eventType string, task1 task.Task, userID int) {
-	if t.notificationService == nil {
-		log.Printf("Notification service not available, skipping event publication")
-		return
+// HandleUserDeleted reassigns the open tasks of a deleted user to their assigners, the deleted
+// user's remaining tasks keep pointing at the anonymized account
+func (t *TaskService) HandleUserDeleted(userID int) error {
+	// the assigners get the tasks back, their names are resolved before the tasks are changed
+	ids := []int{userID}
+	if assigned, err := t.taskRepo.GetTasksByUserID(userID); err == nil {
+		for _, task1 := range assigned {
+			ids = append(ids, task1.AssignedBy)
+		}
+	} else {
+		log.Printf("Error getting tasks of deleted user %d: %v", userID, err)
 	}
+	users := t.userDirectory.Lookup(context.Background(), ids)
 
-	event := task.TaskEvent{
-		EventType:  eventType,
-		TaskID:     task1.Id,
-		TaskName:   task1.Name,
-		AssignedTo: task1.AssignedTo,
-		AssignedBy: userID,
-		Timestamp:  time.Now(),
+	tasks, err := t.taskRepo.ReassignTasksOfUser(userID, func(before *task.Task, reassigned *task.Task, watchers []int) task.TaskEvent {
+		return t.taskEvent(task.EventTaskUpdated, before, reassigned, reassigned.AssignedBy, watchers, users)
+	})
+	if err != nil {
+		log.Printf("Error reassigning tasks of deleted user %d: %v", userID, err)
+		return errors.New("Failed to Reassign Tasks")
+	}
+
+	log.Printf("Reassigned %d tasks of deleted user %d", len(tasks), userID)
+	return nil
+}
+
+// withUsers attaches the assigner and assignee of every task, resolving all of them in one lookup
+func (t *TaskService) withUsers(ctx context.Context, tasks []task.Task) []task.Task {
+	ids := make([]int, 0, 2*len(tasks))
+	for _, task1 := range tasks {
+		ids = append(ids, task1.AssignedBy, task1.AssignedTo)
 	}
+	return attachUsers(tasks, t.userDirectory.Lookup(ctx, ids))
+}
+
+// attachUsers attaches the assigner and assignee of every task found in users
+func attachUsers(tasks []task.Task, users map[int]user.UserInfo) []task.Task {
+	for i := range tasks {
+		if assignedBy, ok := users[tasks[i].AssignedBy]; ok {
+			tasks[i].AssignedByUser = &assignedBy
+		}
+		if assignedTo, ok := users[tasks[i].AssignedTo]; ok {
+			tasks[i].AssignedToUser = &assignedTo
+		}
+	}
+	return tasks
+}
+
+// WatchTask subscribes watcherID to notifications about the task. Users who can see the task may
+// watch it themselves, its assigner or an admin may add anyone else as a watcher
+func (t *TaskService) WatchTask(ctx context.Context, taskID int, userID int, watcherID int, admin bool) error {
+	if err := t.checkWatchChange(ctx, taskID, userID, watcherID, admin); err != nil {
+		return err
+	}
+	if err := t.taskRepo.AddWatcher(taskID, watcherID); err != nil {
+		log.Printf("Error adding watcher: %v", err)
+		return errors.New("Failed to Watch Task")
+	}
+	return nil
+}
+
+// UnwatchTask ends watcherID's subscription, anyone may stop watching and the assigner or an
+// admin may remove other watchers
+func (t *TaskService) UnwatchTask(ctx context.Context, taskID int, userID int, watcherID int, admin bool) error {
+	if watcherID != userID {
+		if err := t.checkWatchChange(ctx, taskID, userID, watcherID, admin); err != nil {
+			return err
+		}
+	}
+	if err := t.taskRepo.RemoveWatcher(taskID, watcherID); err != nil {
+		log.Printf("Error removing watcher: %v", err)
+		return errors.New("Failed to Unwatch Task")
+	}
+	return nil
+}
 
-	eventJSON, err := json.Marshal(event)
+// checkWatchChange allows userID to change watcherID's watch on the task
+func (t *TaskService) checkWatchChange(ctx context.Context, taskID int, userID int, watcherID int, admin bool) error {
+	if watcherID == userID {
+		return t.CheckTaskAccess(taskID, userID)
+	}
+
+	task1, err := t.taskRepo.GetTaskByID(taskID)
 	if err != nil {
-		log.Printf("Failed to marshal task Event: %v", err)
-		return
+		log.Printf("Error getting task by ID: %v", err)
+		return errors.New("Task Not Found")
+	}
+	if !admin && task1.AssignedBy != userID {
+		if task1.AssignedTo == userID {
+			return ErrNotTaskAssigner
+		}
+		return errors.New("Task Not Found")
 	}
 
-	// Use the notification service to publish the event
-	err = t.notificationService.PublishEvent(context.Background(), "task_events", eventJSON)
+	userExistsResp, err := t.grpcClient.ValidateUser(ctx, &pb.ValidateUserRequest{UserId: strconv.Itoa(watcherID)})
 	if err != nil {
-		log.Printf("Failed to publish task event: %v", err)
-	} else {
-		log.Printf("Published %s event for task %d", eventType, task1.Id)
+		log.Printf("Error validating user: %v", err)
+		return errors.New("Failed to Validate User")
+	}
+	if !userExistsResp.Status {
+		return errors.New("User Does Not Exist")
+	}
+	return nil
+}
+
+// CheckTaskAccess lets the assigner and the assignee of a task follow it live, anyone else is
+// told it doesn't exist. Watching a task doesn't grant access to it
+func (t *TaskService) CheckTaskAccess(taskID int, userID int) error {
+	task1, err := t.taskRepo.GetTaskByID(taskID)
+	if err != nil {
+		log.Printf("Error getting task by ID: %v", err)
+		return errors.New("Task Not Found")
 	}
+	if task1.AssignedBy == userID || task1.AssignedTo == userID {
+		return nil
+	}
+	return errors.New("Task Not Found")
+}
+
+// taskEvent describes a change made by userID, notification_service fans it out to the
+// assigner, the assignee and the watchers. before is nil for a created task and after for a
+// deleted one. Names come from users, which was looked up beforehand: the event is built inside
+// the transaction of the change. A user missing from it is shown by id.
+func (t *TaskService) taskEvent(eventType string, before *task.Task, after *task.Task, userID int, watchers []int, users map[int]user.UserInfo) task.TaskEvent {
+	current := after
+	if current == nil {
+		current = before
+	}
+
+	assignedBy := current.AssignedBy
+	if assignedBy == 0 {
+		assignedBy = userID
+	}
+	event := task.TaskEvent{
+		EventType:  eventType,
+		TaskID:     current.Id,
+		TaskName:   current.Name,
+		AssignedTo: current.AssignedTo,
+		AssignedBy: assignedBy,
+		Timestamp:  time.Now(),
+		ActorID:    userID,
+		Watchers:   watchers,
+	}
+
+	var snapshots []task.Task
+	if before != nil {
+		snapshots = append(snapshots, *before)
+	}
+	if after != nil {
+		snapshots = append(snapshots, *after)
+	}
+	snapshots = attachUsers(snapshots, users)
+	if before != nil {
+		event.Before = &snapshots[0]
+	}
+	if after != nil {
+		event.After = &snapshots[len(snapshots)-1]
+	}
+
+	event.AssignedToName = users[current.AssignedTo].DisplayName
+	event.AssignedByName = users[assignedBy].DisplayName
+	return event
 }
 
 func (t *TaskService) GetUserTasks(taskStatus task.TaskStatus) (int, task.TaskStatus, error) {
@@ -0,0 +1,152 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"task_service/src/internal/adaptors/persistance"
+	client "task_service/src/internal/adaptors/user_grpc_client"
+	"task_service/src/internal/core/task"
+	pb "task_service/src/internal/interfaces/input/grpc/generated/generated"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// fakeTaskStore keeps tasks and watchers in memory and records the events the use cases build
+type fakeTaskStore struct {
+	taskStore
+	tasks    map[int]task.Task
+	watchers map[int][]int
+	events   []task.TaskEvent
+}
+
+func (f *fakeTaskStore) GetTaskByID(taskID int) (task.Task, error) {
+	task1, ok := f.tasks[taskID]
+	if !ok {
+		return task.Task{}, errors.New("no rows")
+	}
+	return task1, nil
+}
+
+func (f *fakeTaskStore) UpdateOldTask(task1 task.Task, event persistance.TaskEventFunc) (task.Task, error) {
+	before, ok := f.tasks[task1.Id]
+	if !ok {
+		return task.Task{}, errors.New("no rows")
+	}
+	f.tasks[task1.Id] = task1
+	f.events = append(f.events, event(&before, &task1, slices.Clone(f.watchers[task1.Id])))
+	return task1, nil
+}
+
+func (f *fakeTaskStore) AddWatcher(taskID int, userID int) error {
+	if !slices.Contains(f.watchers[taskID], userID) {
+		f.watchers[taskID] = append(f.watchers[taskID], userID)
+	}
+	return nil
+}
+
+func (f *fakeTaskStore) RemoveWatcher(taskID int, userID int) error {
+	f.watchers[taskID] = slices.DeleteFunc(f.watchers[taskID], func(id int) bool { return id == userID })
+	return nil
+}
+
+// fakeUserService answers for the users in names, as user_service does over gRPC
+type fakeUserService struct {
+	pb.SessionValidatorClient
+	names map[int]string
+}
+
+func (f *fakeUserService) ValidateUser(_ context.Context, in *pb.ValidateUserRequest, _ ...grpc.CallOption) (*pb.ValidateUserResponse, error) {
+	id, _ := strconv.Atoi(in.GetUserId())
+	_, ok := f.names[id]
+	return &pb.ValidateUserResponse{Status: ok}, nil
+}
+
+func (f *fakeUserService) BatchGetUsers(_ context.Context, in *pb.BatchGetUsersRequest, _ ...grpc.CallOption) (*pb.BatchGetUsersResponse, error) {
+	resp := &pb.BatchGetUsersResponse{}
+	for _, userID := range in.GetUserIds() {
+		id, _ := strconv.Atoi(userID)
+		if name, ok := f.names[id]; ok {
+			resp.Users = append(resp.Users, &pb.UserInfo{UserId: userID, Username: name, DisplayName: name})
+		}
+	}
+	return resp, nil
+}
+
+// alice assigns the task to bob, carol only sees it by watching and dave is an admin
+const (
+	alice = 1
+	bob   = 2
+	carol = 3
+	dave  = 4
+)
+
+func newWatchTestService() (*TaskService, *fakeTaskStore) {
+	store := &fakeTaskStore{
+		tasks:    map[int]task.Task{10: {Id: 10, Name: "Plan sprint", AssignedBy: alice, AssignedTo: bob, TaskStatus: "pending"}},
+		watchers: map[int][]int{},
+	}
+	users := &fakeUserService{names: map[int]string{alice: "alice", bob: "bob", carol: "carol", dave: "dave"}}
+	service := NewTaskService(store, users, client.NewUserDirectory(users, time.Minute))
+	return &service, store
+}
+
+func TestAssignerAddsWatcherWhoIsNotified(t *testing.T) {
+	service, store := newWatchTestService()
+	ctx := context.Background()
+
+	if err := service.WatchTask(ctx, 10, alice, carol, false); err != nil {
+		t.Fatalf("the assigner adding a watcher: %v", err)
+	}
+
+	changed := store.tasks[10]
+	changed.TaskStatus = "in_progress"
+	if _, err := service.UpdateTask(ctx, changed, bob); err != nil {
+		t.Fatalf("UpdateTask: %v", err)
+	}
+
+	if len(store.events) != 1 {
+		t.Fatalf("got %d events, want 1", len(store.events))
+	}
+	event := store.events[0]
+	if event.EventType != task.EventTaskUpdated || !slices.Contains(event.Watchers, carol) {
+		t.Fatalf("event %s has watchers %v, want %d among them", event.EventType, event.Watchers, carol)
+	}
+	if event.AssignedTo == carol || event.AssignedBy == carol || event.ActorID == carol {
+		t.Fatalf("the watcher is notified as a participant, not as a watcher: %+v", event)
+	}
+}
+
+func TestOnlyAssignerOrAdminAddsOtherWatchers(t *testing.T) {
+	service, store := newWatchTestService()
+	ctx := context.Background()
+
+	if err := service.WatchTask(ctx, 10, bob, carol, false); !errors.Is(err, ErrNotTaskAssigner) {
+		t.Errorf("the assignee adding a watcher: got %v, want ErrNotTaskAssigner", err)
+	}
+	if err := service.WatchTask(ctx, 10, carol, carol, false); err == nil || err.Error() != "Task Not Found" {
+		t.Errorf("outsider watching: got %v, want Task Not Found", err)
+	}
+	if err := service.WatchTask(ctx, 10, alice, 99, false); err == nil || err.Error() != "User Does Not Exist" {
+		t.Errorf("adding an unknown user: got %v, want User Does Not Exist", err)
+	}
+	if len(store.watchers[10]) != 0 {
+		t.Fatalf("watchers %v were added", store.watchers[10])
+	}
+
+	if err := service.WatchTask(ctx, 10, dave, carol, true); err != nil {
+		t.Fatalf("an admin adding a watcher: %v", err)
+	}
+	if err := service.UnwatchTask(ctx, 10, bob, carol, false); !errors.Is(err, ErrNotTaskAssigner) {
+		t.Errorf("the assignee removing a watcher: got %v, want ErrNotTaskAssigner", err)
+	}
+	if err := service.UnwatchTask(ctx, 10, carol, carol, false); err != nil {
+		t.Fatalf("the watcher stopping: %v", err)
+	}
+	if len(store.watchers[10]) != 0 {
+		t.Fatalf("watchers %v are left", store.watchers[10])
+	}
+}
@@ -0,0 +1,9 @@
+-- users who follow a task without being its assigner or assignee, they are notified of its changes
+CREATE TABLE IF NOT EXISTS task_watchers(
+    task_id INT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    user_id INT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(task_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_watchers_user_id ON task_watchers(user_id);
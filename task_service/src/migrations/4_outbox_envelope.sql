@@ -0,0 +1,3 @@
+-- events are now stored as protobuf envelopes, rows already waiting keep their JSON payload
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS content_type TEXT NOT NULL DEFAULT 'application/json';
+ALTER TABLE outbox ALTER COLUMN payload TYPE BYTEA USING convert_to(payload::text, 'UTF8');
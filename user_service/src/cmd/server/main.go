@@ -1,24 +1,38 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"strings"
+	"time"
+	"user_service/src/internal/adaptors/oidc"
 	"user_service/src/internal/adaptors/persistance"
+	redisclient "user_service/src/internal/adaptors/redis"
+	"user_service/src/internal/adaptors/redis/events"
 	"user_service/src/internal/config"
 	pb "user_service/src/internal/interfaces/grpc/generated/generated"
 	grpcserver "user_service/src/internal/interfaces/grpc/server"
 	userhandler "user_service/src/internal/interfaces/input/api/rest/handler"
+	"user_service/src/internal/interfaces/input/api/rest/middleware"
 	"user_service/src/internal/interfaces/input/api/rest/routes"
 	user "user_service/src/internal/usecase"
+	"user_service/src/pkg/jwtkeys"
 	"user_service/src/pkg/migrate"
+	"user_service/src/pkg/utilities"
 
 	"google.golang.org/grpc"
 )
 
 func main() {
+	configP, err := config.LoadConfig()
+	if err != nil {
+		panic("Unable to use port")
+	}
+
 	database, err := persistance.NewDatabase()
 	if err != nil {
 		log.Fatalf("Failed to connect to Database: %v", err)
@@ -38,18 +52,54 @@ func main() {
 		log.Fatalf("failed to run migrations %v", err)
 	}
 
+	keySet, err := loadKeySet(configP)
+	if err != nil {
+		log.Fatalf("failed to load JWT signing keys: %v", err)
+	}
+
 	userRepo := persistance.NewUserRepo(database)
 	sessionRepo := persistance.NewSessionRepo(database)
-	userService := user.NewUserService(userRepo, sessionRepo)
+	securityEventRepo := persistance.NewSecurityEventRepo(database)
+	accessTokenRepo := persistance.NewAccessTokenRepo(database)
+	loginThrottleRepo := persistance.NewLoginThrottleRepo(database)
+
+	outboxInterval := time.Second
+	if configP.OUTBOX_POLL_INTERVAL != "" {
+		outboxInterval, err = time.ParseDuration(configP.OUTBOX_POLL_INTERVAL)
+		if err != nil || outboxInterval <= 0 {
+			log.Fatalf("invalid OUTBOX_POLL_INTERVAL: %q", configP.OUTBOX_POLL_INTERVAL)
+		}
+	}
+	go startOutboxRelay(context.Background(), persistance.NewOutboxRepo(database), outboxInterval)
+
+	userService := user.NewUserService(userRepo, sessionRepo, securityEventRepo, accessTokenRepo, loginThrottleRepo, keySet)
 	userHandler := userhandler.NewUserHandler(userService)
+	jwksHandler := userhandler.NewJWKSHandler(keySet)
 
-	router := routes.InitRoutes(&userHandler)
+	var oidcHandler *userhandler.OIDCHandler
+	if configP.OIDC_ISSUER_URL != "" {
+		identityRepo := persistance.NewIdentityRepo(database)
+		provider := oidc.NewProvider(oidc.ProviderConfig{
+			IssuerURL:    configP.OIDC_ISSUER_URL,
+			ClientID:     configP.OIDC_CLIENT_ID,
+			ClientSecret: configP.OIDC_CLIENT_SECRET,
+			RedirectURL:  configP.OIDC_REDIRECT_URL,
+			Scopes:       strings.Fields(configP.OIDC_SCOPES),
+		})
+		oidcLoginService := user.NewOIDCLoginService(&userService, identityRepo, provider)
+		handler := userhandler.NewOIDCHandler(oidcLoginService, configP.OIDC_POST_LOGIN_REDIRECT)
+		oidcHandler = &handler
+	} else {
+		log.Println("OIDC_ISSUER_URL not set, OpenID Connect login is disabled")
+	}
 
-	configP, err := config.LoadConfig()
+	trustedProxies, err := middleware.ParseTrustedProxies(configP.TRUSTED_PROXIES)
 	if err != nil {
-		panic("Unable to use port")
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
 	}
 
+	router := routes.InitRoutes(&userHandler, &jwksHandler, oidcHandler, keySet, &sessionRepo, trustedProxies)
+
 	// Start gRPC server in a goroutine
 	go func() {
 		lis, err := net.Listen("tcp", fmt.Sprintf(":%s", configP.GRPC_PORT))
@@ -58,7 +108,7 @@ func main() {
 		}
 
 		grpcServer := grpc.NewServer()
-		sessionValidatorServer := grpcserver.NewSessionValidatorServer(sessionRepo)
+		sessionValidatorServer := grpcserver.NewSessionValidatorServer(sessionRepo, accessTokenRepo, userRepo)
 		pb.RegisterSessionValidatorServer(grpcServer, sessionValidatorServer)
 
 		log.Printf("gRPC server listening at %v", lis.Addr())
@@ -74,3 +124,40 @@ func main() {
 		log.Fatalf("failed to start HTTP server: %v", err)
 	}
 }
+
+// startOutboxRelay waits for Redis, then relays the outbox to it. User events are stored in the
+// outbox meanwhile and reach the other services once Redis is reachable.
+func startOutboxRelay(ctx context.Context, outboxRepo persistance.OutboxRepo, interval time.Duration) {
+	redisClient, err := redisclient.NewRedisClient()
+	for err != nil {
+		log.Printf("Warning: Failed to connect to Redis: %v. User events are kept in the outbox, retrying in %s.", err, redisRetryInterval)
+		time.Sleep(redisRetryInterval)
+		redisClient, err = redisclient.NewRedisClient()
+	}
+	fmt.Println("Connected to Redis")
+
+	user.NewOutboxRelay(outboxRepo, events.NewEventPublisher(redisClient.GetClient()), interval).Run(ctx)
+}
+
+const redisRetryInterval = 30 * time.Second
+
+func loadKeySet(configP *config.Config) (*jwtkeys.KeySet, error) {
+	if configP.JWT_KEYSET_FILE == "" {
+		log.Println("Warning: JWT_KEYSET_FILE not set, signing with an ephemeral key. Do not use this outside local development.")
+		return jwtkeys.NewEphemeralKeySet()
+	}
+
+	keySet, err := jwtkeys.LoadKeySet(configP.JWT_KEYSET_FILE, utilities.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	if configP.JWT_KEYS_RELOAD_INTERVAL != "" {
+		interval, err := time.ParseDuration(configP.JWT_KEYS_RELOAD_INTERVAL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT_KEYS_RELOAD_INTERVAL: %w", err)
+		}
+		go keySet.ReloadEvery(interval)
+	}
+	return keySet, nil
+}
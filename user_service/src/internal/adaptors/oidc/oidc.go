@@ -0,0 +1,104 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"user_service/src/internal/core/identity"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+type ProviderConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Provider talks to an external OpenID Connect provider. Discovery happens on first use,
+// so user_service still starts when the provider is briefly unreachable.
+type Provider struct {
+	config ProviderConfig
+
+	mu           sync.Mutex
+	verifier     *gooidc.IDTokenVerifier
+	oauth2Config *oauth2.Config
+}
+
+func NewProvider(config ProviderConfig) *Provider {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{gooidc.ScopeOpenID, "email", "profile"}
+	}
+	return &Provider{config: config}
+}
+
+// Issuer identifies the provider in user_identities
+func (p *Provider) Issuer() string {
+	return p.config.IssuerURL
+}
+
+func (p *Provider) discover(ctx context.Context) (*oauth2.Config, *gooidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oauth2Config != nil {
+		return p.oauth2Config, p.verifier, nil
+	}
+
+	provider, err := gooidc.NewProvider(ctx, p.config.IssuerURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+	p.oauth2Config = &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       p.config.Scopes,
+	}
+	p.verifier = provider.Verifier(&gooidc.Config{ClientID: p.config.ClientID})
+	return p.oauth2Config, p.verifier, nil
+}
+
+// AuthCodeURL builds the authorization request with a S256 PKCE challenge for verifier
+func (p *Provider) AuthCodeURL(ctx context.Context, state string, nonce string, verifier string) (string, error) {
+	oauth2Config, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return oauth2Config.AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange redeems the authorization code and returns the claims of the verified ID token
+func (p *Provider) Exchange(ctx context.Context, code string, verifier string, nonce string) (identity.ProviderClaims, error) {
+	oauth2Config, idTokenVerifier, err := p.discover(ctx)
+	if err != nil {
+		return identity.ProviderClaims{}, err
+	}
+
+	token, err := oauth2Config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return identity.ProviderClaims{}, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return identity.ProviderClaims{}, errors.New("token response has no id_token")
+	}
+	idToken, err := idTokenVerifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return identity.ProviderClaims{}, fmt.Errorf("failed to verify id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return identity.ProviderClaims{}, errors.New("id_token nonce mismatch")
+	}
+
+	var claims identity.ProviderClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return identity.ProviderClaims{}, fmt.Errorf("failed to decode id_token claims: %w", err)
+	}
+	return claims, nil
+}
@@ -0,0 +1,79 @@
+package persistance
+
+import (
+	"fmt"
+	"user_service/src/internal/core/accesstoken"
+
+	"github.com/lib/pq"
+)
+
+type AccessTokenRepo struct {
+	db *Database
+}
+
+func NewAccessTokenRepo(d *Database) AccessTokenRepo {
+	return AccessTokenRepo{db: d}
+}
+
+const accessTokenColumns = "id, user_id, name, token_hash, scopes, expires_at, created_at, last_used_at, revoked_at"
+
+func (a *AccessTokenRepo) CreateToken(token accesstoken.AccessToken) (accesstoken.AccessToken, error) {
+	query := "insert into personal_access_tokens(id, user_id, name, token_hash, scopes, expires_at) values($1, $2, $3, $4, $5, $6) returning created_at"
+	err := a.db.db.QueryRow(query, token.Id, token.Uid, token.Name, token.TokenHash, pq.Array(token.Scopes), token.ExpiresAt).Scan(&token.CreatedAt)
+	if err != nil {
+		return accesstoken.AccessToken{}, err
+	}
+	return token, nil
+}
+
+func (a *AccessTokenRepo) GetToken(id string) (accesstoken.AccessToken, error) {
+	var token accesstoken.AccessToken
+	query := "select " + accessTokenColumns + " from personal_access_tokens where id=$1"
+	err := a.db.db.QueryRow(query, id).Scan(&token.Id, &token.Uid, &token.Name, &token.TokenHash, pq.Array(&token.Scopes), &token.ExpiresAt, &token.CreatedAt, &token.LastUsedAt, &token.RevokedAt)
+	if err != nil {
+		return accesstoken.AccessToken{}, err
+	}
+	return token, nil
+}
+
+// GetTokensByUid returns the tokens of the user that are not revoked, expired ones included so they can be cleaned up
+func (a *AccessTokenRepo) GetTokensByUid(uid int) ([]accesstoken.AccessToken, error) {
+	var tokens []accesstoken.AccessToken
+	query := "select " + accessTokenColumns + " from personal_access_tokens where user_id=$1 and revoked_at is null order by created_at desc"
+	rows, err := a.db.db.Query(query, uid)
+	if err != nil {
+		return tokens, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var token accesstoken.AccessToken
+		err = rows.Scan(&token.Id, &token.Uid, &token.Name, &token.TokenHash, pq.Array(&token.Scopes), &token.ExpiresAt, &token.CreatedAt, &token.LastUsedAt, &token.RevokedAt)
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (a *AccessTokenRepo) RevokeToken(uid int, id string) error {
+	query := "update personal_access_tokens set revoked_at=current_timestamp where id=$1 and user_id=$2 and revoked_at is null"
+	result, err := a.db.db.Exec(query, id, uid)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("token not found")
+	}
+	return nil
+}
+
+func (a *AccessTokenRepo) TouchToken(id string) error {
+	query := "update personal_access_tokens set last_used_at=current_timestamp where id=$1"
+	_, err := a.db.db.Exec(query, id)
+	return err
+}
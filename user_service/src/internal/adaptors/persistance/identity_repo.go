@@ -0,0 +1,54 @@
+package persistance
+
+import (
+	"time"
+	"user_service/src/internal/core/identity"
+)
+
+type IdentityRepo struct {
+	db *Database
+}
+
+func NewIdentityRepo(d *Database) IdentityRepo {
+	return IdentityRepo{db: d}
+}
+
+func (i *IdentityRepo) GetIdentity(provider string, subject string) (identity.Identity, error) {
+	var found identity.Identity
+	query := "select id, user_id, provider, subject, email, created_at from user_identities where provider=$1 and subject=$2"
+	err := i.db.db.QueryRow(query, provider, subject).Scan(&found.Id, &found.Uid, &found.Provider, &found.Subject, &found.Email, &found.CreatedAt)
+	if err != nil {
+		return identity.Identity{}, err
+	}
+	return found, nil
+}
+
+func (i *IdentityRepo) CreateIdentity(newIdentity identity.Identity) error {
+	query := "insert into user_identities(user_id, provider, subject, email) values($1, $2, $3, $4)"
+	_, err := i.db.db.Exec(query, newIdentity.Uid, newIdentity.Provider, newIdentity.Subject, newIdentity.Email)
+	return err
+}
+
+func (i *IdentityRepo) CreateLoginState(state identity.LoginState) error {
+	query := "insert into oidc_login_states(state, code_verifier, nonce) values($1, $2, $3)"
+	_, err := i.db.db.Exec(query, state.State, state.CodeVerifier, state.Nonce)
+	return err
+}
+
+// ConsumeLoginState deletes and returns the state so a callback can only be used once
+func (i *IdentityRepo) ConsumeLoginState(state string) (identity.LoginState, error) {
+	var found identity.LoginState
+	query := "delete from oidc_login_states where state=$1 returning state, code_verifier, nonce, created_at"
+	err := i.db.db.QueryRow(query, state).Scan(&found.State, &found.CodeVerifier, &found.Nonce, &found.CreatedAt)
+	if err != nil {
+		return identity.LoginState{}, err
+	}
+	return found, nil
+}
+
+// DeleteExpiredLoginStates drops logins that were started but never came back
+func (i *IdentityRepo) DeleteExpiredLoginStates(before time.Time) error {
+	query := "delete from oidc_login_states where created_at < $1"
+	_, err := i.db.db.Exec(query, before)
+	return err
+}
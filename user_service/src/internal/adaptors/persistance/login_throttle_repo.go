@@ -0,0 +1,59 @@
+package persistance
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+	"user_service/src/internal/core/security"
+)
+
+type LoginThrottleRepo struct {
+	db *Database
+}
+
+func NewLoginThrottleRepo(d *Database) LoginThrottleRepo {
+	return LoginThrottleRepo{db: d}
+}
+
+// GetThrottle returns an empty throttle for a key without failures
+func (l *LoginThrottleRepo) GetThrottle(key string) (security.LoginThrottle, error) {
+	throttle := security.LoginThrottle{Key: key}
+	query := "select failures, last_failure_at, locked_until from login_throttles where key=$1"
+	err := l.db.db.QueryRow(query, key).Scan(&throttle.Failures, &throttle.LastFailureAt, &throttle.LockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return throttle, nil
+	}
+	if err != nil {
+		return security.LoginThrottle{}, err
+	}
+	return throttle, nil
+}
+
+// RecordFailure counts a failed login, failures older than window are forgotten first
+func (l *LoginThrottleRepo) RecordFailure(key string, window time.Duration) (security.LoginThrottle, error) {
+	throttle := security.LoginThrottle{Key: key}
+	now := time.Now()
+	query := `insert into login_throttles(key, failures, last_failure_at) values($1, 1, $2)
+			  on conflict(key) do update set
+			  failures = case when login_throttles.last_failure_at < $3 then 1 else login_throttles.failures + 1 end,
+			  last_failure_at = EXCLUDED.last_failure_at
+			  returning failures, last_failure_at, locked_until`
+	err := l.db.db.QueryRow(query, key, now, now.Add(-window)).Scan(&throttle.Failures, &throttle.LastFailureAt, &throttle.LockedUntil)
+	if err != nil {
+		return security.LoginThrottle{}, err
+	}
+	return throttle, nil
+}
+
+func (l *LoginThrottleRepo) Lock(key string, until time.Time) error {
+	query := "update login_throttles set locked_until=$1 where key=$2"
+	_, err := l.db.db.Exec(query, until, key)
+	return err
+}
+
+// ResetThrottle clears the failures and any lock of the key
+func (l *LoginThrottleRepo) ResetThrottle(key string) error {
+	query := "delete from login_throttles where key=$1"
+	_, err := l.db.db.Exec(query, key)
+	return err
+}
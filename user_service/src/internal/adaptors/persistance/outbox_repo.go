@@ -0,0 +1,93 @@
+package persistance
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+	"user_service/src/internal/core/outbox"
+	"user_service/src/internal/core/security"
+)
+
+type OutboxRepo struct {
+	db *Database
+}
+
+func NewOutboxRepo(d *Database) OutboxRepo {
+	return OutboxRepo{db: d}
+}
+
+// enqueueUserEvent writes the event to the outbox, it is only published if tx commits
+func enqueueUserEvent(tx *sql.Tx, event security.SecurityEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode user event: %v", err)
+	}
+	query := "insert into outbox(topic, payload) values($1, $2)"
+	if _, err := tx.Exec(query, security.UserEventsStream, payload); err != nil {
+		return fmt.Errorf("failed to write outbox: %v", err)
+	}
+	return nil
+}
+
+// RelayPending locks up to limit messages that are due, skipping those another relay holds, and
+// hands them to publish in order. Published messages are marked sent, a failed one is rescheduled
+// after retryAfter(attempts) and ends the batch, the rest would most likely fail the same way.
+func (o *OutboxRepo) RelayPending(limit int, publish func(outbox.Message) error, retryAfter func(attempts int) time.Duration) (int, error) {
+	tx, err := o.db.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `select id, topic, payload, attempts, created_at from outbox
+			  where sent_at is null and next_attempt_at <= current_timestamp
+			  order by id limit $1 for update skip locked`
+	rows, err := tx.Query(query, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read outbox: %v", err)
+	}
+	var messages []outbox.Message
+	for rows.Next() {
+		var m outbox.Message
+		if err := rows.Scan(&m.Id, &m.Topic, &m.Payload, &m.Attempts, &m.CreatedAt); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan outbox: %v", err)
+		}
+		messages = append(messages, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating over outbox: %v", err)
+	}
+
+	sent := 0
+	for _, m := range messages {
+		if publishErr := publish(m); publishErr != nil {
+			query := "update outbox set attempts = attempts + 1, last_error = $2, next_attempt_at = $3 where id = $1"
+			if _, err := tx.Exec(query, m.Id, publishErr.Error(), time.Now().Add(retryAfter(m.Attempts+1))); err != nil {
+				return 0, fmt.Errorf("failed to reschedule outbox message: %v", err)
+			}
+			break
+		}
+		query := "update outbox set attempts = attempts + 1, last_error = null, sent_at = current_timestamp where id = $1"
+		if _, err := tx.Exec(query, m.Id); err != nil {
+			return 0, fmt.Errorf("failed to mark outbox message sent: %v", err)
+		}
+		sent++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return sent, nil
+}
+
+// DeleteSent removes messages published before the given time
+func (o *OutboxRepo) DeleteSent(before time.Time) (int64, error) {
+	result, err := o.db.db.Exec("delete from outbox where sent_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clean up outbox: %v", err)
+	}
+	return result.RowsAffected()
+}
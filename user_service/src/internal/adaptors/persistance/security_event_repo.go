@@ -0,0 +1,32 @@
+package persistance
+
+import (
+	"user_service/src/internal/core/security"
+)
+
+type SecurityEventRepo struct {
+	db *Database
+}
+
+func NewSecurityEventRepo(d *Database) SecurityEventRepo {
+	return SecurityEventRepo{db: d}
+}
+
+// CreateEvent stores the event and queues it in the outbox in one transaction, so every stored
+// event reaches the user_events stream
+func (s *SecurityEventRepo) CreateEvent(event security.SecurityEvent) error {
+	tx, err := s.db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "insert into security_events(event_type, user_id, session_family, ip_address, user_agent, detail) values($1, $2, $3, $4, $5, $6)"
+	if _, err := tx.Exec(query, event.EventType, event.UserID, event.SessionFamily, event.IpAddress, event.UserAgent, event.Detail); err != nil {
+		return err
+	}
+	if err := enqueueUserEvent(tx, event); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
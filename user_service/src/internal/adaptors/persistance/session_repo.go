@@ -1,10 +1,17 @@
 package persistance
 
 import (
+	"errors"
 	"fmt"
+	"time"
 	session "user_service/src/internal/core/session"
 )
 
+// ErrSessionRotated is returned when a session is rotated a second time
+var ErrSessionRotated = errors.New("session already rotated")
+
+const sessionColumns = "id, user_id, token_hash, expires_at, issued_at, user_agent, ip_address, last_seen_at, family_id, rotated_at, replaced_by, public_id"
+
 type SessionRepo struct {
 	db *Database
 }
@@ -14,7 +21,8 @@ func NewSessionRepo(d *Database) SessionRepo {
 }
 
 func (u *SessionRepo) CreateSession(session session.Session) error {
-	_, err := u.db.db.Exec("INSERT INTO sessions (id, user_id, token_hash, expires_at, issued_at) VALUES($1, $2, $3, $4, $5) ON CONFLICT(user_id) DO UPDATE SET id= EXCLUDED.id, token_hash=EXCLUDED.token_hash, expires_at=EXCLUDED.expires_at, issued_at=EXCLUDED.issued_at", session.Id, session.Uid, session.TokenHash, session.ExpiresAt, session.IssuedAt)
+	query := "INSERT INTO sessions (id, user_id, token_hash, expires_at, issued_at, user_agent, ip_address, last_seen_at, family_id, public_id) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)"
+	_, err := u.db.db.Exec(query, session.Id, session.Uid, session.TokenHash, session.ExpiresAt, session.IssuedAt, session.UserAgent, session.IpAddress, session.IssuedAt, session.FamilyId, session.PublicId)
 	if err != nil {
 		return err
 	}
@@ -24,36 +32,145 @@ func (u *SessionRepo) CreateSession(session session.Session) error {
 
 func (u *SessionRepo) GetSession(id string) (session.Session, error) {
 	var newSess session.Session
-	query := "select id, user_id, token_hash, expires_at, issued_at from sessions where id=$1"
-	err := u.db.db.QueryRow(query, id).Scan(&newSess.Id, &newSess.Uid, &newSess.TokenHash, &newSess.ExpiresAt, &newSess.IssuedAt)
+	query := "select " + sessionColumns + " from sessions where id=$1"
+	err := u.db.db.QueryRow(query, id).Scan(&newSess.Id, &newSess.Uid, &newSess.TokenHash, &newSess.ExpiresAt, &newSess.IssuedAt, &newSess.UserAgent, &newSess.IpAddress, &newSess.LastSeenAt, &newSess.FamilyId, &newSess.RotatedAt, &newSess.ReplacedBy, &newSess.PublicId)
 	if err != nil {
 		return session.Session{}, err
 	}
 	return newSess, nil
 }
 
-func (u *SessionRepo) GetSessionByUid(uid string) (session.Session, error) {
-	var newSess session.Session
-	query := "select id, user_id, token_hash, expires_at, issued_at from sessions where user_id = $1"
-	err := u.db.db.QueryRow(query, uid).Scan(&newSess.Id, &newSess.Uid, &newSess.TokenHash, &newSess.ExpiresAt, &newSess.IssuedAt)
+// GetSessionsByUid returns the live (unexpired, not rotated) sessions of the user, most recently used first
+func (u *SessionRepo) GetSessionsByUid(uid int) ([]session.Session, error) {
+	var sessions []session.Session
+	query := "select " + sessionColumns + " from sessions where user_id = $1 and rotated_at is null and expires_at > current_timestamp order by last_seen_at desc"
+	rows, err := u.db.db.Query(query, uid)
 	if err != nil {
-		return session.Session{}, err
+		return sessions, err
 	}
-	return newSess, nil
+	defer rows.Close()
+	for rows.Next() {
+		var newSess session.Session
+		err = rows.Scan(&newSess.Id, &newSess.Uid, &newSess.TokenHash, &newSess.ExpiresAt, &newSess.IssuedAt, &newSess.UserAgent, &newSess.IpAddress, &newSess.LastSeenAt, &newSess.FamilyId, &newSess.RotatedAt, &newSess.ReplacedBy, &newSess.PublicId)
+		if err != nil {
+			return sessions, err
+		}
+		sessions = append(sessions, newSess)
+	}
+	return sessions, rows.Err()
+}
+
+// RotateSession marks the old session as replaced and stores its successor in one transaction.
+// Only one rotation of a session can succeed, a concurrent second one gets ErrSessionRotated.
+func (u *SessionRepo) RotateSession(oldID string, newSess session.Session) error {
+	tx, err := u.db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "update sessions set rotated_at=$1, replaced_by=$2 where id=$3 and rotated_at is null"
+	result, err := tx.Exec(query, time.Now(), newSess.Id, oldID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrSessionRotated
+	}
+
+	query = "INSERT INTO sessions (id, user_id, token_hash, expires_at, issued_at, user_agent, ip_address, last_seen_at, family_id, public_id) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)"
+	_, err = tx.Exec(query, newSess.Id, newSess.Uid, newSess.TokenHash, newSess.ExpiresAt, newSess.IssuedAt, newSess.UserAgent, newSess.IpAddress, newSess.IssuedAt, newSess.FamilyId, newSess.PublicId)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteSessionFamily removes a session chain, current and rotated tokens alike
+func (u *SessionRepo) DeleteSessionFamily(familyID string) error {
+	query := "delete from sessions where family_id=$1"
+	_, err := u.db.db.Exec(query, familyID)
+	return err
+}
+
+// FamilyActive reports whether the session family still has a live, unexpired session
+func (u *SessionRepo) FamilyActive(familyID string) (bool, error) {
+	var count int
+	query := "select count(*) from sessions where family_id=$1 and rotated_at is null and expires_at > current_timestamp"
+	err := u.db.db.QueryRow(query, familyID).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
 }
 
+// TouchSession records that the session has just been used
+func (u *SessionRepo) TouchSession(id string) error {
+	query := "update sessions set last_seen_at = current_timestamp where id = $1"
+	_, err := u.db.db.Exec(query, id)
+	return err
+}
+
+// DeleteSession removes every session of the user
 func (u *SessionRepo) DeleteSession(uid int) error {
 	query := "delete from sessions where user_id=$1"
-	_, err := u.db.db.Query(query, uid)
+	_, err := u.db.db.Exec(query, uid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteOtherSessions removes every session of the user except the family keepFamilyID
+func (u *SessionRepo) DeleteOtherSessions(uid int, keepFamilyID string) error {
+	query := "delete from sessions where user_id=$1 and family_id <> $2"
+	_, err := u.db.db.Exec(query, uid, keepFamilyID)
+	return err
+}
+
+// DeleteSessionByID removes a session together with the rotated tokens of its family, only if it belongs to the user
+func (u *SessionRepo) DeleteSessionByID(uid int, id string) error {
+	query := "delete from sessions where user_id=$2 and family_id = (select family_id from sessions where id=$1 and user_id=$2)"
+	result, err := u.db.db.Exec(query, id, uid)
 	if err != nil {
 		return err
 	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("session not found")
+	}
+	return nil
+}
+
+// DeleteSessionByPublicID removes the session the user knows by its public id, together with the rotated
+// tokens of its family
+func (u *SessionRepo) DeleteSessionByPublicID(uid int, publicID string) error {
+	query := "delete from sessions where user_id=$2 and family_id in (select family_id from sessions where public_id=$1 and user_id=$2)"
+	result, err := u.db.db.Exec(query, publicID, uid)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("session not found")
+	}
 	return nil
 }
 
-func (u *SessionRepo) UserExists(userID int) (bool, error) {
+// UserActive reports whether the user exists and is neither deleted nor deactivated
+func (u *SessionRepo) UserActive(userID int) (bool, error) {
 	var count int
-	query := "SELECT COUNT(*) FROM users WHERE uid = $1"
+	query := "SELECT COUNT(*) FROM users WHERE uid = $1 AND deleted_at IS NULL AND deactivated_at IS NULL"
 	err := u.db.db.QueryRow(query, userID).Scan(&count)
 	if err != nil {
 		return false, err
@@ -1,11 +1,16 @@
 package persistance
 
 import (
+	"user_service/src/internal/core/security"
 	user "user_service/src/internal/core/user"
 	"user_service/src/pkg/utilities"
 
 	// "TaskManager/pkg/utilities"
+	"database/sql"
 	"fmt"
+	"time"
+
+	"github.com/lib/pq"
 	// "github.com/ydb-platform/ydb-go-sdk/v3/query"
 )
 
@@ -40,18 +45,38 @@ func (u *UserRepo) CreateUser(newUser user.UserRegister) (user.UserResponse, err
 
 func (u *UserRepo) GetUser(username string) (user.User, error) {
 	var newUser user.User
-	query := "select uid, username, email, created_at, password from users where username = $1"
-	err := u.db.db.QueryRow(query, username).Scan(&newUser.Uid, &newUser.Username, &newUser.Email, &newUser.CreatedAt, &newUser.Password)
+	query := "select uid, username, email, created_at, password, role, deactivated_at, password_reset_required from users where username = $1 and deleted_at is null"
+	err := u.db.db.QueryRow(query, username).Scan(&newUser.Uid, &newUser.Username, &newUser.Email, &newUser.CreatedAt, &newUser.Password, &newUser.Role, &newUser.DeactivatedAt, &newUser.PasswordResetRequired)
 	if err != nil {
 		return user.User{}, err
 	}
 	return newUser, nil
 }
 
+func (u *UserRepo) GetUserByEmail(email string) (user.User, error) {
+	var newUser user.User
+	query := "select uid, username, email, created_at, password, role, deactivated_at, password_reset_required from users where lower(email) = lower($1) and deleted_at is null"
+	err := u.db.db.QueryRow(query, email).Scan(&newUser.Uid, &newUser.Username, &newUser.Email, &newUser.CreatedAt, &newUser.Password, &newUser.Role, &newUser.DeactivatedAt, &newUser.PasswordResetRequired)
+	if err != nil {
+		return user.User{}, err
+	}
+	return newUser, nil
+}
+
+func (u *UserRepo) UsernameExists(username string) (bool, error) {
+	var count int
+	query := "select count(*) from users where username = $1 and deleted_at is null"
+	err := u.db.db.QueryRow(query, username).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
 func (u *UserRepo) GetUserByID(id int) (user.UserProfile, error) {
 	var newUser user.UserProfile
-	query := "select uid, username, email,created_at from users where uid = $1"
-	err := u.db.db.QueryRow(query, id).Scan(&newUser.Uid, &newUser.Username, &newUser.Email, &newUser.CreatedAt)
+	query := "select uid, username, email, display_name, created_at, role from users where uid = $1 and deleted_at is null"
+	err := u.db.db.QueryRow(query, id).Scan(&newUser.Uid, &newUser.Username, &newUser.Email, &newUser.DisplayName, &newUser.CreatedAt, &newUser.Role)
 	if err != nil {
 		return user.UserProfile{}, err
 	}
@@ -60,7 +85,7 @@ func (u *UserRepo) GetUserByID(id int) (user.UserProfile, error) {
 
 func (u *UserRepo) GetUsers() ([]user.GetUserResponse, error) {
 	var allUsers []user.GetUserResponse
-	query := `select uid, username from users`
+	query := `select uid, username from users where deleted_at is null`
 	rows, err := u.db.db.Query(query)
 	if err != nil {
 		return allUsers, err
@@ -76,3 +101,199 @@ func (u *UserRepo) GetUsers() ([]user.GetUserResponse, error) {
 	}
 	return allUsers, nil
 }
+
+// UpdateProfile sets the non-empty fields of the update and returns the resulting profile
+func (u *UserRepo) UpdateProfile(id int, update user.UpdateProfile) (user.UserProfile, error) {
+	var updatedUser user.UserProfile
+	query := `update users set username = coalesce(nullif($2, ''), username), email = coalesce(nullif($3, ''), email),
+		display_name = coalesce(nullif($4, ''), display_name)
+		where uid = $1 and deleted_at is null returning uid, username, email, display_name, created_at, role`
+	err := u.db.db.QueryRow(query, id, update.Username, update.Email, update.DisplayName).Scan(&updatedUser.Uid, &updatedUser.Username, &updatedUser.Email, &updatedUser.DisplayName, &updatedUser.CreatedAt, &updatedUser.Role)
+	if err != nil {
+		return user.UserProfile{}, err
+	}
+	return updatedUser, nil
+}
+
+// UpdatePassword also clears a pending admin password reset
+func (u *UserRepo) UpdatePassword(id int, password string) error {
+	hashPass, err := utilities.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	query := `update users set password = $2, password_reset_required = false, password_reset_token = null, password_reset_expires_at = null
+		where uid = $1 and deleted_at is null`
+	return u.execOnUser(query, id, hashPass)
+}
+
+// ListUsers returns one page of accounts ordered by uid, and the total number of matches
+func (u *UserRepo) ListUsers(listQuery user.UserListQuery) ([]user.AdminUser, int, error) {
+	allUsers := []user.AdminUser{}
+	total := 0
+	query := `select uid, username, email, display_name, created_at, role, deactivated_at, password_reset_required, count(*) over()
+		from users
+		where deleted_at is null and ($1 = '' or username ilike '%' || $1 || '%' or email ilike '%' || $1 || '%')
+		order by uid
+		limit $2 offset $3`
+	rows, err := u.db.db.Query(query, listQuery.Search, listQuery.Limit, listQuery.Offset)
+	if err != nil {
+		return allUsers, total, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currentUser user.AdminUser
+		err = rows.Scan(&currentUser.Uid, &currentUser.Username, &currentUser.Email, &currentUser.DisplayName, &currentUser.CreatedAt, &currentUser.Role, &currentUser.DeactivatedAt, &currentUser.PasswordResetRequired, &total)
+		if err != nil {
+			return allUsers, total, err
+		}
+		allUsers = append(allUsers, currentUser)
+	}
+	return allUsers, total, rows.Err()
+}
+
+// GetUsersByIDs returns the users among ids that exist and are not deleted, in no particular order
+func (u *UserRepo) GetUsersByIDs(ids []int) ([]user.AdminUser, error) {
+	foundUsers := []user.AdminUser{}
+	query := `select uid, username, email, display_name, created_at, role, deactivated_at, password_reset_required
+		from users where uid = any($1) and deleted_at is null`
+	rows, err := u.db.db.Query(query, pq.Array(ids))
+	if err != nil {
+		return foundUsers, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var currentUser user.AdminUser
+		err = rows.Scan(&currentUser.Uid, &currentUser.Username, &currentUser.Email, &currentUser.DisplayName, &currentUser.CreatedAt, &currentUser.Role, &currentUser.DeactivatedAt, &currentUser.PasswordResetRequired)
+		if err != nil {
+			return foundUsers, err
+		}
+		foundUsers = append(foundUsers, currentUser)
+	}
+	return foundUsers, rows.Err()
+}
+
+// SetDeactivated blocks or unblocks an account
+func (u *UserRepo) SetDeactivated(id int, deactivated bool) error {
+	query := "update users set deactivated_at = case when $2 then coalesce(deactivated_at, current_timestamp) end where uid = $1 and deleted_at is null"
+	return u.execOnUser(query, id, deactivated)
+}
+
+// RequirePasswordReset flags the account for a reset that tokenHash completes until expiresAt,
+// replacing any earlier reset token. In the same transaction the sessions are removed and the
+// personal access tokens revoked, so nothing issued under the old password keeps working.
+func (u *UserRepo) RequirePasswordReset(id int, tokenHash string, expiresAt time.Time) error {
+	tx, err := u.db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `update users set password_reset_required = true, password_reset_token = $2, password_reset_expires_at = $3
+		where uid = $1 and deleted_at is null`
+	result, err := tx.Exec(query, id, tokenHash, expiresAt)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	for _, query := range []string{
+		"delete from sessions where user_id = $1",
+		"update personal_access_tokens set revoked_at = current_timestamp where user_id = $1 and revoked_at is null",
+	} {
+		if _, err := tx.Exec(query, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetPasswordReset returns the hash and expiry of the pending reset token, an empty hash when there is none
+func (u *UserRepo) GetPasswordReset(id int) (string, time.Time, error) {
+	var tokenHash sql.NullString
+	var expiresAt sql.NullTime
+	query := "select password_reset_token, password_reset_expires_at from users where uid = $1 and deleted_at is null"
+	if err := u.db.db.QueryRow(query, id).Scan(&tokenHash, &expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenHash.String, expiresAt.Time, nil
+}
+
+// CompletePasswordReset sets the new password if tokenHash is still the pending reset token, so a
+// token completes one reset only. It reports sql.ErrNoRows when the token was used meanwhile.
+func (u *UserRepo) CompletePasswordReset(id int, tokenHash string, password string) error {
+	hashPass, err := utilities.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	query := `update users set password = $3, password_reset_required = false, password_reset_token = null, password_reset_expires_at = null
+		where uid = $1 and password_reset_token = $2 and deleted_at is null`
+	return u.execOnUser(query, id, tokenHash, hashPass)
+}
+
+// execOnUser runs an update on one user and reports sql.ErrNoRows when there is no such user
+func (u *UserRepo) execOnUser(query string, id int, args ...interface{}) error {
+	result, err := u.db.db.Exec(query, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AnonymizeUser deletes an account in one transaction: the users row keeps its uid but loses
+// its personal data and password, and everything that could still sign in or identify the user
+// (sessions, access tokens, linked identities, security events) is removed. The deleted event
+// is queued in the outbox in the same transaction, so other services always hear of it.
+func (u *UserRepo) AnonymizeUser(id int, unusablePassword string, deleted security.SecurityEvent) error {
+	hashPass, err := utilities.HashPassword(unusablePassword)
+	if err != nil {
+		return err
+	}
+
+	tx, err := u.db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `update users set username = $2, email = $3, password = $4, display_name = '', deleted_at = current_timestamp
+		where uid = $1 and deleted_at is null`
+	result, err := tx.Exec(query, id, fmt.Sprintf("%s%d", user.DeletedUsernamePrefix, id), fmt.Sprintf("%s%d@deleted.invalid", user.DeletedUsernamePrefix, id), hashPass)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	for _, query := range []string{
+		"delete from sessions where user_id = $1",
+		"delete from personal_access_tokens where user_id = $1",
+		"delete from user_identities where user_id = $1",
+		"delete from security_events where user_id = $1",
+	} {
+		if _, err := tx.Exec(query, id); err != nil {
+			return err
+		}
+	}
+	if err := enqueueUserEvent(tx, deleted); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,31 @@
+package events
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// streamMaxLen caps an event stream, older entries are trimmed once consumers had time to read them
+const streamMaxLen = 100000
+
+type EventPublisher struct {
+	redisClient *redis.Client
+}
+
+func NewEventPublisher(redisClient *redis.Client) *EventPublisher {
+	return &EventPublisher{
+		redisClient: redisClient,
+	}
+}
+
+// AppendEvent adds an event to a Redis stream, it is kept until every consumer group acknowledged
+// it or the stream is trimmed, so consumers that are down pick it up when they come back
+func (e *EventPublisher) AppendEvent(ctx context.Context, stream string, eventJSON []byte) error {
+	return e.redisClient.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: streamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"payload": eventJSON},
+	}).Err()
+}
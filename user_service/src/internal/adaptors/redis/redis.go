@@ -0,0 +1,43 @@
+package redisclient
+
+import (
+	"context"
+	"fmt"
+	"user_service/src/internal/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type RedisClient struct {
+	client *redis.Client
+}
+
+func NewRedisClient() (*RedisClient, error) {
+	config, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%s", config.REDIS_HOST, config.REDIS_PORT),
+		Password: config.REDIS_PASSWORD,
+		DB:       0,
+	})
+
+	// Test connection
+	ctx := context.Background()
+	_, err = rdb.Ping(ctx).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %v", err)
+	}
+
+	return &RedisClient{client: rdb}, nil
+}
+
+func (r *RedisClient) GetClient() *redis.Client {
+	return r.client
+}
+
+func (r *RedisClient) Close() error {
+	return r.client.Close()
+}
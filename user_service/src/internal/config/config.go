@@ -18,6 +18,28 @@ type Config struct {
 	APP_ENV    string `mapstructure:"APP_ENV"`
 	APP_PORT   string `mapstructure:"APP_PORT"`
 	GRPC_PORT  string `mapstructure:"GRPC_PORT"`
+	// Redis carries user events to task_service and notification_service, while it is down
+	// they wait in the outbox
+	REDIS_HOST     string `mapstructure:"REDIS_HOST"`
+	REDIS_PORT     string `mapstructure:"REDIS_PORT"`
+	REDIS_PASSWORD string `mapstructure:"REDIS_PASSWORD"`
+	// how often the outbox is relayed to Redis, e.g. "1s"
+	OUTBOX_POLL_INTERVAL string `mapstructure:"OUTBOX_POLL_INTERVAL"`
+	// comma separated IPs and CIDRs of the proxies allowed to set X-Forwarded-For, e.g. "10.0.0.0/8"
+	TRUSTED_PROXIES string `mapstructure:"TRUSTED_PROXIES"`
+	// JSON manifest of the JWT signing keys, see jwtkeys.LoadKeySet
+	JWT_KEYSET_FILE string `mapstructure:"JWT_KEYSET_FILE"`
+	// how often the manifest is re-read to pick up new keys, e.g. "10m"
+	JWT_KEYS_RELOAD_INTERVAL string `mapstructure:"JWT_KEYS_RELOAD_INTERVAL"`
+	// OpenID Connect login, disabled when OIDC_ISSUER_URL is empty
+	OIDC_ISSUER_URL    string `mapstructure:"OIDC_ISSUER_URL"`
+	OIDC_CLIENT_ID     string `mapstructure:"OIDC_CLIENT_ID"`
+	OIDC_CLIENT_SECRET string `mapstructure:"OIDC_CLIENT_SECRET"`
+	OIDC_REDIRECT_URL  string `mapstructure:"OIDC_REDIRECT_URL"`
+	// space separated, defaults to "openid email profile"
+	OIDC_SCOPES string `mapstructure:"OIDC_SCOPES"`
+	// where the browser is sent after a successful OIDC login, JSON response when empty
+	OIDC_POST_LOGIN_REDIRECT string `mapstructure:"OIDC_POST_LOGIN_REDIRECT"`
 }
 
 func LoadConfig() (*Config, error) {
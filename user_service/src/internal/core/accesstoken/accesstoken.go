@@ -0,0 +1,39 @@
+package accesstoken
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ScopeTasksRead  = "tasks:read"
+	ScopeTasksWrite = "tasks:write"
+)
+
+// ValidScopes lists every scope a personal access token can be granted
+var ValidScopes = []string{ScopeTasksRead, ScopeTasksWrite}
+
+type AccessToken struct {
+	Id         uuid.UUID  `json:"id"`
+	Uid        int        `json:"uid"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type CreateAccessToken struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// CreatedAccessToken is returned once on creation, the plain token cannot be retrieved later
+type CreatedAccessToken struct {
+	AccessToken
+	Token string `json:"token"`
+}
@@ -0,0 +1,30 @@
+package identity
+
+import "time"
+
+// Identity links an account at an external OpenID Connect provider to a local user
+type Identity struct {
+	Id        int       `json:"id"`
+	Uid       int       `json:"uid"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoginState is what the callback needs to finish a login the provider redirected back
+type LoginState struct {
+	State        string    `json:"state"`
+	CodeVerifier string    `json:"code_verifier"`
+	Nonce        string    `json:"nonce"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ProviderClaims are the verified ID token claims used to find or create the local user
+type ProviderClaims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+}
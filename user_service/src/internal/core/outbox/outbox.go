@@ -0,0 +1,12 @@
+package outbox
+
+import "time"
+
+// Message is an event stored with the change it describes, waiting to be appended to the Topic stream
+type Message struct {
+	Id        int64
+	Topic     string
+	Payload   []byte
+	Attempts  int
+	CreatedAt time.Time
+}
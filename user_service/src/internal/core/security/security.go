@@ -0,0 +1,41 @@
+package security
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// EventRefreshTokenReuse is raised when a session token that was already rotated is presented again
+	EventRefreshTokenReuse = "refresh_token_reuse"
+	// EventAccountLocked is raised when repeated failed logins lock an account
+	EventAccountLocked = "account_locked"
+	// EventPasswordChanged is raised when the user changes their password
+	EventPasswordChanged = "password_changed"
+	// EventUserDeleted is raised when an account is deleted, so other services can drop or reassign its data
+	EventUserDeleted = "user_deleted"
+)
+
+// UserEventsStream is the Redis stream user events are appended to, task_service and
+// notification_service read it through their own consumer groups
+const UserEventsStream = "user_events"
+
+type SecurityEvent struct {
+	Id            int        `json:"id"`
+	EventType     string     `json:"event_type"`
+	UserID        int        `json:"user_id"`
+	SessionFamily *uuid.UUID `json:"session_family,omitempty"`
+	IpAddress     string     `json:"ip_address"`
+	UserAgent     string     `json:"user_agent"`
+	Detail        string     `json:"detail"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// LoginThrottle counts recent failed logins for a "user:<username>" or "ip:<address>" key
+type LoginThrottle struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
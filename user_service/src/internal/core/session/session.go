@@ -7,9 +7,29 @@ import (
 )
 
 type Session struct {
-	Id        uuid.UUID `json:"id"`
-	Uid       int       `json:"uid"`
-	TokenHash string    `json:"tokenthash"`
-	ExpiresAt time.Time `json:"expiresat"`
-	IssuedAt  time.Time `json:"issuedat"`
+	Id         uuid.UUID  `json:"id"`
+	Uid        int        `json:"uid"`
+	TokenHash  string     `json:"tokenthash"`
+	ExpiresAt  time.Time  `json:"expiresat"`
+	IssuedAt   time.Time  `json:"issuedat"`
+	UserAgent  string     `json:"user_agent"`
+	IpAddress  string     `json:"ip_address"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	FamilyId   uuid.UUID  `json:"family_id"`
+	RotatedAt  *time.Time `json:"rotated_at,omitempty"`
+	ReplacedBy *uuid.UUID `json:"replaced_by,omitempty"`
+	// PublicId names the session to its owner, Id is the refresh credential and never leaves the cookie
+	PublicId uuid.UUID `json:"public_id"`
+}
+
+// SessionInfo is the device view of a session returned to the user, identified by its public id
+// instead of the refresh credential
+type SessionInfo struct {
+	Id         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IpAddress  string    `json:"ip_address"`
+	IssuedAt   time.Time `json:"issued_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
 }
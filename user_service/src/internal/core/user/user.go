@@ -3,19 +3,60 @@ package user
 
 import "time"
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// DeletedUsernamePrefix starts the placeholder username of a deleted account, no one can sign up
+// or rename themselves to a username with it
+const DeletedUsernamePrefix = "deleted-user-"
+
 type UserProfile struct {
-	Uid      int    `json:"uid"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	Uid         int    `json:"uid"`
+	Username    string `json:"username"`
+	Email       string `json:"email"`
+	DisplayName string `json:"display_name"`
 	// Password  string    `json:"password"`
+	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 }
 type User struct {
-	Uid       int       `json:"uid"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  string    `json:"password"`
-	CreatedAt time.Time `json:"created_at"`
+	Uid                   int        `json:"uid"`
+	Username              string     `json:"username"`
+	Email                 string     `json:"email"`
+	Password              string     `json:"password"`
+	Role                  string     `json:"role"`
+	CreatedAt             time.Time  `json:"created_at"`
+	DeactivatedAt         *time.Time `json:"deactivated_at,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+}
+
+// AdminUser is the view of an account in the admin user list
+type AdminUser struct {
+	Uid                   int        `json:"uid"`
+	Username              string     `json:"username"`
+	Email                 string     `json:"email"`
+	DisplayName           string     `json:"display_name"`
+	Role                  string     `json:"role"`
+	CreatedAt             time.Time  `json:"created_at"`
+	DeactivatedAt         *time.Time `json:"deactivated_at,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+}
+
+// UserListQuery filters the admin user list, Search matches username or email
+type UserListQuery struct {
+	Search string
+	Limit  int
+	Offset int
+}
+
+// ResetPassword sets a new password for an account an admin flagged for reset, with the
+// reset token the admin handed over
+type ResetPassword struct {
+	Username    string `json:"username"`
+	ResetToken  string `json:"reset_token"`
+	NewPassword string `json:"new_password"`
 }
 
 type UserRegister struct {
@@ -23,6 +64,19 @@ type UserRegister struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
+
+// UpdateProfile changes the username, email and/or display name, empty fields are left as they are
+type UpdateProfile struct {
+	Username    string `json:"username"`
+	Email       string `json:"email"`
+	DisplayName string `json:"display_name"`
+}
+
+type ChangePassword struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
 type UserLogin struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
@@ -2,21 +2,34 @@ package grpc
 
 import (
 	"context"
+	"log"
 	"strconv"
 	"time"
 	"user_service/src/internal/adaptors/persistance"
+	"user_service/src/internal/core/user"
 	pb "user_service/src/internal/interfaces/grpc/generated/generated"
+	"user_service/src/pkg/utilities"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// maxBatchGetUsers bounds the ids of one BatchGetUsers call
+const maxBatchGetUsers = 500
+
 type SessionValidatorServer struct {
 	pb.UnimplementedSessionValidatorServer
-	sessionRepo persistance.SessionRepo
+	sessionRepo     persistance.SessionRepo
+	accessTokenRepo persistance.AccessTokenRepo
+	userRepo        persistance.UserRepo
 }
 
 // NewSessionValidatorServer creates a new SessionValidatorServer instance
-func NewSessionValidatorServer(sessionRepo persistance.SessionRepo) *SessionValidatorServer {
+func NewSessionValidatorServer(sessionRepo persistance.SessionRepo, accessTokenRepo persistance.AccessTokenRepo, userRepo persistance.UserRepo) *SessionValidatorServer {
 	return &SessionValidatorServer{
-		sessionRepo: sessionRepo,
+		sessionRepo:     sessionRepo,
+		accessTokenRepo: accessTokenRepo,
+		userRepo:        userRepo,
 	}
 }
 
@@ -40,6 +53,14 @@ func (s *SessionValidatorServer) ValidateSession(ctx context.Context, req *pb.Va
 		}, nil
 	}
 
+	// A rotated session has been replaced by a newer token of its family
+	if session.RotatedAt != nil {
+		return &pb.ValidateSessionResponse{
+			Valid: false,
+			Error: "session rotated",
+		}, nil
+	}
+
 	// Check if session is expired
 	if time.Now().After(session.ExpiresAt) {
 		return &pb.ValidateSessionResponse{
@@ -48,11 +69,32 @@ func (s *SessionValidatorServer) ValidateSession(ctx context.Context, req *pb.Va
 		}, nil
 	}
 
+	if active, err := s.sessionRepo.UserActive(session.Uid); err != nil || !active {
+		return &pb.ValidateSessionResponse{
+			Valid: false,
+			Error: "user deactivated",
+		}, nil
+	}
+
+	// the role lets callers authorize without a second lookup, like the "roles" claim of the JWT
+	sessionUser, err := s.userRepo.GetUserByID(session.Uid)
+	if err != nil {
+		return &pb.ValidateSessionResponse{
+			Valid: false,
+			Error: "user not found",
+		}, nil
+	}
+
+	if err := s.sessionRepo.TouchSession(sessionID); err != nil {
+		log.Printf("Failed to update session last seen: %v", err)
+	}
+
 	// Session is valid, return user ID
 	return &pb.ValidateSessionResponse{
 		Valid:  true,
 		UserId: strconv.Itoa(session.Uid),
 		Error:  "",
+		Roles:  []string{sessionUser.Role},
 	}, nil
 }
 
@@ -74,8 +116,8 @@ func (s *SessionValidatorServer) ValidateUser(ctx context.Context, req *pb.Valid
 		}, nil
 	}
 
-	// Check if user exists in database
-	exists, err := s.sessionRepo.UserExists(userID)
+	// Deleted and deactivated users cannot be assigned anything
+	exists, err := s.sessionRepo.UserActive(userID)
 	if err != nil {
 		return &pb.ValidateUserResponse{
 			Status: false,
@@ -86,3 +128,153 @@ func (s *SessionValidatorServer) ValidateUser(ctx context.Context, req *pb.Valid
 		Status: exists,
 	}, nil
 }
+
+// IsSessionActive lets services that verify access tokens locally check that the session
+// family in the token's "sid" claim has not been logged out or revoked
+func (s *SessionValidatorServer) IsSessionActive(ctx context.Context, req *pb.IsSessionActiveRequest) (*pb.IsSessionActiveResponse, error) {
+	sessionFamily := req.GetSessionFamily()
+	if sessionFamily == "" {
+		return &pb.IsSessionActiveResponse{
+			Active: false,
+		}, nil
+	}
+
+	active, err := s.sessionRepo.FamilyActive(sessionFamily)
+	if err != nil {
+		return &pb.IsSessionActiveResponse{
+			Active: false,
+		}, nil
+	}
+
+	return &pb.IsSessionActiveResponse{
+		Active: active,
+	}, nil
+}
+
+func (s *SessionValidatorServer) ValidateAccessToken(ctx context.Context, req *pb.ValidateAccessTokenRequest) (*pb.ValidateAccessTokenResponse, error) {
+	tokenID, secret, err := utilities.ParseAccessToken(req.GetToken())
+	if err != nil {
+		return &pb.ValidateAccessTokenResponse{
+			Valid: false,
+			Error: "malformed access token",
+		}, nil
+	}
+
+	token, err := s.accessTokenRepo.GetToken(tokenID)
+	if err != nil {
+		return &pb.ValidateAccessTokenResponse{
+			Valid: false,
+			Error: "access token not found",
+		}, nil
+	}
+
+	if err := utilities.CheckAccessTokenSecret(token.TokenHash, secret); err != nil {
+		return &pb.ValidateAccessTokenResponse{
+			Valid: false,
+			Error: "access token mismatch",
+		}, nil
+	}
+
+	if token.RevokedAt != nil {
+		return &pb.ValidateAccessTokenResponse{
+			Valid: false,
+			Error: "access token revoked",
+		}, nil
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return &pb.ValidateAccessTokenResponse{
+			Valid: false,
+			Error: "access token expired",
+		}, nil
+	}
+
+	if active, err := s.sessionRepo.UserActive(token.Uid); err != nil || !active {
+		return &pb.ValidateAccessTokenResponse{
+			Valid: false,
+			Error: "user deactivated",
+		}, nil
+	}
+
+	if err := s.accessTokenRepo.TouchToken(tokenID); err != nil {
+		log.Printf("Failed to update access token last used: %v", err)
+	}
+
+	return &pb.ValidateAccessTokenResponse{
+		Valid:  true,
+		UserId: strconv.Itoa(token.Uid),
+		Scopes: token.Scopes,
+	}, nil
+}
+
+func (s *SessionValidatorServer) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserResponse, error) {
+	userID, err := strconv.Atoi(req.GetUserId())
+	if err != nil {
+		return &pb.GetUserResponse{
+			Found: false,
+		}, nil
+	}
+
+	foundUsers, err := s.userRepo.GetUsersByIDs([]int{userID})
+	if err != nil {
+		log.Printf("Failed to look up user %d: %v", userID, err)
+		return nil, status.Error(codes.Internal, "failed to look up user")
+	}
+	if len(foundUsers) == 0 {
+		return &pb.GetUserResponse{
+			Found: false,
+		}, nil
+	}
+
+	return &pb.GetUserResponse{
+		Found: true,
+		User:  toUserInfo(foundUsers[0]),
+	}, nil
+}
+
+// BatchGetUsers resolves many ids in one query, so callers can show names for a whole list
+func (s *SessionValidatorServer) BatchGetUsers(ctx context.Context, req *pb.BatchGetUsersRequest) (*pb.BatchGetUsersResponse, error) {
+	if len(req.GetUserIds()) > maxBatchGetUsers {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d user ids per call", maxBatchGetUsers)
+	}
+
+	userIDs := make([]int, 0, len(req.GetUserIds()))
+	for _, id := range req.GetUserIds() {
+		// ids that are not numbers cannot exist, they are left out like unknown ones
+		if userID, err := strconv.Atoi(id); err == nil {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	if len(userIDs) == 0 {
+		return &pb.BatchGetUsersResponse{}, nil
+	}
+
+	foundUsers, err := s.userRepo.GetUsersByIDs(userIDs)
+	if err != nil {
+		log.Printf("Failed to look up users: %v", err)
+		return nil, status.Error(codes.Internal, "failed to look up users")
+	}
+
+	users := make([]*pb.UserInfo, 0, len(foundUsers))
+	for _, foundUser := range foundUsers {
+		users = append(users, toUserInfo(foundUser))
+	}
+	return &pb.BatchGetUsersResponse{
+		Users: users,
+	}, nil
+}
+
+func toUserInfo(foundUser user.AdminUser) *pb.UserInfo {
+	displayName := foundUser.DisplayName
+	if displayName == "" {
+		displayName = foundUser.Username
+	}
+	return &pb.UserInfo{
+		UserId:      strconv.Itoa(foundUser.Uid),
+		Username:    foundUser.Username,
+		Email:       foundUser.Email,
+		DisplayName: displayName,
+		Active:      foundUser.DeactivatedAt == nil,
+		Roles:       []string{foundUser.Role},
+	}
+}
@@ -0,0 +1,127 @@
+package userhandler
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"user_service/src/internal/core/user"
+	userservice "user_service/src/internal/usecase"
+	errorhandling "user_service/src/pkg/error_handling"
+	pkgresponse "user_service/src/pkg/response"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ResetPassword is the unauthenticated endpoint a user flagged by an admin uses to choose a new password
+func (u *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var request user.ResetPassword
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		errorhandling.HandleError(w, "Wrong Format Data", http.StatusBadRequest)
+		return
+	}
+
+	err := u.userService.ResetPassword(request, r.UserAgent(), clientIP(r))
+	var lockedErr *userservice.LoginLockedError
+	if errors.As(err, &lockedErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+		errorhandling.HandleError(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, userservice.ErrAccountDeactivated) {
+		errorhandling.HandleError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		errorhandling.HandleError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Password Reset Successfully, Please Log In",
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+func (u *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	listQuery := user.UserListQuery{Search: query.Get("search")}
+	var err error
+	if limit := query.Get("limit"); limit != "" {
+		if listQuery.Limit, err = strconv.Atoi(limit); err != nil {
+			errorhandling.HandleError(w, "Invalid Limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if offset := query.Get("offset"); offset != "" {
+		if listQuery.Offset, err = strconv.Atoi(offset); err != nil {
+			errorhandling.HandleError(w, "Invalid Offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	userList, err := u.userService.ListUsers(listQuery)
+	if err != nil {
+		errorhandling.HandleError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Users Retrieved Successfully",
+		Data:    userList,
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+func (u *UserHandler) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	u.adminUserAction(w, r, u.userService.DeactivateUser, "User Deactivated Successfully", nil)
+}
+
+func (u *UserHandler) ReactivateUser(w http.ResponseWriter, r *http.Request) {
+	u.adminUserAction(w, r, u.userService.ReactivateUser, "User Reactivated Successfully", nil)
+}
+
+// ForcePasswordReset answers with the reset token, the admin passes it on to the user
+func (u *UserHandler) ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	var reset userservice.PasswordReset
+	u.adminUserAction(w, r, func(adminID int, id int) error {
+		var err error
+		reset, err = u.userService.ForcePasswordReset(adminID, id)
+		return err
+	}, "Password Reset Required on Next Login", &reset)
+}
+
+func (u *UserHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	u.adminUserAction(w, r, u.userService.RevokeUserSessions, "User Sessions Revoked Successfully", nil)
+}
+
+// adminUserAction runs an admin action on the user in the {id} URL parameter, data is sent back
+// when the action succeeded
+func (u *UserHandler) adminUserAction(w http.ResponseWriter, r *http.Request, action func(adminID int, id int) error, successMessage string, data interface{}) {
+	adminId, ok := r.Context().Value("user").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	userId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		errorhandling.HandleError(w, "Invalid User ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := action(adminId, userId); err != nil {
+		errorhandling.HandleError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: successMessage,
+		Data:    data,
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
@@ -0,0 +1,28 @@
+package userhandler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+	"user_service/src/pkg/jwtkeys"
+)
+
+type JWKSHandler struct {
+	keySet *jwtkeys.KeySet
+}
+
+func NewJWKSHandler(keySet *jwtkeys.KeySet) JWKSHandler {
+	return JWKSHandler{
+		keySet: keySet,
+	}
+}
+
+// GetJWKS publishes the public signing keys as a plain JWK Set (RFC 7517), not wrapped
+// in StandardResponse, so any JOSE library can consume it
+func (j *JWKSHandler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	// short cache so verifiers notice new keys soon after they are added
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(j.keySet.JWKS(time.Now()))
+}
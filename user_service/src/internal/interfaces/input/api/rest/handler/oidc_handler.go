@@ -0,0 +1,91 @@
+package userhandler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	userservice "user_service/src/internal/usecase"
+	errorhandling "user_service/src/pkg/error_handling"
+	pkgresponse "user_service/src/pkg/response"
+)
+
+// oidcStateCookie ties a started login to the browser that started it
+const oidcStateCookie = "oidc_state"
+
+type OIDCHandler struct {
+	oidcLoginService  userservice.OIDCLoginService
+	postLoginRedirect string
+}
+
+// postLoginRedirect is where the browser lands after a successful login, when empty the callback answers with JSON
+func NewOIDCHandler(usecase userservice.OIDCLoginService, postLoginRedirect string) OIDCHandler {
+	return OIDCHandler{
+		oidcLoginService:  usecase,
+		postLoginRedirect: postLoginRedirect,
+	}
+}
+
+func (o *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	authURL, state, err := o.oidcLoginService.StartLogin(r.Context())
+	if err != nil {
+		errorhandling.HandleError(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	// Lax so the cookie comes along on the top-level redirect back from the provider
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Expires:  time.Now().Add(userservice.OIDCLoginStateTTL),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/auth/oidc",
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (o *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	browserState := ""
+	if cookie, err := r.Cookie(oidcStateCookie); err == nil {
+		browserState = cookie.Value
+	}
+	// the state is single use either way
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    "",
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/auth/oidc",
+	})
+	if providerErr := query.Get("error"); providerErr != "" {
+		errorhandling.HandleError(w, "Login Refused by Provider: "+providerErr, http.StatusUnauthorized)
+		return
+	}
+
+	loginResponse, err := o.oidcLoginService.FinishLogin(r.Context(), query.Get("state"), browserState, query.Get("code"), r.UserAgent(), clientIP(r))
+	if err != nil {
+		errorhandling.HandleError(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	setLoginCookies(w, loginResponse)
+	if o.postLoginRedirect != "" {
+		http.Redirect(w, r, o.postLoginRedirect, http.StatusFound)
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Successful Login",
+		Data: map[string]interface{}{
+			"username": loginResponse.FounUser.Username,
+			"user_id":  loginResponse.FounUser.Uid,
+		},
+	}
+	w.Header().Set("x-user", loginResponse.FounUser.Username)
+	w.Header().Set("x-userId", strconv.Itoa(loginResponse.FounUser.Uid))
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
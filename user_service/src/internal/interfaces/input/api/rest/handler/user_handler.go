@@ -2,13 +2,19 @@ package userhandler
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
+	"net"
 	"net/http"
 	"strconv"
 	"time"
+	"user_service/src/internal/core/accesstoken"
 	"user_service/src/internal/core/user"
 	userservice "user_service/src/internal/usecase"
 	errorhandling "user_service/src/pkg/error_handling"
 	pkgresponse "user_service/src/pkg/response"
+
+	"github.com/go-chi/chi/v5"
 )
 
 type UserHandler struct {
@@ -30,6 +36,10 @@ func (u *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	createdUser, err := u.userService.RegisterUser(newUser)
+	if errors.Is(err, userservice.ErrUsernameReserved) {
+		errorhandling.HandleError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		errorhandling.HandleError(w, "Unable to Register User", http.StatusInternalServerError)
 		return
@@ -50,32 +60,23 @@ func (u *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	loginResponse, err := u.userService.LoginUser(loginUser)
+	loginResponse, err := u.userService.LoginUser(loginUser, r.UserAgent(), clientIP(r))
+	var lockedErr *userservice.LoginLockedError
+	if errors.As(err, &lockedErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+		errorhandling.HandleError(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if errors.Is(err, userservice.ErrAccountDeactivated) || errors.Is(err, userservice.ErrPasswordResetRequired) {
+		errorhandling.HandleError(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		errorhandling.HandleError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	atCookie := http.Cookie{
-		Name:     "at",
-		Value:    loginResponse.TokenString,
-		Expires:  loginResponse.TokenExpire,
-		Secure:   true,
-		SameSite: http.SameSiteNoneMode,
-		Path:     "/",
-	}
-
-	sessCookie := http.Cookie{
-		Name:     "sess",
-		Value:    loginResponse.Session.Id.String(),
-		Expires:  loginResponse.Session.ExpiresAt,
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteNoneMode,
-		Path:     "/",
-	}
-	http.SetCookie(w, &atCookie)
-	http.SetCookie(w, &sessCookie)
+	setLoginCookies(w, loginResponse)
 
 	response := pkgresponse.StandardResponse{
 		Status:  "SUCCESS",
@@ -113,53 +114,105 @@ func (u *UserHandler) Profile(w http.ResponseWriter, r *http.Request) {
 	pkgresponse.WriteResponse(w, http.StatusOK, response)
 }
 
-func (u *UserHandler) Refresh(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("sess")
-	if err != nil {
-		errorhandling.HandleError(w, "Session Cookie Not Found", http.StatusUnauthorized)
+func (u *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
 		return
 	}
 
-	tokenString, expireTime, err := u.userService.GetJwtFromSession(cookie.Value)
+	var update user.UpdateProfile
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		errorhandling.HandleError(w, "Wrong Format Data", http.StatusBadRequest)
+		return
+	}
+
+	updatedUser, err := u.userService.UpdateProfile(userId, update)
 	if err != nil {
-		errorhandling.HandleError(w, err.Error(), http.StatusInternalServerError)
+		errorhandling.HandleError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	atCookie := http.Cookie{
-		Name:     "at",
-		Value:    tokenString,
-		Expires:  expireTime,
-		Secure:   true,
-		SameSite: http.SameSiteNoneMode,
-		Path:     "/",
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Profile Updated Successfully",
+		Data:    updatedUser,
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+func (u *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	var request user.ChangePassword
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		errorhandling.HandleError(w, "Wrong Format Data", http.StatusBadRequest)
+		return
+	}
+
+	var currentSession string
+	if cookie, err := r.Cookie("sess"); err == nil {
+		currentSession = cookie.Value
+	}
+
+	err := u.userService.ChangePassword(userId, currentSession, request, r.UserAgent(), clientIP(r))
+	if err != nil {
+		errorhandling.HandleError(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	http.SetCookie(w, &atCookie)
 
 	response := pkgresponse.StandardResponse{
 		Status:  "SUCCESS",
-		Message: "Token Refreshed Successfully",
+		Message: "Password Changed Successfully, Other Sessions Were Signed Out",
 	}
 	pkgresponse.WriteResponse(w, http.StatusOK, response)
 }
 
-func (u *UserHandler) LogOut(w http.ResponseWriter, r *http.Request) {
+func (u *UserHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
 	userId, ok := r.Context().Value("user").(int)
 	if !ok {
 		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
 		return
 	}
 
-	err := u.userService.LogoutUser(userId)
+	err := u.userService.DeleteAccount(userId)
 	if err != nil {
 		errorhandling.HandleError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	clearAuthCookies(w)
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Account Deleted Successfully",
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+func (u *UserHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("sess")
+	if err != nil {
+		errorhandling.HandleError(w, "Session Cookie Not Found", http.StatusUnauthorized)
+		return
+	}
+
+	refreshResponse, err := u.userService.RefreshSession(cookie.Value, r.UserAgent(), clientIP(r))
+	if err != nil {
+		// a refused refresh leaves the browser with a dead session, so drop its cookies
+		clearAuthCookies(w)
+		errorhandling.HandleError(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
 	atCookie := http.Cookie{
 		Name:     "at",
-		Value:    "",
-		Expires:  time.Now(),
+		Value:    refreshResponse.TokenString,
+		Expires:  refreshResponse.TokenExpire,
 		Secure:   true,
 		SameSite: http.SameSiteNoneMode,
 		Path:     "/",
@@ -168,8 +221,8 @@ func (u *UserHandler) LogOut(w http.ResponseWriter, r *http.Request) {
 
 	sessCookie := http.Cookie{
 		Name:     "sess",
-		Value:    "",
-		Expires:  time.Now(),
+		Value:    refreshResponse.Session.Id.String(),
+		Expires:  refreshResponse.Session.ExpiresAt,
 		HttpOnly: true,
 		Secure:   true,
 		SameSite: http.SameSiteNoneMode,
@@ -177,6 +230,41 @@ func (u *UserHandler) LogOut(w http.ResponseWriter, r *http.Request) {
 	}
 	http.SetCookie(w, &sessCookie)
 
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Token Refreshed Successfully",
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+func (u *UserHandler) LogOut(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	// ?all=true logs the user out of every device, otherwise only the current session ends
+	everywhere, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+
+	var sessionID string
+	if !everywhere {
+		cookie, err := r.Cookie("sess")
+		if err != nil {
+			errorhandling.HandleError(w, "Session Cookie Not Found", http.StatusUnauthorized)
+			return
+		}
+		sessionID = cookie.Value
+	}
+
+	err := u.userService.LogoutUser(userId, sessionID, everywhere)
+	if err != nil {
+		errorhandling.HandleError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	clearAuthCookies(w)
+
 	response := pkgresponse.StandardResponse{
 		Status:  "SUCCESS",
 		Message: "Successful Logout",
@@ -184,6 +272,65 @@ func (u *UserHandler) LogOut(w http.ResponseWriter, r *http.Request) {
 	pkgresponse.WriteResponse(w, http.StatusOK, response)
 }
 
+func (u *UserHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	var currentSession string
+	if cookie, err := r.Cookie("sess"); err == nil {
+		currentSession = cookie.Value
+	}
+
+	sessions, err := u.userService.ListSessions(userId, currentSession)
+	if err != nil {
+		errorhandling.HandleError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Sessions Retrieved Successfully",
+		Data: map[string]interface{}{
+			"sessions": sessions,
+			"count":    len(sessions),
+		},
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+func (u *UserHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	var currentSession string
+	if cookie, err := r.Cookie("sess"); err == nil {
+		currentSession = cookie.Value
+	}
+
+	current, err := u.userService.RevokeSession(userId, chi.URLParam(r, "id"), currentSession)
+	if err != nil {
+		errorhandling.HandleError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// Revoking the session this request came from is the same as logging out
+	if current {
+		clearAuthCookies(w)
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Session Revoked Successfully",
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
 func (u *UserHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 	allUsers, err := u.userService.GetAllUsers()
 	if err != nil {
@@ -197,3 +344,150 @@ func (u *UserHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 	}
 	pkgresponse.WriteResponse(w, http.StatusOK, response)
 }
+
+func (u *UserHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	var request accesstoken.CreateAccessToken
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		errorhandling.HandleError(w, "Wrong Format Data", http.StatusBadRequest)
+		return
+	}
+
+	createdToken, err := u.userService.CreateAccessToken(userId, request)
+	if err != nil {
+		errorhandling.HandleError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Token Created Successfully, it will not be shown again",
+		Data:    createdToken,
+	}
+	pkgresponse.WriteResponse(w, http.StatusCreated, response)
+}
+
+func (u *UserHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := u.userService.ListAccessTokens(userId)
+	if err != nil {
+		errorhandling.HandleError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Tokens Retrieved Successfully",
+		Data: map[string]interface{}{
+			"tokens": tokens,
+			"count":  len(tokens),
+		},
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+func (u *UserHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("user").(int)
+	if !ok {
+		errorhandling.HandleError(w, "User Not Found in Context", http.StatusUnauthorized)
+		return
+	}
+
+	err := u.userService.RevokeAccessToken(userId, chi.URLParam(r, "id"))
+	if err != nil {
+		errorhandling.HandleError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "Token Revoked Successfully",
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+func (u *UserHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		errorhandling.HandleError(w, "Invalid User ID", http.StatusBadRequest)
+		return
+	}
+
+	err = u.userService.UnlockUser(userId)
+	if err != nil {
+		errorhandling.HandleError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	response := pkgresponse.StandardResponse{
+		Status:  "SUCCESS",
+		Message: "User Unlocked Successfully",
+	}
+	pkgresponse.WriteResponse(w, http.StatusOK, response)
+}
+
+func setLoginCookies(w http.ResponseWriter, loginResponse userservice.LoginResponse) {
+	atCookie := http.Cookie{
+		Name:     "at",
+		Value:    loginResponse.TokenString,
+		Expires:  loginResponse.TokenExpire,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+		Path:     "/",
+	}
+
+	sessCookie := http.Cookie{
+		Name:     "sess",
+		Value:    loginResponse.Session.Id.String(),
+		Expires:  loginResponse.Session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+		Path:     "/",
+	}
+	http.SetCookie(w, &atCookie)
+	http.SetCookie(w, &sessCookie)
+}
+
+func clearAuthCookies(w http.ResponseWriter) {
+	atCookie := http.Cookie{
+		Name:     "at",
+		Value:    "",
+		Expires:  time.Now(),
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+		Path:     "/",
+	}
+	http.SetCookie(w, &atCookie)
+
+	sessCookie := http.Cookie{
+		Name:     "sess",
+		Value:    "",
+		Expires:  time.Now(),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+		Path:     "/",
+	}
+	http.SetCookie(w, &sessCookie)
+}
+
+// clientIP strips the port from RemoteAddr, which RealIP has already replaced with the forwarded
+// address when the request came through a trusted proxy
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -3,28 +3,66 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"slices"
 	errorhandling "user_service/src/pkg/error_handling"
+	"user_service/src/pkg/jwtkeys"
 	"user_service/src/pkg/utilities"
 )
 
-func Authenticate(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("at")
+// SessionChecker tells whether what a token was issued for is still valid, persistance.SessionRepo implements it
+type SessionChecker interface {
+	FamilyActive(familyID string) (bool, error)
+	UserActive(userID int) (bool, error)
+}
+
+// Authenticate verifies the at token and, like ValidateSession, refuses it once its session was
+// ended or its user deactivated or deleted, so a token does not outlive the account for its TTL
+func Authenticate(keySet *jwtkeys.KeySet, sessions SessionChecker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie("at")
+
+			if err != nil {
+				errorhandling.HandleError(w, "Missing Authorization Token", http.StatusUnauthorized)
+				return
+			}
 
-		if err != nil {
-			errorhandling.HandleError(w, "Missing Authorization Token", http.StatusUnauthorized)
-			return
-		}
+			claims, err := utilities.ValidateJWT(keySet, cookie.Value)
+			if err != nil {
+				errorhandling.HandleError(w, "Invalid Authorization Token", http.StatusUnauthorized)
+				return
+			}
 
-		claims, err := utilities.ValidateJWT(cookie.Value)
-		if err != nil {
-			errorhandling.HandleError(w, "Invalid Authorization Token", http.StatusUnauthorized)
-			return
-		}
+			if active, err := sessions.UserActive(claims.Uid); err != nil || !active {
+				errorhandling.HandleError(w, "Account Not Active", http.StatusUnauthorized)
+				return
+			}
+			if claims.Sid != "" {
+				if active, err := sessions.FamilyActive(claims.Sid); err != nil || !active {
+					errorhandling.HandleError(w, "Session Ended", http.StatusUnauthorized)
+					return
+				}
+			}
 
-		ctx := context.WithValue(r.Context(), "user", claims.Uid)
-		r = r.WithContext(ctx)
+			ctx := context.WithValue(r.Context(), "user", claims.Uid)
+			ctx = context.WithValue(ctx, "roles", claims.Roles)
+			r = r.WithContext(ctx)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-		next.ServeHTTP(w, r)
-	})
+// RequireRole must run after Authenticate, it rejects callers whose token lacks the role
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			roles, _ := r.Context().Value("roles").([]string)
+			if !slices.Contains(roles, role) {
+				errorhandling.HandleError(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
 }
@@ -1,8 +1,10 @@
 package routes
 
 import (
+	"user_service/src/internal/core/user"
 	userhandler "user_service/src/internal/interfaces/input/api/rest/handler"
 	"user_service/src/internal/interfaces/input/api/rest/middleware"
+	"user_service/src/pkg/jwtkeys"
 
 	"net/http"
 
@@ -10,20 +12,54 @@ import (
 )
 
 func InitRoutes(
-	userHandler *userhandler.UserHandler) http.Handler {
+	userHandler *userhandler.UserHandler,
+	jwksHandler *userhandler.JWKSHandler,
+	oidcHandler *userhandler.OIDCHandler,
+	keySet *jwtkeys.KeySet,
+	sessions middleware.SessionChecker,
+	trustedProxies middleware.TrustedProxies) http.Handler {
 	router := chi.NewRouter()
+	router.Use(middleware.RealIP(trustedProxies))
+
+	router.Get("/.well-known/jwks.json", jwksHandler.GetJWKS)
 
 	router.Route("/auth", func(r chi.Router) {
 		r.Post("/register", userHandler.Register)
 		r.Post("/login", userHandler.Login)
 		r.Post("/refresh", userHandler.Refresh)
+		r.Post("/password/reset", userHandler.ResetPassword)
+		// only mounted when an OIDC provider is configured
+		if oidcHandler != nil {
+			r.Get("/oidc/login", oidcHandler.Login)
+			r.Get("/oidc/callback", oidcHandler.Callback)
+		}
 	})
 
 	router.Route("/users", func(r chi.Router) {
-		r.Use(middleware.Authenticate)
+		r.Use(middleware.Authenticate(keySet, sessions))
 		r.Get("/profile", userHandler.Profile)
+		r.Patch("/profile", userHandler.UpdateProfile)
+		r.Post("/password", userHandler.ChangePassword)
+		r.Delete("/me", userHandler.DeleteAccount)
 		r.Post("/logout", userHandler.LogOut)
-		r.Get("/",userHandler.GetAll)
+		// the full user directory is for admins only
+		r.With(middleware.RequireRole(user.RoleAdmin)).Get("/", userHandler.GetAll)
+		r.Get("/sessions", userHandler.ListSessions)
+		r.Delete("/sessions/{id}", userHandler.RevokeSession)
+		r.Get("/tokens", userHandler.ListTokens)
+		r.Post("/tokens", userHandler.CreateToken)
+		r.Delete("/tokens/{id}", userHandler.RevokeToken)
+	})
+
+	router.Route("/admin", func(r chi.Router) {
+		r.Use(middleware.Authenticate(keySet, sessions))
+		r.Use(middleware.RequireRole(user.RoleAdmin))
+		r.Get("/users", userHandler.ListUsers)
+		r.Post("/users/{id}/unlock", userHandler.UnlockUser)
+		r.Post("/users/{id}/deactivate", userHandler.DeactivateUser)
+		r.Post("/users/{id}/reactivate", userHandler.ReactivateUser)
+		r.Post("/users/{id}/force-password-reset", userHandler.ForcePasswordReset)
+		r.Delete("/users/{id}/sessions", userHandler.RevokeUserSessions)
 	})
 
 	return router
@@ -0,0 +1,124 @@
+package userservice
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"user_service/src/internal/core/security"
+	"user_service/src/internal/core/user"
+	"user_service/src/pkg/utilities"
+
+	"github.com/lib/pq"
+)
+
+// ErrUsernameReserved is returned for a username that only deleted accounts get
+var ErrUsernameReserved = errors.New("Username is Reserved")
+
+// usernameReserved reports whether the username has the prefix of deleted accounts, whatever its case
+func usernameReserved(username string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(username)), user.DeletedUsernamePrefix)
+}
+
+// UpdateProfile changes the username, email and/or display name of the user
+func (u *UserService) UpdateProfile(id int, update user.UpdateProfile) (user.UserProfile, error) {
+	update.Username = strings.TrimSpace(update.Username)
+	update.Email = strings.TrimSpace(update.Email)
+	update.DisplayName = strings.TrimSpace(update.DisplayName)
+	if update.Username == "" && update.Email == "" && update.DisplayName == "" {
+		return user.UserProfile{}, errors.New("Nothing to Update")
+	}
+	if usernameReserved(update.Username) {
+		return user.UserProfile{}, ErrUsernameReserved
+	}
+
+	updatedUser, err := u.userRepo.UpdateProfile(id, update)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			switch pqErr.Code.Name() {
+			case "unique_violation":
+				return user.UserProfile{}, errors.New("Username or Email Already Taken")
+			case "check_violation":
+				return user.UserProfile{}, errors.New("Invalid Email")
+			}
+		}
+		return user.UserProfile{}, errors.New("Failed to Update Profile")
+	}
+	return updatedUser, nil
+}
+
+// ChangePassword replaces the password after checking the current one, and signs out every
+// other session so a stolen session does not outlive the password change
+func (u *UserService) ChangePassword(id int, currentSess string, request user.ChangePassword, userAgent string, ipAddress string) error {
+	if request.NewPassword == "" {
+		return errors.New("New Password is Required")
+	}
+
+	profile, err := u.userRepo.GetUserByID(id)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return errors.New("User Not Found")
+	}
+	foundUser, err := u.userRepo.GetUser(profile.Username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return errors.New("User Not Found")
+	}
+	if err := utilities.CheckPassword(foundUser.Password, request.CurrentPassword); err != nil {
+		log.Printf("Error: %v", err)
+		return errors.New("Current Password is Incorrect")
+	}
+
+	if err := u.userRepo.UpdatePassword(id, request.NewPassword); err != nil {
+		log.Printf("Error: %v", err)
+		return errors.New("Failed to Change Password")
+	}
+
+	// keep the session the change was made from, if the request came with one
+	keepFamily := ""
+	if currentSess != "" {
+		if current, err := u.sessionRepo.GetSession(currentSess); err == nil && current.Uid == id {
+			keepFamily = current.FamilyId.String()
+		}
+	}
+	if keepFamily != "" {
+		err = u.sessionRepo.DeleteOtherSessions(id, keepFamily)
+	} else {
+		err = u.sessionRepo.DeleteSession(id)
+	}
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return errors.New("Password Changed but Failed to Revoke Other Sessions")
+	}
+
+	u.recordSecurityEvent(security.SecurityEvent{
+		EventType: security.EventPasswordChanged,
+		UserID:    id,
+		IpAddress: ipAddress,
+		UserAgent: userAgent,
+	})
+	return nil
+}
+
+// DeleteAccount anonymizes the user and announces a user_deleted event so other services
+// can drop or reassign what belongs to them. The event only goes to the outbox, not to the
+// security history, since the deletion also removes that.
+func (u *UserService) DeleteAccount(id int) error {
+	unusablePassword, err := randomToken()
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return errors.New("Failed to Delete Account")
+	}
+	deleted := security.SecurityEvent{
+		EventType: security.EventUserDeleted,
+		UserID:    id,
+		CreatedAt: time.Now(),
+	}
+	if err := u.userRepo.AnonymizeUser(id, unusablePassword, deleted); err != nil {
+		log.Printf("Error: %v", err)
+		return errors.New("Failed to Delete Account")
+	}
+	return nil
+}
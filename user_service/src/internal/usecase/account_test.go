@@ -0,0 +1,19 @@
+package userservice
+
+import (
+	"errors"
+	"testing"
+	"user_service/src/internal/core/user"
+)
+
+func TestDeletedUsernamesAreReserved(t *testing.T) {
+	var service UserService
+	for _, username := range []string{"deleted-user-7", "Deleted-User-7", " deleted-user-x"} {
+		if _, err := service.RegisterUser(user.UserRegister{Username: username, Email: "squatter@example.com", Password: "secret"}); !errors.Is(err, ErrUsernameReserved) {
+			t.Errorf("signing up as %q: got %v, want ErrUsernameReserved", username, err)
+		}
+		if _, err := service.UpdateProfile(1, user.UpdateProfile{Username: username}); !errors.Is(err, ErrUsernameReserved) {
+			t.Errorf("renaming to %q: got %v, want ErrUsernameReserved", username, err)
+		}
+	}
+}
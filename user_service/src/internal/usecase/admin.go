@@ -0,0 +1,172 @@
+package userservice
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"user_service/src/internal/core/user"
+	"user_service/src/pkg/utilities"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrAccountDeactivated is returned when a deactivated user tries to log in
+	ErrAccountDeactivated = errors.New("Account Deactivated")
+	// ErrPasswordResetRequired is returned on login until the user sets a new password through ResetPassword
+	ErrPasswordResetRequired = errors.New("Password Reset Required")
+)
+
+const (
+	defaultUserPageSize = 20
+	maxUserPageSize     = 100
+	// passwordResetTTL is how long the token of a forced password reset can be used
+	passwordResetTTL = 72 * time.Hour
+)
+
+// PasswordReset is the single-use token an admin hands to the user out of band to finish a forced reset
+type PasswordReset struct {
+	ResetToken string    `json:"reset_token"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type UserList struct {
+	Users  []user.AdminUser `json:"users"`
+	Total  int              `json:"total"`
+	Limit  int              `json:"limit"`
+	Offset int              `json:"offset"`
+}
+
+// ListUsers returns one page of the accounts matching the search
+func (u *UserService) ListUsers(listQuery user.UserListQuery) (UserList, error) {
+	if listQuery.Limit <= 0 {
+		listQuery.Limit = defaultUserPageSize
+	}
+	listQuery.Limit = min(listQuery.Limit, maxUserPageSize)
+	listQuery.Offset = max(listQuery.Offset, 0)
+	listQuery.Search = strings.TrimSpace(listQuery.Search)
+
+	users, total, err := u.userRepo.ListUsers(listQuery)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return UserList{}, errors.New("Unable to Fetch Users")
+	}
+	return UserList{Users: users, Total: total, Limit: listQuery.Limit, Offset: listQuery.Offset}, nil
+}
+
+// DeactivateUser blocks the account and ends its sessions, its access tokens are refused while it stays deactivated
+func (u *UserService) DeactivateUser(adminID int, id int) error {
+	if adminID == id {
+		return errors.New("Admins Cannot Deactivate Themselves")
+	}
+	if err := u.userRepo.SetDeactivated(id, true); err != nil {
+		log.Printf("Error: %v", err)
+		return errors.New("User Not Found")
+	}
+	if err := u.sessionRepo.DeleteSession(id); err != nil {
+		log.Printf("Error: %v", err)
+		return errors.New("User Deactivated but Failed to Revoke Sessions")
+	}
+	log.Printf("Admin %d deactivated user %d", adminID, id)
+	return nil
+}
+
+func (u *UserService) ReactivateUser(adminID int, id int) error {
+	if err := u.userRepo.SetDeactivated(id, false); err != nil {
+		log.Printf("Error: %v", err)
+		return errors.New("User Not Found")
+	}
+	log.Printf("Admin %d reactivated user %d", adminID, id)
+	return nil
+}
+
+// ForcePasswordReset signs the user out everywhere, revokes their personal access tokens and makes
+// them choose a new password before the next login. The reset is completed with the returned token,
+// not the current password, which may be exactly what leaked. Only a hash of the token is kept, the
+// admin passes it on to the user.
+func (u *UserService) ForcePasswordReset(adminID int, id int) (PasswordReset, error) {
+	token, err := randomToken()
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return PasswordReset{}, errors.New("Failed to Create Reset Token")
+	}
+	tokenHash, err := bcrypt.GenerateFromPassword([]byte(token), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return PasswordReset{}, errors.New("Failed to Create Reset Token")
+	}
+	reset := PasswordReset{ResetToken: token, ExpiresAt: time.Now().Add(passwordResetTTL)}
+
+	// the sessions and personal access tokens go in the same step
+	err = u.userRepo.RequirePasswordReset(id, string(tokenHash), reset.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return PasswordReset{}, errors.New("User Not Found")
+	}
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return PasswordReset{}, errors.New("Failed to Require Password Reset")
+	}
+	log.Printf("Admin %d forced a password reset for user %d", adminID, id)
+	return reset, nil
+}
+
+func (u *UserService) RevokeUserSessions(adminID int, id int) error {
+	if _, err := u.userRepo.GetUserByID(id); err != nil {
+		log.Printf("Error: %v", err)
+		return errors.New("User Not Found")
+	}
+	if err := u.sessionRepo.DeleteSession(id); err != nil {
+		log.Printf("Error: %v", err)
+		return errors.New("Failed to Revoke Sessions")
+	}
+	log.Printf("Admin %d revoked all sessions of user %d", adminID, id)
+	return nil
+}
+
+// ResetPassword lets a user whose password an admin reset choose a new one. It needs the reset
+// token ForcePasswordReset issued, which works once, and goes through the same login throttle,
+// since it is unauthenticated.
+func (u *UserService) ResetPassword(request user.ResetPassword, userAgent string, ipAddress string) error {
+	if err := u.checkLoginThrottle(request.Username, ipAddress); err != nil {
+		return err
+	}
+
+	foundUser, err := u.userRepo.GetUser(request.Username)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return u.recordLoginFailure(request.Username, nil, userAgent, ipAddress)
+	}
+	tokenHash, expiresAt, err := u.userRepo.GetPasswordReset(foundUser.Uid)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return errors.New("Failed to Reset Password")
+	}
+	if tokenHash == "" || bcrypt.CompareHashAndPassword([]byte(tokenHash), []byte(request.ResetToken)) != nil {
+		return u.recordLoginFailure(request.Username, &foundUser, userAgent, ipAddress)
+	}
+	u.resetLoginThrottle(request.Username)
+
+	if foundUser.DeactivatedAt != nil {
+		return ErrAccountDeactivated
+	}
+	if time.Now().After(expiresAt) {
+		return errors.New("Reset Token Expired, Ask an Admin for a New One")
+	}
+	if request.NewPassword == "" {
+		return errors.New("New Password is Required")
+	}
+	if utilities.CheckPassword(foundUser.Password, request.NewPassword) == nil {
+		return errors.New("New Password Must be Different From the Current One")
+	}
+
+	err = u.userRepo.CompletePasswordReset(foundUser.Uid, tokenHash, request.NewPassword)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("Reset Token Already Used")
+	} else if err != nil {
+		log.Printf("Error: %v", err)
+		return errors.New("Failed to Reset Password")
+	}
+	return nil
+}
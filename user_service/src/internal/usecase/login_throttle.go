@@ -0,0 +1,140 @@
+package userservice
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+	"user_service/src/internal/core/security"
+	"user_service/src/internal/core/user"
+)
+
+const (
+	// failures older than the window are forgotten
+	loginFailureWindow = 15 * time.Minute
+	// an account locks after this many failures, an IP address after more since it can be shared
+	usernameFailureThreshold = 5
+	ipFailureThreshold       = 20
+	// every failure past the threshold doubles the lockout, up to the maximum
+	baseLockout = 1 * time.Minute
+	maxLockout  = 1 * time.Hour
+)
+
+// LoginLockedError is returned while a username or IP address is locked out
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return "Too Many Failed Login Attempts, Try Again Later"
+}
+
+func usernameThrottleKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func ipThrottleKey(ipAddress string) string {
+	return "ip:" + ipAddress
+}
+
+func (u *UserService) checkLoginThrottle(username string, ipAddress string) error {
+	for _, key := range []string{usernameThrottleKey(username), ipThrottleKey(ipAddress)} {
+		throttle, err := u.loginThrottleRepo.GetThrottle(key)
+		if err != nil {
+			// failing open keeps logins working when the throttle table has trouble
+			log.Printf("Error: %v", err)
+			continue
+		}
+		if throttle.LockedUntil != nil && time.Now().Before(*throttle.LockedUntil) {
+			return &LoginLockedError{RetryAfter: time.Until(*throttle.LockedUntil)}
+		}
+	}
+	return nil
+}
+
+// recordLoginFailure counts the failure against the username and the IP address and returns the error
+// for the caller: a lock when this failure crossed a threshold, invalid credentials otherwise.
+// foundUser is nil for unknown usernames, which are throttled all the same.
+func (u *UserService) recordLoginFailure(username string, foundUser *user.User, userAgent string, ipAddress string) error {
+	var lockedFor time.Duration
+
+	userThrottle, err := u.loginThrottleRepo.RecordFailure(usernameThrottleKey(username), loginFailureWindow)
+	if err != nil {
+		log.Printf("Error: %v", err)
+	} else if lockout := lockoutFor(userThrottle.Failures, usernameFailureThreshold); lockout > 0 {
+		lockedFor = lockout
+		if err := u.loginThrottleRepo.Lock(userThrottle.Key, time.Now().Add(lockout)); err != nil {
+			log.Printf("Error: %v", err)
+		}
+		if foundUser != nil {
+			u.recordSecurityEvent(security.SecurityEvent{
+				EventType: security.EventAccountLocked,
+				UserID:    foundUser.Uid,
+				IpAddress: ipAddress,
+				UserAgent: userAgent,
+				Detail:    fmt.Sprintf("locked for %s after %d failed logins", lockout, userThrottle.Failures),
+			})
+		}
+	}
+
+	ipThrottle, err := u.loginThrottleRepo.RecordFailure(ipThrottleKey(ipAddress), loginFailureWindow)
+	if err != nil {
+		log.Printf("Error: %v", err)
+	} else if lockout := lockoutFor(ipThrottle.Failures, ipFailureThreshold); lockout > 0 {
+		lockedFor = max(lockedFor, lockout)
+		if err := u.loginThrottleRepo.Lock(ipThrottle.Key, time.Now().Add(lockout)); err != nil {
+			log.Printf("Error: %v", err)
+		}
+	}
+
+	if lockedFor > 0 {
+		return &LoginLockedError{RetryAfter: lockedFor}
+	}
+	return errors.New("Invalid Credentials")
+}
+
+// resetLoginThrottle clears the username after a successful login. The IP address is left to
+// expire on its own, otherwise logging into one's own account would reset an attacker's counter.
+func (u *UserService) resetLoginThrottle(username string) {
+	if err := u.loginThrottleRepo.ResetThrottle(usernameThrottleKey(username)); err != nil {
+		log.Printf("Error: %v", err)
+	}
+}
+
+// lockoutFor returns 0 below the threshold, then baseLockout doubling with every further failure
+func lockoutFor(failures int, threshold int) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	exponent := failures - threshold
+	if exponent > 16 {
+		return maxLockout
+	}
+	lockout := time.Duration(float64(baseLockout) * math.Pow(2, float64(exponent)))
+	return min(lockout, maxLockout)
+}
+
+// UnlockUser lets an admin clear the lockout of an account before it expires
+func (u *UserService) UnlockUser(id int) error {
+	foundUser, err := u.userRepo.GetUserByID(id)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return errors.New("User Not Found")
+	}
+	if err := u.loginThrottleRepo.ResetThrottle(usernameThrottleKey(foundUser.Username)); err != nil {
+		log.Printf("Error: %v", err)
+		return errors.New("Failed to Unlock User")
+	}
+	return nil
+}
+
+// recordSecurityEvent stores the event, the outbox relay forwards it to the other services so the
+// account owner is told
+func (u *UserService) recordSecurityEvent(event security.SecurityEvent) {
+	event.CreatedAt = time.Now()
+	if err := u.securityEventRepo.CreateEvent(event); err != nil {
+		log.Printf("Error: %v", err)
+	}
+}
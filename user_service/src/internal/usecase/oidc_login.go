@@ -0,0 +1,261 @@
+package userservice
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"user_service/src/internal/adaptors/oidc"
+	"user_service/src/internal/adaptors/persistance"
+	"user_service/src/internal/core/identity"
+	"user_service/src/internal/core/user"
+
+	"golang.org/x/oauth2"
+)
+
+// a started login must come back from the provider within this time
+const OIDCLoginStateTTL = 10 * time.Minute
+
+var usernameUnsafeChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// identityStore is the part of persistance.IdentityRepo a provider login uses
+type identityStore interface {
+	GetIdentity(provider string, subject string) (identity.Identity, error)
+	CreateIdentity(newIdentity identity.Identity) error
+	CreateLoginState(state identity.LoginState) error
+	ConsumeLoginState(state string) (identity.LoginState, error)
+	DeleteExpiredLoginStates(before time.Time) error
+}
+
+// oidcUserStore is the part of persistance.UserRepo a provider login uses
+type oidcUserStore interface {
+	GetUser(username string) (user.User, error)
+	GetUserByID(id int) (user.UserProfile, error)
+	GetUserByEmail(email string) (user.User, error)
+	UsernameExists(username string) (bool, error)
+	CreateUser(newUser user.UserRegister) (user.UserResponse, error)
+	UpdateProfile(id int, update user.UpdateProfile) (user.UserProfile, error)
+}
+
+// OIDCLoginService signs users in through an external OpenID Connect provider
+// and hands them the same session and JWT as a password login
+type OIDCLoginService struct {
+	userRepo     oidcUserStore
+	identityRepo identityStore
+	provider     *oidc.Provider
+	// issueLogin opens the session, UserService.issueLogin outside of tests
+	issueLogin func(foundUser user.User, userAgent string, ipAddress string) (LoginResponse, error)
+}
+
+func NewOIDCLoginService(userService *UserService, identityRepo persistance.IdentityRepo, provider *oidc.Provider) OIDCLoginService {
+	return OIDCLoginService{
+		userRepo:     &userService.userRepo,
+		identityRepo: &identityRepo,
+		provider:     provider,
+		issueLogin:   userService.issueLogin,
+	}
+}
+
+// StartLogin stores a fresh state, PKCE verifier and nonce, and returns the provider URL to redirect
+// to along with the state. The caller must bind the state to the browser, see FinishLogin.
+func (o *OIDCLoginService) StartLogin(ctx context.Context) (string, string, error) {
+	state, err := randomToken()
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return "", "", errors.New("Failed to Start Login")
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return "", "", errors.New("Failed to Start Login")
+	}
+	loginState := identity.LoginState{
+		State:        state,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		Nonce:        nonce,
+	}
+
+	// clean up logins that were abandoned at the provider
+	if err := o.identityRepo.DeleteExpiredLoginStates(time.Now().Add(-OIDCLoginStateTTL)); err != nil {
+		log.Printf("Error: %v", err)
+	}
+	if err := o.identityRepo.CreateLoginState(loginState); err != nil {
+		log.Printf("Error: %v", err)
+		return "", "", errors.New("Failed to Start Login")
+	}
+
+	authURL, err := o.provider.AuthCodeURL(ctx, loginState.State, loginState.Nonce, loginState.CodeVerifier)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return "", "", errors.New("Login Provider Unavailable")
+	}
+	return authURL, loginState.State, nil
+}
+
+// FinishLogin handles the provider callback: it redeems the code with the stored verifier,
+// resolves the local user for the verified identity and opens a session for it. browserState
+// is the state StartLogin handed to this browser, a callback started in another browser is
+// refused so nobody can log a victim into the attacker's account with their own callback URL.
+func (o *OIDCLoginService) FinishLogin(ctx context.Context, state string, browserState string, code string, userAgent string, ipAddress string) (LoginResponse, error) {
+	if state == "" || code == "" {
+		return LoginResponse{}, errors.New("Missing State or Code")
+	}
+	if subtle.ConstantTimeCompare([]byte(state), []byte(browserState)) != 1 {
+		return LoginResponse{}, errors.New("Login Was Started in Another Browser")
+	}
+
+	loginState, err := o.identityRepo.ConsumeLoginState(state)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return LoginResponse{}, errors.New("Invalid Login State")
+	}
+	if time.Since(loginState.CreatedAt) > OIDCLoginStateTTL {
+		return LoginResponse{}, errors.New("Login State Expired")
+	}
+
+	claims, err := o.provider.Exchange(ctx, code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return LoginResponse{}, errors.New("Failed to Verify Login With Provider")
+	}
+
+	foundUser, err := o.resolveUser(claims)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	return o.issueLogin(foundUser, userAgent, ipAddress)
+}
+
+// resolveUser returns the user linked to the provider identity. An unknown identity is linked
+// to the account with the same email only when the provider verified that email, otherwise
+// a new account is created for it.
+func (o *OIDCLoginService) resolveUser(claims identity.ProviderClaims) (user.User, error) {
+	if claims.Subject == "" {
+		return user.User{}, errors.New("Provider Returned No Subject")
+	}
+
+	linked, err := o.identityRepo.GetIdentity(o.provider.Issuer(), claims.Subject)
+	if err == nil {
+		profile, err := o.userRepo.GetUserByID(linked.Uid)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return user.User{}, errors.New("Linked User Not Found")
+		}
+		return o.userRepo.GetUser(profile.Username)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error: %v", err)
+		return user.User{}, errors.New("Failed to Look Up Identity")
+	}
+
+	if claims.Email == "" {
+		return user.User{}, errors.New("Provider Did Not Share an Email")
+	}
+
+	foundUser, err := o.userRepo.GetUserByEmail(claims.Email)
+	switch {
+	case err == nil:
+		if !claims.EmailVerified {
+			return user.User{}, errors.New("Email Already Registered, Log In With Password")
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		foundUser, err = o.createUser(claims)
+		if err != nil {
+			return user.User{}, err
+		}
+	default:
+		log.Printf("Error: %v", err)
+		return user.User{}, errors.New("Failed to Look Up User")
+	}
+
+	err = o.identityRepo.CreateIdentity(identity.Identity{
+		Uid:      foundUser.Uid,
+		Provider: o.provider.Issuer(),
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return user.User{}, errors.New("Failed to Link Identity")
+	}
+	return foundUser, nil
+}
+
+// createUser registers an account for a first-time provider login. It gets a random
+// password nobody knows, so it can only sign in through the provider.
+func (o *OIDCLoginService) createUser(claims identity.ProviderClaims) (user.User, error) {
+	// users_email_check only accepts .com addresses, the same rule as a password sign up
+	if !strings.HasSuffix(claims.Email, ".com") {
+		return user.User{}, errors.New("Only .com Email Addresses Can Sign Up")
+	}
+	username, err := o.availableUsername(claims)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return user.User{}, errors.New("Failed to Create User")
+	}
+	password, err := randomToken()
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return user.User{}, errors.New("Failed to Create User")
+	}
+
+	createdUser, err := o.userRepo.CreateUser(user.UserRegister{
+		Username: username,
+		Email:    claims.Email,
+		Password: password,
+	})
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return user.User{}, errors.New("Failed to Create User")
+	}
+	if claims.Name != "" {
+		if _, err := o.userRepo.UpdateProfile(createdUser.Uid, user.UpdateProfile{DisplayName: claims.Name}); err != nil {
+			log.Printf("Error: %v", err)
+		}
+	}
+	return o.userRepo.GetUser(username)
+}
+
+// availableUsername derives a username from the provider claims, adding a suffix when it is taken
+func (o *OIDCLoginService) availableUsername(claims identity.ProviderClaims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = usernameUnsafeChars.ReplaceAllString(base, "")
+	if base == "" || usernameReserved(base) {
+		base = "user"
+	}
+
+	candidate := base
+	for attempt := 0; attempt < 5; attempt++ {
+		exists, err := o.userRepo.UsernameExists(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+		suffix, err := randomToken()
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s-%s", base, strings.ToLower(suffix[:6]))
+	}
+	return "", errors.New("no free username found")
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,369 @@
+package userservice
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"user_service/src/internal/adaptors/oidc"
+	"user_service/src/internal/core/identity"
+	"user_service/src/internal/core/user"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testClientID = "task-manager"
+
+// mockProvider is a minimal OpenID Connect provider: discovery, JWKS and a token endpoint that
+// checks the PKCE verifier against the challenge of the authorization request
+type mockProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+// authorization is what the provider remembers about a code until it is redeemed
+type authorization struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &mockProvider{key: key, codes: make(map[string]authorization)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/authorize",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// authorize plays the user consenting at the provider: it checks the authorization request and
+// returns the code the provider would redirect back with
+func (p *mockProvider) authorize(t *testing.T, authURL string, claims jwt.MapClaims) (string, string) {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization request without S256 PKCE challenge: %s", authURL)
+	}
+	if query.Get("nonce") == "" {
+		t.Fatalf("authorization request without nonce: %s", authURL)
+	}
+
+	code := "code-" + query.Get("state")[:8]
+	p.mu.Lock()
+	p.codes[code] = authorization{challenge: query.Get("code_challenge"), nonce: query.Get("nonce"), claims: claims}
+	p.mu.Unlock()
+	return query.Get("state"), code
+}
+
+func (p *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	auth, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   p.server.URL,
+		"aud":   testClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": auth.nonce,
+	}
+	for name, value := range auth.claims {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+type fakeIdentityRepo struct {
+	states     map[string]identity.LoginState
+	identities []identity.Identity
+}
+
+func (f *fakeIdentityRepo) GetIdentity(provider string, subject string) (identity.Identity, error) {
+	for _, found := range f.identities {
+		if found.Provider == provider && found.Subject == subject {
+			return found, nil
+		}
+	}
+	return identity.Identity{}, sql.ErrNoRows
+}
+
+func (f *fakeIdentityRepo) CreateIdentity(newIdentity identity.Identity) error {
+	f.identities = append(f.identities, newIdentity)
+	return nil
+}
+
+func (f *fakeIdentityRepo) CreateLoginState(state identity.LoginState) error {
+	state.CreatedAt = time.Now()
+	f.states[state.State] = state
+	return nil
+}
+
+func (f *fakeIdentityRepo) ConsumeLoginState(state string) (identity.LoginState, error) {
+	found, ok := f.states[state]
+	if !ok {
+		return identity.LoginState{}, sql.ErrNoRows
+	}
+	delete(f.states, state)
+	return found, nil
+}
+
+func (f *fakeIdentityRepo) DeleteExpiredLoginStates(before time.Time) error {
+	return nil
+}
+
+type fakeUserRepo struct {
+	users []user.User
+}
+
+func (f *fakeUserRepo) find(match func(user.User) bool) (user.User, error) {
+	for _, found := range f.users {
+		if match(found) {
+			return found, nil
+		}
+	}
+	return user.User{}, sql.ErrNoRows
+}
+
+func (f *fakeUserRepo) GetUser(username string) (user.User, error) {
+	return f.find(func(u user.User) bool { return u.Username == username })
+}
+
+func (f *fakeUserRepo) GetUserByID(id int) (user.UserProfile, error) {
+	found, err := f.find(func(u user.User) bool { return u.Uid == id })
+	return user.UserProfile{Uid: found.Uid, Username: found.Username, Email: found.Email}, err
+}
+
+func (f *fakeUserRepo) GetUserByEmail(email string) (user.User, error) {
+	return f.find(func(u user.User) bool { return u.Email == email })
+}
+
+func (f *fakeUserRepo) UsernameExists(username string) (bool, error) {
+	_, err := f.GetUser(username)
+	return err == nil, nil
+}
+
+func (f *fakeUserRepo) CreateUser(newUser user.UserRegister) (user.UserResponse, error) {
+	created := user.User{Uid: len(f.users) + 1, Username: newUser.Username, Email: newUser.Email, Password: newUser.Password}
+	f.users = append(f.users, created)
+	return user.UserResponse{Uid: created.Uid}, nil
+}
+
+func (f *fakeUserRepo) UpdateProfile(id int, update user.UpdateProfile) (user.UserProfile, error) {
+	return f.GetUserByID(id)
+}
+
+type oidcTest struct {
+	provider   *mockProvider
+	identities *fakeIdentityRepo
+	users      *fakeUserRepo
+	service    OIDCLoginService
+}
+
+func newOIDCTest(t *testing.T, users ...user.User) *oidcTest {
+	provider := newMockProvider(t)
+	test := &oidcTest{
+		provider:   provider,
+		identities: &fakeIdentityRepo{states: make(map[string]identity.LoginState)},
+		users:      &fakeUserRepo{users: users},
+	}
+	test.service = OIDCLoginService{
+		userRepo:     test.users,
+		identityRepo: test.identities,
+		provider: oidc.NewProvider(oidc.ProviderConfig{
+			IssuerURL:    provider.server.URL,
+			ClientID:     testClientID,
+			ClientSecret: "secret",
+			RedirectURL:  "http://localhost/auth/oidc/callback",
+		}),
+		issueLogin: func(foundUser user.User, userAgent string, ipAddress string) (LoginResponse, error) {
+			return LoginResponse{FounUser: foundUser}, nil
+		},
+	}
+	return test
+}
+
+// login runs a whole login for a provider account with the claims, from the same browser
+func (o *oidcTest) login(t *testing.T, claims jwt.MapClaims) (LoginResponse, error) {
+	t.Helper()
+	ctx := context.Background()
+	authURL, browserState, err := o.service.StartLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := o.provider.authorize(t, authURL, claims)
+	return o.service.FinishLogin(ctx, state, browserState, code, "test", "127.0.0.1")
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	test := newOIDCTest(t)
+	resp, err := test.login(t, jwt.MapClaims{"sub": "alice-sub", "email": "alice@example.com", "email_verified": true, "preferred_username": "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.FounUser.Username != "alice" || resp.FounUser.Email != "alice@example.com" {
+		t.Fatalf("logged in as %+v, want a new user alice", resp.FounUser)
+	}
+	if len(test.identities.identities) != 1 || test.identities.identities[0].Uid != resp.FounUser.Uid {
+		t.Fatalf("identities %+v, want alice-sub linked to user %d", test.identities.identities, resp.FounUser.Uid)
+	}
+
+	// the second login finds the linked identity
+	again, err := test.login(t, jwt.MapClaims{"sub": "alice-sub", "email": "alice@example.com", "preferred_username": "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.FounUser.Uid != resp.FounUser.Uid || len(test.users.users) != 1 {
+		t.Fatalf("second login as %+v with %d users, want the same user", again.FounUser, len(test.users.users))
+	}
+}
+
+func TestOIDCLoginLinksVerifiedEmail(t *testing.T) {
+	existing := user.User{Uid: 7, Username: "bob", Email: "bob@example.com"}
+	test := newOIDCTest(t, existing)
+	resp, err := test.login(t, jwt.MapClaims{"sub": "bob-sub", "email": "bob@example.com", "email_verified": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.FounUser.Uid != existing.Uid {
+		t.Fatalf("logged in as user %d, want %d", resp.FounUser.Uid, existing.Uid)
+	}
+	if len(test.identities.identities) != 1 || test.identities.identities[0].Uid != existing.Uid {
+		t.Fatalf("identities %+v, want bob-sub linked to user %d", test.identities.identities, existing.Uid)
+	}
+}
+
+func TestOIDCLoginRefusesUnverifiedEmail(t *testing.T) {
+	test := newOIDCTest(t, user.User{Uid: 7, Username: "bob", Email: "bob@example.com"})
+	_, err := test.login(t, jwt.MapClaims{"sub": "mallory-sub", "email": "bob@example.com", "email_verified": false})
+	if err == nil || len(test.identities.identities) != 0 {
+		t.Fatalf("unverified email was linked, err %v", err)
+	}
+}
+
+func TestOIDCLoginRefusesNonComEmail(t *testing.T) {
+	test := newOIDCTest(t)
+	_, err := test.login(t, jwt.MapClaims{"sub": "carol-sub", "email": "carol@example.org", "email_verified": true})
+	if err == nil || !strings.Contains(err.Error(), ".com") {
+		t.Fatalf("got %v, want the .com rule explained", err)
+	}
+	if len(test.users.users) != 0 {
+		t.Fatal("user created for a .org email")
+	}
+}
+
+func TestOIDCLoginChecksPKCEVerifier(t *testing.T) {
+	test := newOIDCTest(t)
+	ctx := context.Background()
+	authURL, browserState, err := test.service.StartLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := test.provider.authorize(t, authURL, jwt.MapClaims{"sub": "alice-sub", "email": "alice@example.com"})
+
+	stored := test.identities.states[state]
+	stored.CodeVerifier = "not-the-verifier-of-the-challenge-at-all-0000"
+	test.identities.states[state] = stored
+	if _, err := test.service.FinishLogin(ctx, state, browserState, code, "test", "127.0.0.1"); err == nil {
+		t.Fatal("code redeemed with the wrong PKCE verifier")
+	}
+}
+
+func TestOIDCLoginChecksNonce(t *testing.T) {
+	test := newOIDCTest(t)
+	_, err := test.login(t, jwt.MapClaims{"sub": "alice-sub", "email": "alice@example.com", "nonce": "replayed"})
+	if err == nil {
+		t.Fatal("id_token with another nonce accepted")
+	}
+}
+
+func TestOIDCLoginChecksBrowserState(t *testing.T) {
+	test := newOIDCTest(t)
+	ctx := context.Background()
+	authURL, _, err := test.service.StartLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := test.provider.authorize(t, authURL, jwt.MapClaims{"sub": "attacker-sub", "email": "attacker@example.com"})
+
+	// the victim's browser never started this login, so it has no or another state cookie
+	for _, browserState := range []string{"", "another-login"} {
+		if _, err := test.service.FinishLogin(ctx, state, browserState, code, "test", "127.0.0.1"); err == nil {
+			t.Fatalf("callback accepted with browser state %q", browserState)
+		}
+	}
+	if len(test.identities.states) != 1 {
+		t.Fatal("a refused callback used up the login state")
+	}
+}
@@ -0,0 +1,98 @@
+package userservice
+
+import (
+	"context"
+	"log"
+	"time"
+	"user_service/src/internal/adaptors/persistance"
+	"user_service/src/internal/adaptors/redis/events"
+	"user_service/src/internal/core/outbox"
+)
+
+const (
+	outboxBatchSize  = 100
+	outboxMaxBackoff = 5 * time.Minute
+	// sent messages are kept this long for inspection before they are cleaned up
+	outboxRetention = 7 * 24 * time.Hour
+)
+
+// OutboxRelay appends the user events stored in the outbox to their stream, retrying until Redis
+// takes them, so a deleted account is always reassigned and purged by the other services
+type OutboxRelay struct {
+	outboxRepo persistance.OutboxRepo
+	publisher  *events.EventPublisher
+	interval   time.Duration
+}
+
+func NewOutboxRelay(outboxRepo persistance.OutboxRepo, publisher *events.EventPublisher, interval time.Duration) *OutboxRelay {
+	return &OutboxRelay{
+		outboxRepo: outboxRepo,
+		publisher:  publisher,
+		interval:   interval,
+	}
+}
+
+// Run relays pending events every interval until ctx is done
+func (r *OutboxRelay) Run(ctx context.Context) {
+	log.Println("Starting outbox relay...")
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Outbox relay shutting down...")
+			return
+		case <-ticker.C:
+			r.relay(ctx)
+			if time.Since(lastCleanup) > time.Hour {
+				r.cleanup()
+				lastCleanup = time.Now()
+			}
+		}
+	}
+}
+
+// relay drains the due events batch by batch, a short batch means nothing is left or publishing failed
+func (r *OutboxRelay) relay(ctx context.Context) {
+	for {
+		sent, err := r.outboxRepo.RelayPending(outboxBatchSize, func(m outbox.Message) error {
+			err := r.publisher.AppendEvent(ctx, m.Topic, m.Payload)
+			if err != nil {
+				log.Printf("Failed to publish outbox message %d (attempt %d): %v", m.Id, m.Attempts+1, err)
+			}
+			return err
+		}, outboxBackoff)
+		if err != nil {
+			log.Printf("Error relaying outbox: %v", err)
+			return
+		}
+		if sent < outboxBatchSize {
+			return
+		}
+	}
+}
+
+func (r *OutboxRelay) cleanup() {
+	deleted, err := r.outboxRepo.DeleteSent(time.Now().Add(-outboxRetention))
+	if err != nil {
+		log.Printf("Error cleaning up outbox: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d sent outbox messages", deleted)
+	}
+}
+
+// outboxBackoff doubles the wait with every failed attempt, up to outboxMaxBackoff
+func outboxBackoff(attempts int) time.Duration {
+	if attempts > 16 {
+		return outboxMaxBackoff
+	}
+	backoff := time.Second << attempts
+	if backoff > outboxMaxBackoff {
+		return outboxMaxBackoff
+	}
+	return backoff
+}
@@ -4,27 +4,46 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"strings"
 	"time"
 	"user_service/src/internal/adaptors/persistance"
+	"user_service/src/internal/core/accesstoken"
+	"user_service/src/internal/core/security"
 	"user_service/src/internal/core/session"
 	"user_service/src/internal/core/user"
+	"user_service/src/pkg/jwtkeys"
 	"user_service/src/pkg/utilities"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 type UserService struct {
-	userRepo    persistance.UserRepo
-	sessionRepo persistance.SessionRepo
+	userRepo          persistance.UserRepo
+	sessionRepo       persistance.SessionRepo
+	securityEventRepo persistance.SecurityEventRepo
+	accessTokenRepo   persistance.AccessTokenRepo
+	loginThrottleRepo persistance.LoginThrottleRepo
+	keySet            *jwtkeys.KeySet
 }
 
-func NewUserService(userRepo persistance.UserRepo, sessionRepo persistance.SessionRepo) UserService {
-	return UserService{userRepo: userRepo, sessionRepo: sessionRepo}
+func NewUserService(userRepo persistance.UserRepo, sessionRepo persistance.SessionRepo, securityEventRepo persistance.SecurityEventRepo, accessTokenRepo persistance.AccessTokenRepo, loginThrottleRepo persistance.LoginThrottleRepo, keySet *jwtkeys.KeySet) UserService {
+	return UserService{
+		userRepo:          userRepo,
+		sessionRepo:       sessionRepo,
+		securityEventRepo: securityEventRepo,
+		accessTokenRepo:   accessTokenRepo,
+		loginThrottleRepo: loginThrottleRepo,
+		keySet:            keySet,
+	}
 }
 
 // registration function definition
-func (u *UserService) RegisterUser(user user.UserRegister) (user.UserResponse, error) {
-	newUser, err := u.userRepo.CreateUser(user)
+func (u *UserService) RegisterUser(register user.UserRegister) (user.UserResponse, error) {
+	if usernameReserved(register.Username) {
+		return user.UserResponse{}, ErrUsernameReserved
+	}
+	newUser, err := u.userRepo.CreateUser(register)
 	if err != nil {
 		log.Printf("Error: %v", err)
 		return newUser, errors.New("Something Went Wrong!")
@@ -39,35 +58,58 @@ type LoginResponse struct {
 	Session     session.Session
 }
 
-func (u *UserService) LoginUser(requestUser user.UserLogin) (LoginResponse, error) {
+func (u *UserService) LoginUser(requestUser user.UserLogin, userAgent string, ipAddress string) (LoginResponse, error) {
 	loginResponse := LoginResponse{}
 
+	// locked keys are refused before the password is even checked
+	if err := u.checkLoginThrottle(requestUser.Username, ipAddress); err != nil {
+		return loginResponse, err
+	}
+
 	foundUser, err := u.userRepo.GetUser(requestUser.Username)
 	if err != nil {
 		log.Printf("Error: %v", err)
-		return loginResponse, errors.New("Invalid Credentials")
+		return loginResponse, u.recordLoginFailure(requestUser.Username, nil, userAgent, ipAddress)
 	}
 
 	loginResponse.FounUser = foundUser
 	if err := matchPassword(requestUser, foundUser.Password); err != nil {
 		log.Printf("Error: %v", err)
-		return loginResponse, errors.New("Invalid Credentials")
+		return loginResponse, u.recordLoginFailure(requestUser.Username, &foundUser, userAgent, ipAddress)
 	}
-	tokenString, tokenExpire, err := utilities.GenerateJWT(foundUser.Uid)
-	loginResponse.TokenString = tokenString
-	loginResponse.TokenExpire = tokenExpire
+	u.resetLoginThrottle(requestUser.Username)
 
-	if err != nil {
-		log.Printf("Error: %v", err)
-		return loginResponse, errors.New("Failed to Generate Token")
+	if foundUser.PasswordResetRequired {
+		return loginResponse, ErrPasswordResetRequired
+	}
+	return u.issueLogin(foundUser, userAgent, ipAddress)
+}
+
+// issueLogin starts a new session family for an authenticated user and signs its first JWT,
+// shared by password and OIDC logins
+func (u *UserService) issueLogin(foundUser user.User, userAgent string, ipAddress string) (LoginResponse, error) {
+	loginResponse := LoginResponse{FounUser: foundUser}
+	if foundUser.DeactivatedAt != nil {
+		return loginResponse, ErrAccountDeactivated
 	}
 
 	session, err := utilities.GenerateSession(foundUser.Uid)
-	loginResponse.Session = session
 	if err != nil {
 		log.Printf("Error: %v", err)
 		return loginResponse, errors.New("Failed to Generate Session")
 	}
+	session.UserAgent = userAgent
+	session.IpAddress = ipAddress
+	loginResponse.Session = session
+
+	tokenString, tokenExpire, err := utilities.GenerateJWT(u.keySet, foundUser.Uid, session.FamilyId.String(), []string{foundUser.Role})
+	loginResponse.TokenString = tokenString
+	loginResponse.TokenExpire = tokenExpire
+
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return loginResponse, errors.New("Failed to Generate Token")
+	}
 
 	err = u.sessionRepo.CreateSession(session)
 	if err != nil {
@@ -78,28 +120,93 @@ func (u *UserService) LoginUser(requestUser user.UserLogin) (LoginResponse, erro
 	return loginResponse, nil
 }
 
-func (u *UserService) GetJwtFromSession(sess string) (string, time.Time, error) {
-	var tokenString string
-	var tokenExpire time.Time
-	session, err := u.sessionRepo.GetSession(sess)
+type RefreshResponse struct {
+	TokenString string
+	TokenExpire time.Time
+	Session     session.Session
+}
+
+// RefreshSession issues a new JWT and rotates the session token. Presenting a token that was
+// already rotated means it leaked, so the whole family is revoked and a security event is recorded.
+func (u *UserService) RefreshSession(sess string, userAgent string, ipAddress string) (RefreshResponse, error) {
+	refreshResponse := RefreshResponse{}
+	oldSession, err := u.sessionRepo.GetSession(sess)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return refreshResponse, errors.New("Invalid Session")
+	}
+
+	err = matchSessionToken(sess, oldSession.TokenHash)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return refreshResponse, errors.New("Session Token Mismatch")
+	}
+
+	if oldSession.RotatedAt != nil {
+		u.revokeReusedFamily(oldSession, userAgent, ipAddress)
+		return refreshResponse, errors.New("Session Token Reused")
+	}
+
+	if time.Now().After(oldSession.ExpiresAt) {
+		return refreshResponse, errors.New("Session Expired")
+	}
+
+	newSession, err := utilities.GenerateSession(oldSession.Uid)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return refreshResponse, errors.New("Failed to Generate Session")
+	}
+	// the family keeps the lifetime and public id of the original login
+	newSession.FamilyId = oldSession.FamilyId
+	newSession.PublicId = oldSession.PublicId
+	newSession.ExpiresAt = oldSession.ExpiresAt
+	newSession.UserAgent = userAgent
+	newSession.IpAddress = ipAddress
+
+	err = u.sessionRepo.RotateSession(sess, newSession)
+	if errors.Is(err, persistance.ErrSessionRotated) {
+		u.revokeReusedFamily(oldSession, userAgent, ipAddress)
+		return refreshResponse, errors.New("Session Token Reused")
+	}
 	if err != nil {
 		log.Printf("Error: %v", err)
-		return tokenString, tokenExpire, errors.New("Invalid Session")
+		return refreshResponse, errors.New("Failed to Rotate Session")
 	}
+	refreshResponse.Session = newSession
 
-	err = matchSessionToken(sess, session.TokenHash)
+	sessionUser, err := u.userRepo.GetUserByID(newSession.Uid)
 	if err != nil {
 		log.Printf("Error: %v", err)
-		return tokenString, tokenExpire, errors.New("Session Token Mismatch")
+		return refreshResponse, errors.New("User Not Found")
 	}
 
-	tokenString, tokenExpire, err = utilities.GenerateJWT(session.Uid)
+	tokenString, tokenExpire, err := utilities.GenerateJWT(u.keySet, newSession.Uid, newSession.FamilyId.String(), []string{sessionUser.Role})
 	if err != nil {
 		log.Printf("Error: %v", err)
-		return tokenString, tokenExpire, errors.New("Failed to Generate Token")
+		return refreshResponse, errors.New("Failed to Generate Token")
+	}
+	refreshResponse.TokenString = tokenString
+	refreshResponse.TokenExpire = tokenExpire
+
+	return refreshResponse, nil
+}
+
+func (u *UserService) revokeReusedFamily(reused session.Session, userAgent string, ipAddress string) {
+	log.Printf("Security: rotated session %s of user %d reused, revoking family %s", reused.Id, reused.Uid, reused.FamilyId)
+
+	if err := u.sessionRepo.DeleteSessionFamily(reused.FamilyId.String()); err != nil {
+		log.Printf("Error: %v", err)
 	}
 
-	return tokenString, tokenExpire, nil
+	event := security.SecurityEvent{
+		EventType:     security.EventRefreshTokenReuse,
+		UserID:        reused.Uid,
+		SessionFamily: &reused.FamilyId,
+		IpAddress:     ipAddress,
+		UserAgent:     userAgent,
+		Detail:        fmt.Sprintf("rotated session %s presented again", reused.Id),
+	}
+	u.recordSecurityEvent(event)
 }
 
 func (u *UserService) GetUserByID(id int) (user.UserProfile, error) {
@@ -111,8 +218,14 @@ func (u *UserService) GetUserByID(id int) (user.UserProfile, error) {
 	return newUser, nil
 }
 
-func (u *UserService) LogoutUser(id int) error {
-	err := u.sessionRepo.DeleteSession(id)
+// LogoutUser ends the current session, or every session of the user when everywhere is set
+func (u *UserService) LogoutUser(id int, sess string, everywhere bool) error {
+	var err error
+	if everywhere {
+		err = u.sessionRepo.DeleteSession(id)
+	} else {
+		err = u.sessionRepo.DeleteSessionByID(id, sess)
+	}
 	if err != nil {
 		log.Printf("Error: %v", err)
 		return errors.New("Failed to Logout User")
@@ -120,6 +233,47 @@ func (u *UserService) LogoutUser(id int) error {
 	return nil
 }
 
+// ListSessions returns the active sessions of the user, marking the one the request came from
+func (u *UserService) ListSessions(id int, currentSess string) ([]session.SessionInfo, error) {
+	sessions, err := u.sessionRepo.GetSessionsByUid(id)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return []session.SessionInfo{}, errors.New("Unable to Fetch Sessions")
+	}
+
+	sessionInfos := make([]session.SessionInfo, 0, len(sessions))
+	for _, sess := range sessions {
+		sessionInfos = append(sessionInfos, session.SessionInfo{
+			Id:         sess.PublicId,
+			UserAgent:  sess.UserAgent,
+			IpAddress:  sess.IpAddress,
+			IssuedAt:   sess.IssuedAt,
+			ExpiresAt:  sess.ExpiresAt,
+			LastSeenAt: sess.LastSeenAt,
+			Current:    sess.Id.String() == currentSess,
+		})
+	}
+	return sessionInfos, nil
+}
+
+// RevokeSession ends the session the user knows by its public id and reports whether it is the
+// session the request came from
+func (u *UserService) RevokeSession(id int, publicID string, currentSess string) (bool, error) {
+	current := false
+	if currentSess != "" {
+		if currentSession, err := u.sessionRepo.GetSession(currentSess); err == nil {
+			current = currentSession.PublicId.String() == publicID
+		}
+	}
+
+	err := u.sessionRepo.DeleteSessionByPublicID(id, publicID)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return false, errors.New("Session Not Found")
+	}
+	return current, nil
+}
+
 func matchPassword(user user.UserLogin, password string) error {
 	// !error here
 	err := utilities.CheckPassword(password, user.Password)
@@ -134,8 +288,7 @@ func matchPassword(user user.UserLogin, password string) error {
 func matchSessionToken(id string, tokenHash string) error {
 	err := bcrypt.CompareHashAndPassword([]byte(tokenHash), []byte(id))
 	if err != nil {
-		log.Printf("Error: %v", err)
-		fmt.Println(err, "Unable to Match Password")
+		return fmt.Errorf("unable to match session token: %v", err)
 	}
 	return nil
 }
@@ -148,3 +301,61 @@ func (u *UserService) GetAllUsers() ([]user.GetUserResponse, error) {
 	}
 	return allUsers, nil
 }
+
+const (
+	defaultAccessTokenDays = 30
+	maxAccessTokenDays     = 365
+)
+
+func (u *UserService) CreateAccessToken(id int, request accesstoken.CreateAccessToken) (accesstoken.CreatedAccessToken, error) {
+	if strings.TrimSpace(request.Name) == "" {
+		return accesstoken.CreatedAccessToken{}, errors.New("Token Name is Required")
+	}
+	if len(request.Scopes) == 0 {
+		return accesstoken.CreatedAccessToken{}, errors.New("At Least One Scope is Required")
+	}
+	for _, scope := range request.Scopes {
+		if !slices.Contains(accesstoken.ValidScopes, scope) {
+			return accesstoken.CreatedAccessToken{}, fmt.Errorf("Unknown Scope %q", scope)
+		}
+	}
+
+	days := request.ExpiresInDays
+	if days == 0 {
+		days = defaultAccessTokenDays
+	}
+	if days < 0 || days > maxAccessTokenDays {
+		return accesstoken.CreatedAccessToken{}, fmt.Errorf("Expiry Must be Between 1 and %d Days", maxAccessTokenDays)
+	}
+
+	plainToken, token, err := utilities.GenerateAccessToken(id, request.Name, request.Scopes, time.Now().AddDate(0, 0, days))
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return accesstoken.CreatedAccessToken{}, errors.New("Failed to Generate Token")
+	}
+
+	createdToken, err := u.accessTokenRepo.CreateToken(token)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return accesstoken.CreatedAccessToken{}, errors.New("Failed to Create Token")
+	}
+	return accesstoken.CreatedAccessToken{AccessToken: createdToken, Token: plainToken}, nil
+}
+
+func (u *UserService) ListAccessTokens(id int) ([]accesstoken.AccessToken, error) {
+	tokens, err := u.accessTokenRepo.GetTokensByUid(id)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return []accesstoken.AccessToken{}, errors.New("Unable to Fetch Tokens")
+	}
+	return tokens, nil
+}
+
+func (u *UserService) RevokeAccessToken(id int, tokenID string) error {
+	err := u.accessTokenRepo.RevokeToken(id, tokenID)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return errors.New("Token Not Found")
+	}
+	return nil
+}
@@ -0,0 +1,4 @@
+-- a forced password reset is completed with a single-use token the admin hands to the user,
+-- not with the current password, which may be the one that leaked
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_reset_token TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_reset_expires_at TIMESTAMPTZ;
@@ -0,0 +1,10 @@
+-- SESSION PUBLIC IDS
+-- the session id is the refresh credential in the sess cookie, so sessions are listed and revoked by a separate
+-- public id that a family keeps across rotations
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS public_id UUID;
+UPDATE sessions SET public_id = families.public_id
+FROM (SELECT family_id, gen_random_uuid() AS public_id FROM sessions WHERE public_id IS NULL GROUP BY family_id) AS families
+WHERE sessions.family_id = families.family_id AND sessions.public_id IS NULL;
+ALTER TABLE sessions ALTER COLUMN public_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_public_id ON sessions(public_id);
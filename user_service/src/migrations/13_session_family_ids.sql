@@ -0,0 +1,6 @@
+-- SESSION FAMILY IDS
+-- the family id is the sid claim of every access token, families that took the id of their first refresh token
+-- get a new random one so an access token no longer carries a refresh credential
+UPDATE sessions SET family_id = families.new_family_id
+FROM (SELECT family_id, gen_random_uuid() AS new_family_id FROM sessions WHERE family_id IN (SELECT id FROM sessions) GROUP BY family_id) AS families
+WHERE sessions.family_id = families.family_id;
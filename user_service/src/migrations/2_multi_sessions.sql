@@ -0,0 +1,8 @@
+-- MULTIPLE SESSIONS PER USER
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_user_id_key;
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS ip_address TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
@@ -0,0 +1,6 @@
+-- deleted accounts are kept as anonymized rows so ids referenced by other services stay valid
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- anonymized addresses do not end in .com
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_check;
+ALTER TABLE users ADD CONSTRAINT users_email_check CHECK (email LIKE '%.com' OR deleted_at IS NOT NULL);
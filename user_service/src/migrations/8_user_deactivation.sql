@@ -0,0 +1,5 @@
+-- accounts blocked by an admin, they cannot log in and their sessions and tokens are refused
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMPTZ;
+
+-- set by an admin, the user must choose a new password before logging in again
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+-- name shown to other users, empty means the username is shown
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,235 @@
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// SigningKey is one entry of the key set. A key signs tokens between NotBefore and NotAfter,
+// and stays published for verification until RetireAt so tokens it signed can still be checked.
+type SigningKey struct {
+	Kid        string
+	Alg        string
+	PrivateKey crypto.Signer
+	NotBefore  time.Time
+	NotAfter   time.Time
+	RetireAt   time.Time
+}
+
+// keyFileEntry is one entry of the keyset manifest file
+type keyFileEntry struct {
+	Kid            string    `json:"kid"`
+	PrivateKeyFile string    `json:"private_key_file"`
+	NotBefore      time.Time `json:"not_before"`
+	NotAfter       time.Time `json:"not_after"`
+}
+
+type KeySet struct {
+	mu           sync.RWMutex
+	keys         []SigningKey
+	manifestPath string
+	tokenTTL     time.Duration
+}
+
+// LoadKeySet reads a JSON manifest listing the private keys (PEM, PKCS#1/PKCS#8 RSA or PKCS#8 Ed25519),
+// their kid and signing window. Relative key paths are resolved against the manifest directory.
+// tokenTTL is how long a key stays published after it stops signing.
+func LoadKeySet(manifestPath string, tokenTTL time.Duration) (*KeySet, error) {
+	content, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyset manifest: %w", err)
+	}
+
+	var entries []keyFileEntry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse keyset manifest: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("keyset manifest has no keys")
+	}
+
+	keySet := &KeySet{manifestPath: manifestPath, tokenTTL: tokenTTL}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if entry.Kid == "" {
+			return nil, errors.New("keyset manifest entry without kid")
+		}
+		if seen[entry.Kid] {
+			return nil, fmt.Errorf("duplicate kid %q in keyset manifest", entry.Kid)
+		}
+		seen[entry.Kid] = true
+
+		keyPath := entry.PrivateKeyFile
+		if !filepath.IsAbs(keyPath) {
+			keyPath = filepath.Join(filepath.Dir(manifestPath), keyPath)
+		}
+		signer, alg, err := loadPrivateKey(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", entry.Kid, err)
+		}
+
+		key := SigningKey{
+			Kid:        entry.Kid,
+			Alg:        alg,
+			PrivateKey: signer,
+			NotBefore:  entry.NotBefore,
+			NotAfter:   entry.NotAfter,
+		}
+		if !key.NotAfter.IsZero() {
+			key.RetireAt = key.NotAfter.Add(tokenTTL)
+		}
+		keySet.keys = append(keySet.keys, key)
+	}
+
+	keySet.sortKeys()
+	return keySet, nil
+}
+
+// ReloadEvery re-reads the manifest on every tick so keys added for an upcoming rotation
+// are picked up without a restart. A manifest that fails to load keeps the current keys.
+func (k *KeySet) ReloadEvery(interval time.Duration) {
+	if k.manifestPath == "" || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		reloaded, err := LoadKeySet(k.manifestPath, k.tokenTTL)
+		if err != nil {
+			log.Printf("Failed to reload JWT keyset, keeping current keys: %v", err)
+			continue
+		}
+		k.mu.Lock()
+		k.keys = reloaded.keys
+		k.mu.Unlock()
+	}
+}
+
+// NewEphemeralKeySet generates a single in-memory Ed25519 key, for local development only:
+// tokens do not survive a restart and cannot be shared between replicas.
+func NewEphemeralKeySet() (*KeySet, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &KeySet{keys: []SigningKey{{
+		Kid:        uuid.New().String(),
+		Alg:        AlgEdDSA,
+		PrivateKey: privateKey,
+	}}}, nil
+}
+
+func loadPrivateKey(path string) (crypto.Signer, string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, "", errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, "", fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return nil, "", errors.New("RSA keys must be at least 2048 bits")
+		}
+		return key, AlgRS256, nil
+	case ed25519.PrivateKey:
+		return key, AlgEdDSA, nil
+	default:
+		return nil, "", fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+// newest activation first, so the first usable key is the current signing key
+func (k *KeySet) sortKeys() {
+	sort.SliceStable(k.keys, func(i, j int) bool {
+		return k.keys[i].NotBefore.After(k.keys[j].NotBefore)
+	})
+}
+
+func (k SigningKey) canSign(now time.Time) bool {
+	if !k.NotBefore.IsZero() && now.Before(k.NotBefore) {
+		return false
+	}
+	if !k.NotAfter.IsZero() && !now.Before(k.NotAfter) {
+		return false
+	}
+	return true
+}
+
+func (k SigningKey) published(now time.Time) bool {
+	return k.RetireAt.IsZero() || now.Before(k.RetireAt)
+}
+
+// SigningKey returns the key that signs new tokens right now, the most recently activated one
+func (k *KeySet) SigningKey(now time.Time) (SigningKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.canSign(now) {
+			return key, nil
+		}
+	}
+	return SigningKey{}, errors.New("no active signing key")
+}
+
+// VerificationKey returns the public key for kid, as long as the key is still published
+func (k *KeySet) VerificationKey(kid string, now time.Time) (SigningKey, crypto.PublicKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.Kid == kid && key.published(now) {
+			return key, key.PrivateKey.Public(), nil
+		}
+	}
+	return SigningKey{}, nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// JWKS returns the public half of every published key, including keys scheduled
+// to start signing later so verifiers can fetch them ahead of the rotation
+func (k *KeySet) JWKS(now time.Time) JWKSet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	jwks := JWKSet{Keys: []JWK{}}
+	for _, key := range k.keys {
+		if key.published(now) {
+			jwks.Keys = append(jwks.Keys, publicJWK(key))
+		}
+	}
+	return jwks
+}
@@ -0,0 +1,57 @@
+package utilities
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+	"user_service/src/internal/core/accesstoken"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const accessTokenPrefix = "tmpat"
+
+// GenerateAccessToken creates a personal access token "tmpat_<id>_<secret>". The id locates the row,
+// the secret is only kept as a bcrypt hash, the same way sessions store their token.
+func GenerateAccessToken(userId int, name string, scopes []string, expiresAt time.Time) (string, accesstoken.AccessToken, error) {
+	tokenID := uuid.New()
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", accesstoken.AccessToken{}, err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	hashSecret, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", accesstoken.AccessToken{}, err
+	}
+
+	token := accesstoken.AccessToken{
+		Id:        tokenID,
+		Uid:       userId,
+		Name:      name,
+		TokenHash: string(hashSecret),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	return accessTokenPrefix + "_" + tokenID.String() + "_" + secret, token, nil
+}
+
+// ParseAccessToken splits a personal access token into its id and secret
+func ParseAccessToken(token string) (string, string, error) {
+	parts := strings.SplitN(token, "_", 3)
+	if len(parts) != 3 || parts[0] != accessTokenPrefix {
+		return "", "", errors.New("malformed access token")
+	}
+	if _, err := uuid.Parse(parts[1]); err != nil {
+		return "", "", errors.New("malformed access token")
+	}
+	return parts[1], parts[2], nil
+}
+
+func CheckAccessTokenSecret(tokenHash string, secret string) error {
+	return bcrypt.CompareHashAndPassword([]byte(tokenHash), []byte(secret))
+}
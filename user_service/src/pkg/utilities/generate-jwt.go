@@ -1,51 +1,79 @@
 package utilities
 
 import (
-	"user_service/src/internal/core/session"
+	"errors"
+	"fmt"
+	"strconv"
 	"time"
+	"user_service/src/internal/core/session"
+	"user_service/src/pkg/jwtkeys"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Claims struct {
 	Uid int `json:"uid"`
-	jwt.StandardClaims
+	// Sid is the session family the token was issued for, verifiers use it to check revocation
+	Sid   string   `json:"sid,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
 }
 
-var jwtKey = []byte("kfladsoifdwfds")
+// AccessTokenTTL is the lifetime of the "at" token, retired signing keys stay published at least this long
+const AccessTokenTTL = 5 * time.Hour //!Default was 5 * time.Minute
+
+// GenerateJWT signs the access token with the current key of the key set, its kid goes into the header
+func GenerateJWT(keySet *jwtkeys.KeySet, uid int, sessionFamily string, roles []string) (string, time.Time, error) {
+	now := time.Now()
+	expirationTime := now.Add(AccessTokenTTL)
+	signingKey, err := keySet.SigningKey(now)
+	if err != nil {
+		return "", time.Now(), err
+	}
 
-func GenerateJWT(uid int) (string, time.Time, error) {
-	expirationTime := time.Now().Add(5 * time.Hour) //!Default was 5 * time.Minute
 	claims := &Claims{
-		Uid: uid,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
+		Uid:   uid,
+		Sid:   sessionFamily,
+		Roles: roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(uid),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	//! I was using Signing Method ES256 instead of HS256
-	tokenString, err := token.SignedString(jwtKey)
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(signingKey.Alg), claims)
+	token.Header["kid"] = signingKey.Kid
+	tokenString, err := token.SignedString(signingKey.PrivateKey)
 	if err != nil {
 		return "", time.Now(), err
 	}
 	return tokenString, expirationTime, nil
 }
 
-func ValidateJWT(tokenString string) (*Claims, error) {
+func ValidateJWT(keySet *jwtkeys.KeySet, tokenString string) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-	if err != nil {
-		if err == jwt.ErrSignatureInvalid {
+		kid, ok := token.Header["kid"].(string)
+		if !ok {
+			return nil, errors.New("token has no kid")
+		}
+		signingKey, publicKey, err := keySet.VerificationKey(kid, time.Now())
+		if err != nil {
 			return nil, err
 		}
+		// the header alg must match the key, never trust it on its own
+		if token.Method.Alg() != signingKey.Alg {
+			return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), kid)
+		}
+		return publicKey, nil
+	}, jwt.WithValidMethods([]string{jwtkeys.AlgRS256, jwtkeys.AlgEdDSA}), jwt.WithExpirationRequired())
+	if err != nil {
 		return nil, err
 	}
 	if !token.Valid {
-		return nil, err
+		return nil, errors.New("invalid token")
 	}
 	return claims, nil
 }
@@ -66,6 +94,8 @@ func GenerateSession(userId int) (session.Session, error) {
 		TokenHash: string(hashToken),
 		ExpiresAt: expiresAt,
 		IssuedAt:  issuedAt,
+		FamilyId:  uuid.New(),
+		PublicId:  uuid.New(),
 	}
 	return session, nil
 }